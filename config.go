@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Where and how the server runs, everything else (what the pages look like) is still set with environment variables
+type Config struct {
+	// raw., mosaic. and api. are served under it too
+	DomainName string `json:"domainName"`
+	// :80 only answers certificate challenges, :443 is everything else
+	ListenHTTP  string `json:"listenHTTP"`
+	ListenHTTPS string `json:"listenHTTPS"`
+	TemplateDir string `json:"templateDir"`
+	// "ffmpeg" finds it in the PATH
+	FFmpegPath   string `json:"ffmpegPath"`
+	CertCacheDir string `json:"certCacheDir"`
+	// Seconds a single request to Bluesky gets
+	UpstreamTimeout int `json:"upstreamTimeout"`
+	// Bytes, anything bigger from Bluesky isn't read
+	MaxReadLimit int64 `json:"maxReadLimit"`
+	// Seconds requests in flight get to finish on SIGINT/SIGTERM
+	ShutdownTimeout int `json:"shutdownTimeout"`
+}
+
+// The file XBSKY_CONFIG points to goes first (if it's set), whatever it leaves out comes from the environment, and then the defaults
+func loadConfig() (Config, error) {
+	var config Config
+
+	if configPath := os.Getenv("XBSKY_CONFIG"); configPath != "" {
+		configFile, openErr := os.Open(configPath)
+		if openErr != nil {
+			return Config{}, fmt.Errorf("failed to open XBSKY_CONFIG file: %w", openErr)
+		}
+		defer configFile.Close() //nolint:errcheck // should not fail under normal circumstances
+
+		// A typo in a field name would otherwise go unnoticed
+		decoder := json.NewDecoder(configFile)
+		decoder.DisallowUnknownFields()
+
+		if decodeErr := decoder.Decode(&config); decodeErr != nil {
+			return Config{}, fmt.Errorf("failed to read XBSKY_CONFIG file: %w", decodeErr)
+		}
+	}
+
+	config.DomainName = cmp.Or(config.DomainName, os.Getenv("DOMAIN_NAME"))
+	config.ListenHTTP = cmp.Or(config.ListenHTTP, os.Getenv("LISTEN_HTTP"), ":80")
+	config.ListenHTTPS = cmp.Or(config.ListenHTTPS, os.Getenv("LISTEN_HTTPS"), ":443")
+	config.TemplateDir = cmp.Or(config.TemplateDir, os.Getenv("TEMPLATE_DIR"), "./views")
+	config.FFmpegPath = cmp.Or(config.FFmpegPath, os.Getenv("FFMPEG_PATH"), "ffmpeg")
+	config.CertCacheDir = cmp.Or(config.CertCacheDir, os.Getenv("CERT_CACHE_DIR"), "certs")
+
+	if config.UpstreamTimeout == 0 {
+		config.UpstreamTimeout = 10
+
+		if timeoutStr := os.Getenv("UPSTREAM_TIMEOUT"); timeoutStr != "" {
+			timeout, atoiErr := strconv.Atoi(timeoutStr)
+			if atoiErr != nil {
+				return Config{}, errors.New("UPSTREAM_TIMEOUT environment variable should be a number of seconds")
+			}
+
+			config.UpstreamTimeout = timeout
+		}
+	}
+
+	if config.MaxReadLimit == 0 {
+		config.MaxReadLimit = 10 * (1024 * 1024)
+
+		if limitStr := os.Getenv("MAX_READ_LIMIT"); limitStr != "" {
+			limit, parseErr := strconv.ParseInt(limitStr, 10, 64)
+			if parseErr != nil {
+				return Config{}, errors.New("MAX_READ_LIMIT environment variable should be a number of bytes")
+			}
+
+			config.MaxReadLimit = limit
+		}
+	}
+
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 30
+
+		if timeoutStr := os.Getenv("SHUTDOWN_TIMEOUT"); timeoutStr != "" {
+			timeout, atoiErr := strconv.Atoi(timeoutStr)
+			if atoiErr != nil {
+				return Config{}, errors.New("SHUTDOWN_TIMEOUT environment variable should be a number of seconds")
+			}
+
+			config.ShutdownTimeout = timeout
+		}
+	}
+
+	return config, config.validate()
+}
+
+// Each message names both places it can be set
+func (config Config) validate() error {
+	if config.DomainName == "" {
+		return errors.New("DOMAIN_NAME environment variable (or domainName in the config file) should not be empty")
+	}
+
+	// The server has 30 seconds to write the whole response
+	if config.UpstreamTimeout < 1 || config.UpstreamTimeout >= 30 {
+		return errors.New("UPSTREAM_TIMEOUT environment variable (or upstreamTimeout in the config file) should be a number of seconds from 1 to 29")
+	}
+
+	if config.MaxReadLimit < 1 {
+		return errors.New("MAX_READ_LIMIT environment variable (or maxReadLimit in the config file) should be a number of bytes above 0")
+	}
+
+	if config.ShutdownTimeout < 1 {
+		return errors.New("SHUTDOWN_TIMEOUT environment variable (or shutdownTimeout in the config file) should be a number of seconds above 0")
+	}
+
+	if dirInfo, statErr := os.Stat(config.TemplateDir); statErr != nil || !dirInfo.IsDir() {
+		return fmt.Errorf("TEMPLATE_DIR environment variable (or templateDir in the config file) should be a directory, %q isn't one", config.TemplateDir)
+	}
+
+	return nil
+}
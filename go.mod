@@ -2,9 +2,10 @@ module main
 
 go 1.26.4
 
-require golang.org/x/crypto v0.53.0
-
 require (
-	golang.org/x/net v0.55.0 // indirect
-	golang.org/x/text v0.38.0 // indirect
+	golang.org/x/crypto v0.53.0
+	golang.org/x/sync v0.21.0
+	golang.org/x/text v0.38.0
 )
+
+require golang.org/x/net v0.55.0 // indirect
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"cmp"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math/rand/v2"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -20,13 +22,13 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 
 	hBytes, err := hex.DecodeString(encodedID)
 	if err != nil {
-		ErrorPage(w, "invalid ID")
+		ErrorJSON(w, pageErrorf(ErrBadInput, "genActivity: Invalid ID"))
 		return
 	}
 
 	var actReqData types.RichActivityEncoded
 	if unmarshalErr := json.Unmarshal(hBytes, &actReqData); unmarshalErr != nil {
-		ErrorPage(w, "failed to unmarshal JSON")
+		ErrorJSON(w, pageErrorf(ErrBadInput, "genActivity: Failed to unmarshal JSON"))
 		return
 	}
 
@@ -40,13 +42,13 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 
 		newAPIReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
 		if err != nil {
-			ErrorPage(w, "failed to request api data")
+			ErrorJSON(w, pageErrorf(ErrInternal, "genActivity: Failed to create request"))
 			return
 		}
 
 		apiResp, err := helpers.TimeoutClient.Do(newAPIReq)
 		if err != nil {
-			ErrorPage(w, "failed to do api request")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to do request"))
 			return
 		}
 
@@ -55,10 +57,12 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 		var sortedAPI types.SortedAPIResponse
 
 		if decodeErr := json.NewDecoder(apiResp.Body).Decode(&sortedAPI); decodeErr != nil {
-			ErrorPage(w, "failed to decode response")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to decode response"))
 			return
 		}
 
+		printer := ps.localizer(w, r)
+
 		var richContent string
 
 		switch sortedAPI.OriginalData.Thread.Post.Embed.Type {
@@ -72,37 +76,19 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 
 				qText := sortedAPI.OriginalData.Thread.Post.Embed.Record.Value.Text
 				if qText != "" {
-					if len(sortedAPI.OriginalData.Thread.Post.Embed.Record.Value.Facets) > 0 {
-						richBuilder.WriteString("<p>")
-
-						var lastByteIndex int64
-						for _, v := range sortedAPI.OriginalData.Thread.Post.Embed.Record.Value.Facets {
-							if len(v.Features) > 0 {
-								richBuilder.WriteString(qText[lastByteIndex:v.Index.ByteStart])
-
-								switch v.Features[0].Type {
-								case "app.bsky.richtext.facet#tag":
-									fmt.Fprintf(&richBuilder, `<a href=%q>#%s</a>`, "https://bsky.app/hashtag/"+v.Features[0].Tag, v.Features[0].Tag)
-								case "app.bsky.richtext.facet#link":
-									fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, v.Features[0].URI, qText[v.Index.ByteStart:v.Index.ByteEnd])
-								case "app.bsky.richtext.facet#mention":
-									fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, "https://bsky.app/profile/"+v.Features[0].DID, qText[v.Index.ByteStart:v.Index.ByteEnd])
-								}
-
-								lastByteIndex = v.Index.ByteEnd
-							}
-						}
-
-						richBuilder.WriteString(qText[lastByteIndex:])
-						richBuilder.WriteString("</p>")
-					} else {
-						fmt.Fprintf(&richBuilder, "<p>%s</p>", qText)
-					}
+					richBuilder.WriteString(ps.richText(qText, sortedAPI.OriginalData.Thread.Post.Embed.Record.Value.Facets))
 				}
 
-				richContent += fmt.Sprintf(`<b><span><a href="https://bsky.app/profile/%s/post/%s">📝 Quoting %s (@%s):</a></span></b><blockquote>%s</blockquote>`, sortedAPI.OriginalData.Thread.Post.Embed.Record.Author.DID, sortedAPI.ParsedData.OriginalPostID, sortedAPI.OriginalData.Thread.Post.Embed.Record.Author.DisplayName, sortedAPI.OriginalData.Thread.Post.Embed.Record.Author.Handle, richBuilder.String())
+				richContent += fmt.Sprintf(`<b><span><a href="https://bsky.app/profile/%s/post/%s">%s</a></span></b><blockquote>%s</blockquote>`, sortedAPI.OriginalData.Thread.Post.Embed.Record.Author.DID, sortedAPI.ParsedData.OriginalPostID, printer.Sprintf(msgQuoting, sortedAPI.OriginalData.Thread.Post.Embed.Record.Author.DisplayName, sortedAPI.OriginalData.Thread.Post.Embed.Record.Author.Handle), richBuilder.String())
+			} else if sortedAPI.OriginalData.Thread.Post.Embed.Record.Type == bskyEmbedRecordDetached {
+				richContent += fmt.Sprintf("<b><span>%s</span></b>", printer.Sprintf(msgDetachedQuote))
 			}
 		case bskyEmbedQuote:
+			if sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Type == bskyEmbedRecordDetached {
+				richContent += fmt.Sprintf("<b><span>%s</span></b>", printer.Sprintf(msgDetachedQuote))
+				break
+			}
+
 			if sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.DisplayName == "" {
 				sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.DisplayName = sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.Handle
 			}
@@ -110,35 +96,10 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 			var richBuilder strings.Builder
 			qText := sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Value.Text
 			if qText != "" {
-				if len(sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Value.Facets) > 0 {
-					richBuilder.WriteString("<p>")
-
-					var lastByteIndex int64
-					for _, v := range sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Value.Facets {
-						if len(v.Features) > 0 {
-							richBuilder.WriteString(qText[lastByteIndex:v.Index.ByteStart])
-
-							switch v.Features[0].Type {
-							case "app.bsky.richtext.facet#tag":
-								fmt.Fprintf(&richBuilder, `<a href=%q>#%s</a>`, "https://bsky.app/hashtag/"+v.Features[0].Tag, v.Features[0].Tag)
-							case "app.bsky.richtext.facet#link":
-								fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, v.Features[0].URI, qText[v.Index.ByteStart:v.Index.ByteEnd])
-							case "app.bsky.richtext.facet#mention":
-								fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, "https://bsky.app/profile/"+v.Features[0].DID, qText[v.Index.ByteStart:v.Index.ByteEnd])
-							}
-
-							lastByteIndex = v.Index.ByteEnd
-						}
-					}
-
-					richBuilder.WriteString(qText[lastByteIndex:])
-					richBuilder.WriteString("</p>")
-				} else {
-					fmt.Fprintf(&richBuilder, "<p>%s</p>", qText)
-				}
+				richBuilder.WriteString(ps.richText(qText, sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Value.Facets))
 			}
 
-			richContent += fmt.Sprintf(`<b><span><a href="https://bsky.app/profile/%s/post/%s">📝 Quoting %s (@%s):</a></span></b><blockquote>%s</blockquote>`, sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.DID, sortedAPI.ParsedData.OriginalPostID, sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.DisplayName, sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.Handle, richBuilder.String())
+			richContent += fmt.Sprintf(`<b><span><a href="https://bsky.app/profile/%s/post/%s">%s</a></span></b><blockquote>%s</blockquote>`, sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.DID, sortedAPI.ParsedData.OriginalPostID, printer.Sprintf(msgQuoting, sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.DisplayName, sortedAPI.OriginalData.Thread.Post.Embed.Record.Record.Author.Handle), richBuilder.String())
 		}
 
 		if sortedAPI.OriginalData.Thread.Parent != nil {
@@ -149,65 +110,22 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 			var richBuilder strings.Builder
 			qText := sortedAPI.OriginalData.Thread.Parent.Post.Record.Text
 			if qText != "" {
-				if len(sortedAPI.OriginalData.Thread.Parent.Post.Record.Facets) > 0 {
-					richBuilder.WriteString("<p>")
-
-					var lastByteIndex int64
-					for _, v := range sortedAPI.OriginalData.Thread.Parent.Post.Record.Facets {
-						if len(v.Features) > 0 {
-							richBuilder.WriteString(qText[lastByteIndex:v.Index.ByteStart])
-
-							switch v.Features[0].Type {
-							case "app.bsky.richtext.facet#tag":
-								fmt.Fprintf(&richBuilder, `<a href=%q>#%s</a>`, "https://bsky.app/hashtag/"+v.Features[0].Tag, v.Features[0].Tag)
-							case "app.bsky.richtext.facet#link":
-								fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, v.Features[0].URI, qText[v.Index.ByteStart:v.Index.ByteEnd])
-							case "app.bsky.richtext.facet#mention":
-								fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, "https://bsky.app/profile/"+v.Features[0].DID, qText[v.Index.ByteStart:v.Index.ByteEnd])
-							}
-
-							lastByteIndex = v.Index.ByteEnd
-						}
-					}
-
-					richBuilder.WriteString(qText[lastByteIndex:])
-					richBuilder.WriteString("</p>")
-				} else {
-					fmt.Fprintf(&richBuilder, "<p>%s</p>", qText)
-				}
+				richBuilder.WriteString(ps.richText(qText, sortedAPI.OriginalData.Thread.Parent.Post.Record.Facets))
 			}
 
-			richContent += fmt.Sprintf(`<span><b><a href="https://bsky.app/profile/%s/post/%s">💬 Replying to %s (@%s):</a></b></span><blockquote>%s</blockquote>`, sortedAPI.OriginalData.Thread.Parent.Post.Author.DID, sortedAPI.ParsedData.OriginalPostID, sortedAPI.OriginalData.Thread.Parent.Post.Author.DisplayName, sortedAPI.OriginalData.Thread.Parent.Post.Author.Handle, richBuilder.String())
+			switch {
+			case !isBlockedAuthor(sortedAPI.OriginalData.Thread.Parent.Post.Author):
+				richContent += fmt.Sprintf(`<span><b><a href="https://bsky.app/profile/%s/post/%s">%s</a></b></span><blockquote>%s</blockquote>`, sortedAPI.OriginalData.Thread.Parent.Post.Author.DID, sortedAPI.ParsedData.OriginalPostID, printer.Sprintf(msgReplyingTo, sortedAPI.OriginalData.Thread.Parent.Post.Author.DisplayName, sortedAPI.OriginalData.Thread.Parent.Post.Author.Handle), richBuilder.String())
+			case richBuilder.Len() > 0:
+				richContent += fmt.Sprintf(`<span><b>%s:</b></span><blockquote>%s</blockquote>`, printer.Sprintf(msgReplyBlocked), richBuilder.String())
+			default:
+				richContent += fmt.Sprintf(`<span><b>%s</b></span>`, printer.Sprintf(msgReplyBlocked))
+			}
 		}
 
 		var richBuilder strings.Builder
 		if sortedAPI.ParsedData.Record.Text != "" {
-			if len(sortedAPI.OriginalData.Thread.Post.Record.Facets) > 0 {
-				richBuilder.WriteString("<p>")
-
-				var lastByteIndex int64
-				for _, v := range sortedAPI.OriginalData.Thread.Post.Record.Facets {
-					if len(v.Features) > 0 {
-						richBuilder.WriteString(sortedAPI.ParsedData.Record.Text[lastByteIndex:v.Index.ByteStart])
-
-						switch v.Features[0].Type {
-						case "app.bsky.richtext.facet#tag":
-							fmt.Fprintf(&richBuilder, `<a href=%q>#%s</a>`, "https://bsky.app/hashtag/"+v.Features[0].Tag, v.Features[0].Tag)
-						case "app.bsky.richtext.facet#link":
-							fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, v.Features[0].URI, sortedAPI.ParsedData.Record.Text[v.Index.ByteStart:v.Index.ByteEnd])
-						case "app.bsky.richtext.facet#mention":
-							fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, "https://bsky.app/profile/"+v.Features[0].DID, sortedAPI.ParsedData.Record.Text[v.Index.ByteStart:v.Index.ByteEnd])
-						}
-
-						lastByteIndex = v.Index.ByteEnd
-					}
-				}
-
-				richBuilder.WriteString(sortedAPI.ParsedData.Record.Text[lastByteIndex:])
-				richBuilder.WriteString("</p>")
-			} else {
-				fmt.Fprintf(&richBuilder, "<p>%s</p>", sortedAPI.ParsedData.Record.Text)
-			}
+			richBuilder.WriteString(ps.richText(sortedAPI.ParsedData.Record.Text, sortedAPI.OriginalData.Thread.Post.Record.Facets))
 
 			richContent += richBuilder.String()
 		}
@@ -266,8 +184,8 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 				Acct:         sortedAPI.ParsedData.Author.Handle,
 				URL:          "https://bsky.app/profile/" + sortedAPI.ParsedData.Author.Handle,
 				URI:          "https://bsky.app/profile/" + sortedAPI.ParsedData.Author.Handle,
-				Avatar:       sortedAPI.ParsedData.Author.Avatar,
-				AvatarStatic: sortedAPI.ParsedData.Author.Avatar,
+				Avatar:       ps.avatarOrFallback(sortedAPI.ParsedData.Author.Avatar),
+				AvatarStatic: ps.avatarOrFallback(sortedAPI.ParsedData.Author.Avatar),
 			},
 			MediaAttachments: []types.RichActivityMedia{},
 		}
@@ -322,13 +240,13 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 	case "prof":
 		newAPIReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, fmt.Sprintf("https://api.%s/profile/%s", ps.DomainName, actReqData.Handle), http.NoBody)
 		if err != nil {
-			ErrorPage(w, "failed to request api data")
+			ErrorJSON(w, pageErrorf(ErrInternal, "genActivity: Failed to create request"))
 			return
 		}
 
 		apiResp, err := helpers.TimeoutClient.Do(newAPIReq)
 		if err != nil {
-			ErrorPage(w, "failed to do api request")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to do request"))
 			return
 		}
 
@@ -337,7 +255,7 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 		var sortedAPI types.UserProfile
 
 		if decodeErr := json.NewDecoder(apiResp.Body).Decode(&sortedAPI); decodeErr != nil {
-			ErrorPage(w, "failed to decode response")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to decode response"))
 			return
 		}
 
@@ -369,21 +287,21 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 				Acct:         sortedAPI.Handle,
 				URL:          "https://bsky.app/profile/" + sortedAPI.Handle,
 				URI:          "https://bsky.app/profile/" + sortedAPI.Handle,
-				Avatar:       sortedAPI.Avatar,
-				AvatarStatic: sortedAPI.Avatar,
+				Avatar:       ps.avatarOrFallback(sortedAPI.Avatar),
+				AvatarStatic: ps.avatarOrFallback(sortedAPI.Avatar),
 			},
 			MediaAttachments: []types.RichActivityMedia{},
 		}
 	case "feed":
 		newAPIReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, fmt.Sprintf("https://api.%s/profile/%s/feed/%s", ps.DomainName, actReqData.Handle, actReqData.PostID), http.NoBody)
 		if err != nil {
-			ErrorPage(w, "failed to request api data")
+			ErrorJSON(w, pageErrorf(ErrInternal, "genActivity: Failed to create request"))
 			return
 		}
 
 		apiResp, err := helpers.TimeoutClient.Do(newAPIReq)
 		if err != nil {
-			ErrorPage(w, "failed to do api request")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to do request"))
 			return
 		}
 
@@ -392,7 +310,7 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 		var sortedAPI types.APIFeed
 
 		if decodeErr := json.NewDecoder(apiResp.Body).Decode(&sortedAPI); decodeErr != nil {
-			ErrorPage(w, "failed to decode response")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to decode response"))
 			return
 		}
 
@@ -432,8 +350,8 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 				Acct:         sortedAPI.View.Creator.Handle,
 				URL:          "https://bsky.app/profile/" + sortedAPI.View.Creator.Handle,
 				URI:          "https://bsky.app/profile/" + sortedAPI.View.Creator.Handle,
-				Avatar:       sortedAPI.View.Creator.Avatar,
-				AvatarStatic: sortedAPI.View.Creator.Avatar,
+				Avatar:       ps.avatarOrFallback(sortedAPI.View.Creator.Avatar),
+				AvatarStatic: ps.avatarOrFallback(sortedAPI.View.Creator.Avatar),
 			},
 			MediaAttachments: []types.RichActivityMedia{},
 		}
@@ -450,13 +368,13 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 	case "list":
 		newAPIReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, fmt.Sprintf("https://api.%s/profile/%s/lists/%s", ps.DomainName, actReqData.Handle, actReqData.PostID), http.NoBody)
 		if err != nil {
-			ErrorPage(w, "failed to request api data")
+			ErrorJSON(w, pageErrorf(ErrInternal, "genActivity: Failed to create request"))
 			return
 		}
 
 		apiResp, err := helpers.TimeoutClient.Do(newAPIReq)
 		if err != nil {
-			ErrorPage(w, "failed to do api request")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to do request"))
 			return
 		}
 
@@ -465,7 +383,7 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 		var sortedAPI types.APIList
 
 		if decodeErr := json.NewDecoder(apiResp.Body).Decode(&sortedAPI); decodeErr != nil {
-			ErrorPage(w, "failed to decode response")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to decode response"))
 			return
 		}
 
@@ -493,8 +411,8 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 				Acct:         sortedAPI.List.Creator.Handle,
 				URL:          "https://bsky.app/profile/" + sortedAPI.List.Creator.Handle,
 				URI:          "https://bsky.app/profile/" + sortedAPI.List.Creator.Handle,
-				Avatar:       sortedAPI.List.Creator.Avatar,
-				AvatarStatic: sortedAPI.List.Creator.Avatar,
+				Avatar:       ps.avatarOrFallback(sortedAPI.List.Creator.Avatar),
+				AvatarStatic: ps.avatarOrFallback(sortedAPI.List.Creator.Avatar),
 			},
 			MediaAttachments: []types.RichActivityMedia{},
 		}
@@ -511,13 +429,13 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 	case "pack":
 		newAPIReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, fmt.Sprintf("https://api.%s/starter-pack/%s/%s", ps.DomainName, actReqData.Handle, actReqData.PostID), http.NoBody)
 		if err != nil {
-			ErrorPage(w, "failed to request api data")
+			ErrorJSON(w, pageErrorf(ErrInternal, "genActivity: Failed to create request"))
 			return
 		}
 
 		apiResp, err := helpers.TimeoutClient.Do(newAPIReq)
 		if err != nil {
-			ErrorPage(w, "failed to do api request")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to do request"))
 			return
 		}
 
@@ -526,7 +444,7 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 		var sortedAPI types.APIPack
 
 		if decodeErr := json.NewDecoder(apiResp.Body).Decode(&sortedAPI); decodeErr != nil {
-			ErrorPage(w, "failed to decode response")
+			ErrorJSON(w, pageErrorf(ErrUpstream, "genActivity: Failed to decode response"))
 			return
 		}
 
@@ -554,25 +472,68 @@ func (ps *HandlerPass) GenActivity(w http.ResponseWriter, r *http.Request) {
 				Acct:         sortedAPI.StarterPack.Creator.Handle,
 				URL:          "https://bsky.app/profile/" + sortedAPI.StarterPack.Creator.Handle,
 				URI:          "https://bsky.app/profile/" + sortedAPI.StarterPack.Creator.Handle,
-				Avatar:       sortedAPI.StarterPack.Creator.Avatar,
-				AvatarStatic: sortedAPI.StarterPack.Creator.Avatar,
+				Avatar:       ps.avatarOrFallback(sortedAPI.StarterPack.Creator.Avatar),
+				AvatarStatic: ps.avatarOrFallback(sortedAPI.StarterPack.Creator.Avatar),
 			},
 			MediaAttachments: []types.RichActivityMedia{},
 		}
 
-		ogCard := fmt.Sprintf("https://ogcard.cdn.bsky.app/start/%s/%s", sortedAPI.StarterPack.Creator.DID, actReqData.PostID)
-		richEmbed.MediaAttachments = append(richEmbed.MediaAttachments, types.RichActivityMedia{
-			ID:          strconv.Itoa(rand.Int()),
-			Type:        "image",
-			URL:         ogCard,
-			Preview:     ogCard,
-			Description: "",
-		})
+		ogCard := starterPackCard(sortedAPI.StarterPack.Creator.DID, actReqData.PostID, sortedAPI.StarterPack.Creator.Avatar)
+		if ogCard != "" {
+			richEmbed.MediaAttachments = append(richEmbed.MediaAttachments, types.RichActivityMedia{
+				ID:          strconv.Itoa(rand.Int()),
+				Type:        "image",
+				URL:         ogCard,
+				Preview:     ogCard,
+				Description: "",
+			})
+		}
 	default:
-		ErrorPage(w, "Invalid type")
+		ErrorJSON(w, pageErrorf(ErrBadInput, "genActivity: Invalid type"))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(&richEmbed)
 }
+
+// Turns the post's facets (tags, links, mentions) into links. They come from whoever made the post, so only the first
+// MaxFacets are used, and any that don't fit the text (overlapping, past the end) are skipped instead of sliced with
+func (ps *HandlerPass) richText(text string, facets []types.APIFacet) string {
+	if len(facets) == 0 {
+		return fmt.Sprintf("<p>%s</p>", text)
+	}
+
+	// Capped before sorting, so a post with thousands of them costs the same as one at the cap
+	facets = slices.SortedFunc(slices.Values(facets[:min(len(facets), ps.MaxFacets)]), func(a, b types.APIFacet) int {
+		return cmp.Compare(a.Index.ByteStart, b.Index.ByteStart)
+	})
+
+	var richBuilder strings.Builder
+	richBuilder.WriteString("<p>")
+
+	var lastByteIndex int64
+	for _, v := range facets {
+		if len(v.Features) == 0 || v.Index.ByteStart < lastByteIndex || v.Index.ByteEnd < v.Index.ByteStart || v.Index.ByteEnd > int64(len(text)) {
+			continue
+		}
+
+		richBuilder.WriteString(text[lastByteIndex:v.Index.ByteStart])
+
+		switch v.Features[0].Type {
+		case "app.bsky.richtext.facet#tag":
+			fmt.Fprintf(&richBuilder, `<a href=%q>#%s</a>`, "https://bsky.app/hashtag/"+v.Features[0].Tag, v.Features[0].Tag)
+		case "app.bsky.richtext.facet#link":
+			fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, v.Features[0].URI, text[v.Index.ByteStart:v.Index.ByteEnd])
+		case "app.bsky.richtext.facet#mention":
+			fmt.Fprintf(&richBuilder, `<a href=%q>%s</a>`, "https://bsky.app/profile/"+v.Features[0].DID, text[v.Index.ByteStart:v.Index.ByteEnd])
+		}
+
+		lastByteIndex = v.Index.ByteEnd
+	}
+
+	richBuilder.WriteString(text[lastByteIndex:])
+	richBuilder.WriteString("</p>")
+
+	return richBuilder.String()
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"main/internal/types"
+)
+
+// A facet of kind (tag, link or mention) over text[start:end]
+func testFacet(kind string, start, end int) types.APIFacet {
+	var facet types.APIFacet
+	facet.Index.ByteStart, facet.Index.ByteEnd = int64(start), int64(end)
+	facet.Features = append(facet.Features, struct {
+		Type string `json:"$type"`
+		URI  string `json:"uri"`
+		Tag  string `json:"tag"`
+		DID  string `json:"did"`
+	}{Type: "app.bsky.richtext.facet#" + kind, URI: "https://example.com", Tag: "tag", DID: "did:plc:bob"})
+
+	return facet
+}
+
+func TestRichText(t *testing.T) {
+	t.Parallel()
+
+	// 10,000 one-byte tags, one per letter
+	manyText := strings.Repeat("a", 10_000)
+	manyFacets := make([]types.APIFacet, len(manyText))
+	for i := range manyFacets {
+		manyFacets[i] = testFacet("tag", i, i+1)
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		facets    []types.APIFacet
+		maxFacets int
+		want      string
+		// Checked instead of want, for the ones too long to write out
+		wantLinks int
+	}{
+		{name: "no facets", text: "hello", maxFacets: 100, want: "<p>hello</p>"},
+		{
+			name:      "all kinds",
+			text:      "see example.com with @bob #tag",
+			facets:    []types.APIFacet{testFacet("link", 4, 15), testFacet("mention", 21, 25), testFacet("tag", 26, 30)},
+			maxFacets: 100,
+			want:      `<p>see <a href="https://example.com">example.com</a> with <a href="https://bsky.app/profile/did:plc:bob">@bob</a> <a href="https://bsky.app/hashtag/tag">#tag</a></p>`,
+		},
+		{
+			name:      "out of order",
+			text:      "@bob #tag",
+			facets:    []types.APIFacet{testFacet("tag", 5, 9), testFacet("mention", 0, 4)},
+			maxFacets: 100,
+			want:      `<p><a href="https://bsky.app/profile/did:plc:bob">@bob</a> <a href="https://bsky.app/hashtag/tag">#tag</a></p>`,
+		},
+		{
+			// Byte offsets, not runes
+			name:      "multibyte",
+			text:      "héllo 🩷 @bob",
+			facets:    []types.APIFacet{testFacet("mention", 12, 16)},
+			maxFacets: 100,
+			want:      `<p>héllo 🩷 <a href="https://bsky.app/profile/did:plc:bob">@bob</a></p>`,
+		},
+		{
+			name:      "capped",
+			text:      "@bob @bob @bob",
+			facets:    []types.APIFacet{testFacet("mention", 0, 4), testFacet("mention", 5, 9), testFacet("mention", 10, 14)},
+			maxFacets: 2,
+			want:      `<p><a href="https://bsky.app/profile/did:plc:bob">@bob</a> <a href="https://bsky.app/profile/did:plc:bob">@bob</a> @bob</p>`,
+		},
+		{
+			// The first ones given, not the first ones in the text
+			name:      "capped before sorting",
+			text:      "@bob @bob",
+			facets:    []types.APIFacet{testFacet("mention", 5, 9), testFacet("mention", 0, 4)},
+			maxFacets: 1,
+			want:      `<p>@bob <a href="https://bsky.app/profile/did:plc:bob">@bob</a></p>`,
+		},
+		{name: "too many", text: manyText, facets: manyFacets, maxFacets: 100, wantLinks: 100},
+		{
+			name:      "past the end",
+			text:      "@bob",
+			facets:    []types.APIFacet{testFacet("mention", 0, 40)},
+			maxFacets: 100,
+			want:      "<p>@bob</p>",
+		},
+		{
+			name:      "overlapping",
+			text:      "@bob #tag",
+			facets:    []types.APIFacet{testFacet("mention", 0, 6), testFacet("tag", 5, 9)},
+			maxFacets: 100,
+			want:      `<p><a href="https://bsky.app/profile/did:plc:bob">@bob #</a>tag</p>`,
+		},
+		{
+			name:      "backwards",
+			text:      "@bob",
+			facets:    []types.APIFacet{testFacet("mention", 4, 0)},
+			maxFacets: 100,
+			want:      "<p>@bob</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := testHandlerPass()
+			ps.MaxFacets = tt.maxFacets
+
+			got := ps.richText(tt.text, tt.facets)
+
+			if tt.wantLinks > 0 {
+				if links := strings.Count(got, "<a "); links != tt.wantLinks {
+					t.Errorf("got %d links, want %d", links, tt.wantLinks)
+				}
+
+				// Everything past the cap is still there, as plain text
+				if want := tt.text[tt.wantLinks:] + "</p>"; !strings.HasSuffix(got, want) {
+					t.Errorf("the text after the first %d letters isn't left as it was", tt.wantLinks)
+				}
+
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("richText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
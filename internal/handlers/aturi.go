@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// at://<did or handle>/<collection>/<rkey>, the collection decides which page it is and under what name the rkey goes
+var atURICollections = map[string]struct {
+	rkeyName string
+	handler  func(*HandlerPass, http.ResponseWriter, *http.Request)
+}{
+	"app.bsky.feed.post":         {"postID", (*HandlerPass).GetPost},
+	"app.bsky.feed.generator":    {"feedID", (*HandlerPass).GetFeed},
+	"app.bsky.graph.list":        {"listID", (*HandlerPass).GetList},
+	"app.bsky.graph.starterpack": {"packID", (*HandlerPass).GetPack},
+}
+
+// Pasted AT-URIs (/at/at://did:plc:.../app.bsky.feed.post/...) are handled like the bsky.app link they stand for
+func (ps *HandlerPass) GetATURI(w http.ResponseWriter, r *http.Request) {
+	// The mux cleans at:// down to at:/, and the scheme may be left out entirely
+	atURI := strings.TrimLeft(strings.TrimPrefix(r.PathValue("atURI"), "at:"), "/")
+
+	segments := strings.Split(atURI, "/")
+	if segments[0] == "" || len(segments) > 3 {
+		ErrorPage(w, pageErrorf(ErrBadInput, "getATURI: Expected at://<did or handle>/<collection>/<rkey>"))
+		return
+	}
+
+	r.SetPathValue("profileID", segments[0])
+
+	// Just the account, or its profile record (always rkey self)
+	if len(segments) == 1 || segments[1] == "app.bsky.actor.profile" {
+		ps.GetProfile(w, r)
+		return
+	}
+
+	collection, ok := atURICollections[segments[1]]
+	if !ok {
+		ErrorPage(w, pageErrorf(ErrBadInput, "getATURI: Unknown collection %q, it should be one of app.bsky.feed.post, app.bsky.feed.generator, app.bsky.graph.list, app.bsky.graph.starterpack, app.bsky.actor.profile", segments[1]))
+		return
+	}
+
+	if len(segments) < 3 || segments[2] == "" {
+		ErrorPage(w, pageErrorf(ErrBadInput, "getATURI: No record key after %s", segments[1]))
+		return
+	}
+
+	r.SetPathValue(collection.rkeyName, segments[2])
+	collection.handler(ps, w, r)
+}
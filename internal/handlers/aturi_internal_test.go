@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetATURI(t *testing.T) {
+	fixtures := map[string]string{
+		"/xrpc/app.bsky.actor.getProfile":      "profile-banner.json",
+		"/xrpc/app.bsky.feed.getPostThread":    "thread-single-image.json",
+		"/xrpc/app.bsky.feed.getFeedGenerator": "feed-online.json",
+		"/xrpc/app.bsky.graph.getList":         "list.json",
+		"/xrpc/app.bsky.graph.getStarterPack":  "pack.json",
+	}
+
+	bodies := map[string][]byte{"/did:plc:abc": []byte("{}")}
+	for path, name := range fixtures {
+		body, readErr := os.ReadFile(filepath.Join("testdata", name))
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+
+		bodies[path] = body
+	}
+
+	tests := []struct {
+		name string
+		path string
+		// Empty if it shouldn't get to Bluesky at all
+		wantEndpoint string
+		// What the page asked Bluesky for
+		wantParam, wantValue string
+		wantStatus           int
+	}{
+		{
+			name:         "post",
+			path:         "/at/at://did:plc:abc/app.bsky.feed.post/3kpost",
+			wantEndpoint: "/xrpc/app.bsky.feed.getPostThread",
+			wantParam:    "uri", wantValue: "at://did:plc:abc/app.bsky.feed.post/3kpost",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "without the scheme",
+			path:         "/at/did:plc:abc/app.bsky.feed.post/3kpost",
+			wantEndpoint: "/xrpc/app.bsky.feed.getPostThread",
+			wantParam:    "uri", wantValue: "at://did:plc:abc/app.bsky.feed.post/3kpost",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "feed",
+			path:         "/at/at://did:plc:abc/app.bsky.feed.generator/cats",
+			wantEndpoint: "/xrpc/app.bsky.feed.getFeedGenerator",
+			wantParam:    "feed", wantValue: "at://did:plc:abc/app.bsky.feed.generator/cats",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "list",
+			path:         "/at/at://did:plc:abc/app.bsky.graph.list/3klist",
+			wantEndpoint: "/xrpc/app.bsky.graph.getList",
+			wantParam:    "list", wantValue: "at://did:plc:abc/app.bsky.graph.list/3klist",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "starter pack",
+			path:         "/at/at://did:plc:abc/app.bsky.graph.starterpack/3kpack",
+			wantEndpoint: "/xrpc/app.bsky.graph.getStarterPack",
+			wantParam:    "starterPack", wantValue: "at://did:plc:abc/app.bsky.graph.starterpack/3kpack",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "profile record",
+			path:         "/at/at://did:plc:abc/app.bsky.actor.profile/self",
+			wantEndpoint: "/xrpc/app.bsky.actor.getProfile",
+			wantParam:    "actor", wantValue: "did:plc:abc",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "just the account",
+			path:         "/at/at://did:plc:abc",
+			wantEndpoint: "/xrpc/app.bsky.actor.getProfile",
+			wantParam:    "actor", wantValue: "did:plc:abc",
+			wantStatus: http.StatusOK,
+		},
+		{name: "unknown collection", path: "/at/at://did:plc:abc/app.bsky.feed.like/3klike", wantStatus: http.StatusBadRequest},
+		{name: "no record key", path: "/at/at://did:plc:abc/app.bsky.feed.post", wantStatus: http.StatusBadRequest},
+		{name: "empty record key", path: "/at/at://did:plc:abc/app.bsky.feed.post/", wantStatus: http.StatusBadRequest},
+		{name: "too many segments", path: "/at/at://did:plc:abc/app.bsky.feed.post/3kpost/extra", wantStatus: http.StatusBadRequest},
+		{name: "nothing", path: "/at/at://", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu        sync.Mutex
+				requested []*url.URL
+			)
+
+			stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+				body, found := bodies[r.URL.Path]
+				if !found {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				mu.Lock()
+				requested = append(requested, r.URL)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(body)
+			})
+
+			// Through a mux like main's, it's the one that cleans at:// down to at:/
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /at/{atURI...}", testHandlerPass().GetATURI)
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test"+tt.path, http.NoBody))
+
+			// The mux redirects to the cleaned path first
+			if location := recorder.Header().Get("Location"); recorder.Code == http.StatusTemporaryRedirect {
+				recorder = httptest.NewRecorder()
+				mux.ServeHTTP(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test"+location, http.NoBody))
+			}
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d:\n%s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			var endpoints []string
+			for _, u := range requested {
+				if u.Path != "/did:plc:abc" {
+					endpoints = append(endpoints, u.Path)
+				}
+			}
+
+			if tt.wantEndpoint == "" {
+				if len(endpoints) > 0 {
+					t.Errorf("asked Bluesky for %q, want nothing", endpoints)
+				}
+
+				return
+			}
+
+			i := slices.IndexFunc(requested, func(u *url.URL) bool { return u.Path == tt.wantEndpoint })
+			if i == -1 {
+				t.Fatalf("asked Bluesky for %q, want %s", endpoints, tt.wantEndpoint)
+			}
+
+			if got := requested[i].Query().Get(tt.wantParam); got != tt.wantValue {
+				t.Errorf("%s = %q, want %q", tt.wantParam, got, tt.wantValue)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package handlers
+
+// Profiles and creators without an avatar get FALLBACK_AVATAR instead, if it's set (otherwise there's just no image)
+func (ps *HandlerPass) avatarOrFallback(avatar string) string {
+	if avatar == "" {
+		return ps.FallbackAvatar
+	}
+
+	return avatar
+}
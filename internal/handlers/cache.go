@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"main/internal/helpers"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type (
+	cacheEntry struct {
+		status    int
+		header    http.Header
+		body      []byte
+		expiresAt time.Time
+		// Can still be served after expiresAt if the upstream is having problems
+		staleUntil time.Time
+	}
+
+	// Keeps a copy of the response so it can be cached.
+	// With w set it's passed through as it's written, without it everything is held back (there's a stale copy to fall back on)
+	cacheRecorder struct {
+		w      http.ResponseWriter
+		header http.Header
+
+		status   int
+		body     bytes.Buffer
+		tooLarge bool
+	}
+)
+
+var (
+	responseCacheMu    sync.Mutex
+	responseCache      = make(map[string]cacheEntry)
+	responseCacheBytes int
+
+	// Requests for an expired entry that's already being fetched again wait for that, instead of asking the upstream too
+	revalidations singleflight.Group
+)
+
+func (rec *cacheRecorder) Header() http.Header {
+	if rec.w != nil {
+		return rec.w.Header()
+	}
+
+	return rec.header
+}
+
+func (rec *cacheRecorder) WriteHeader(status int) {
+	rec.status = status
+
+	if rec.w != nil {
+		rec.w.WriteHeader(status)
+	}
+}
+
+func (rec *cacheRecorder) Write(data []byte) (int, error) {
+	// Held back responses have to be kept whole, they just won't be cached if they're too big
+	if rec.w == nil {
+		rec.tooLarge = rec.tooLarge || rec.body.Len()+len(data) > maxCacheEntryLen
+		return rec.body.Write(data)
+	}
+
+	if !rec.tooLarge {
+		if rec.body.Len()+len(data) > maxCacheEntryLen {
+			rec.tooLarge = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(data)
+		}
+	}
+
+	return rec.w.Write(data)
+}
+
+// Error pages are sent with no-store, so this covers those as well as actual server errors.
+// Ones with a 4xx status (a deleted post) are an answer, not a failure, the stale copy shouldn't outlive them
+func (rec *cacheRecorder) failed() bool {
+	if rec.status >= http.StatusBadRequest && rec.status < http.StatusInternalServerError {
+		return false
+	}
+
+	return rec.status >= http.StatusInternalServerError || strings.Contains(rec.Header().Get("Cache-Control"), "no-store")
+}
+
+// Redirects are cached too, since they needed the API as well
+func (rec *cacheRecorder) cacheable() bool {
+	return !rec.tooLarge && !rec.failed() && (rec.status == http.StatusOK || rec.status == http.StatusFound)
+}
+
+// Caches successful responses for as long as the operator set for this kind of content (profiles change more often than posts)
+func (ps *HandlerPass) Cached(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Debugged requests have to actually reach the upstream, logging everything (DebugAll) doesn't turn the cache off though
+		ttl := ps.CacheTTLs[kind]
+		if ttl <= 0 || helpers.IsDebugRequest(r.Context()) {
+			next(w, r)
+			return
+		}
+
+		// Crawlers get different tags, descriptions depend on the language, and links depend on how we were reached
+		key := helpers.BaseURL(r, ps.TrustForwarded) + cacheKeyPath(r.URL) + "|" + detectCrawler(r.Header.Get("User-Agent")) + "|" + ps.requestLanguage(r).String()
+
+		entry, fresh, found := getCachedResponse(key)
+		if found && fresh {
+			writeCachedResponse(w, r, entry, "HIT")
+			return
+		}
+
+		if found {
+			// There's an expired copy, try for a new one first, but fall back on the old one if the upstream is having problems
+			rec, ok := ps.revalidate(key, ttl, next, r)
+			if !ok {
+				w.Header().Set("Warning", `110 - "Response is Stale"`)
+				writeCachedResponse(w, r, entry, "STALE")
+				return
+			}
+
+			writeCachedResponse(w, r, cacheEntry{status: rec.status, header: rec.header, body: rec.body.Bytes()}, "MISS")
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+
+		rec := &cacheRecorder{w: w, status: http.StatusOK}
+		next(rec, r)
+
+		ps.storeCachedResponse(key, rec, ttl)
+	}
+}
+
+// Only for the HTML pages, API responses and images keep their own headers
+func (ps *HandlerPass) setPageCacheControl(w http.ResponseWriter, kind string) {
+	w.Header().Set("Cache-Control", cmp.Or(ps.PageCacheControl[kind], "no-cache"))
+}
+
+// Gets a new copy of an expired entry, once per key at a time, however many requests are waiting on it.
+// It isn't tied to the request that started it, if that one stops waiting (and gets the stale copy) it still finishes in the background.
+// Not ok if it failed, or r stopped waiting first
+func (ps *HandlerPass) revalidate(key string, ttl time.Duration, next http.HandlerFunc, r *http.Request) (*cacheRecorder, bool) {
+	resultChan := revalidations.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), revalidateTimeout)
+		defer cancel()
+
+		// The response is shared, so the validators are left to writeCachedResponse, for each request
+		req := r.Clone(ctx)
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+
+		rec := &cacheRecorder{header: make(http.Header), status: http.StatusOK}
+		next(rec, req)
+
+		ps.storeCachedResponse(key, rec, ttl)
+
+		return rec, nil
+	})
+
+	select {
+	case <-r.Context().Done():
+		return nil, false
+	case result := <-resultChan:
+		rec, ok := result.Val.(*cacheRecorder)
+
+		return rec, ok && !rec.failed()
+	}
+}
+
+// The handler never sees a request that's answered from the cache, so the validators it left behind (see thumbNotModified) are checked here
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, entry cacheEntry, cacheStatus string) {
+	for k, v := range entry.header {
+		w.Header()[k] = v
+	}
+
+	w.Header().Set("X-Cache", cacheStatus)
+
+	if notModified(r, entry.header) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+// Like net/http's checks for ServeContent: If-None-Match wins, If-Modified-Since only counts without it
+func notModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		eTag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if eTag == "" {
+			return false
+		}
+
+		for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == eTag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	lastModified, lastErr := http.ParseTime(header.Get("Last-Modified"))
+	if lastErr != nil {
+		return false
+	}
+
+	ifModifiedSince, sinceErr := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if sinceErr != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+func (ps *HandlerPass) storeCachedResponse(key string, rec *cacheRecorder, ttl time.Duration) {
+	if !rec.cacheable() {
+		return
+	}
+
+	header := rec.Header().Clone()
+	header.Del("X-Cache")
+	header.Del("Server-Timing")
+
+	now := time.Now()
+	putCachedResponse(key, cacheEntry{
+		status:     rec.status,
+		header:     header,
+		body:       bytes.Clone(rec.body.Bytes()),
+		expiresAt:  now.Add(ttl),
+		staleUntil: now.Add(ttl + ps.CacheStaleTTL),
+	})
+}
+
+// Expired entries are still returned (fresh = false) until they're too stale to use
+func getCachedResponse(key string) (cacheEntry, bool, bool) {
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+
+	entry, ok := responseCache[key]
+	if !ok {
+		return cacheEntry{}, false, false
+	}
+
+	now := time.Now()
+	if now.After(entry.staleUntil) {
+		responseCacheBytes -= len(entry.body)
+		delete(responseCache, key)
+		return cacheEntry{}, false, false
+	}
+
+	return entry, !now.After(entry.expiresAt), true
+}
+
+func putCachedResponse(key string, entry cacheEntry) {
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+
+	if old, ok := responseCache[key]; ok {
+		responseCacheBytes -= len(old.body)
+		delete(responseCache, key)
+	}
+
+	// Don't let this grow forever, drop the unusable ones first, and everything if that wasn't enough
+	if len(responseCache) >= maxCacheEntries || responseCacheBytes+len(entry.body) > maxCacheBytes {
+		now := time.Now()
+		for k, v := range responseCache {
+			if now.After(v.staleUntil) {
+				responseCacheBytes -= len(v.body)
+				delete(responseCache, k)
+			}
+		}
+
+		if len(responseCache) >= maxCacheEntries || responseCacheBytes+len(entry.body) > maxCacheBytes {
+			clear(responseCache)
+			responseCacheBytes = 0
+		}
+	}
+
+	responseCache[key] = entry
+	responseCacheBytes += len(entry.body)
+}
+
+// Paths carry handles, which can be composed or decomposed (NFC or NFD) and still be the same one
+func cacheKeyPath(u *url.URL) string {
+	path := helpers.NormalizeHandle(u.Path)
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	return path
+}
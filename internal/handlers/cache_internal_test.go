@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"cmp"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"main/internal/helpers"
+)
+
+func TestCachedConditionalRequests(t *testing.T) {
+	t.Parallel()
+
+	const thumbURL = "https://cdn.example.test/thumb.jpg"
+
+	ps := testHandlerPass()
+	ps.CacheTTLs = map[string]time.Duration{CachePost: time.Minute}
+
+	var calls int
+	handler := ps.Cached(CachePost, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if thumbNotModified(w, r, thumbURL) {
+			return
+		}
+
+		http.Redirect(w, r, thumbURL, http.StatusFound)
+	})
+
+	request := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/"+t.Name(), http.NoBody)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+
+		return recorder
+	}
+
+	// Fills the cache, the validators come with it
+	first := request("", "")
+	eTag := first.Header().Get("ETag")
+	if first.Code != http.StatusFound || eTag == "" {
+		t.Fatalf("got status %d with ETag %q, want %d with one", first.Code, eTag, http.StatusFound)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{name: "no validator", want: http.StatusFound},
+		{name: "matching ETag", header: "If-None-Match", value: eTag, want: http.StatusNotModified},
+		{name: "one of several", header: "If-None-Match", value: `"other", W/` + eTag, want: http.StatusNotModified},
+		{name: "any", header: "If-None-Match", value: "*", want: http.StatusNotModified},
+		{name: "other ETag", header: "If-None-Match", value: `"other"`, want: http.StatusFound},
+		{name: "not modified since", header: "If-Modified-Since", value: time.Now().UTC().Format(http.TimeFormat), want: http.StatusNotModified},
+		{name: "modified since", header: "If-Modified-Since", value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: http.StatusFound},
+	}
+
+	// Sequential, they share the handler (and its cache entry)
+	for _, test := range tests {
+		recorder := request(test.header, test.value)
+
+		if recorder.Code != test.want || recorder.Header().Get("X-Cache") != "HIT" {
+			t.Errorf("%s: got status %d (X-Cache %s), want %d from the cache", test.name, recorder.Code, recorder.Header().Get("X-Cache"), test.want)
+		}
+
+		if test.want == http.StatusNotModified && (recorder.Body.Len() != 0 || recorder.Header().Get("ETag") != eTag) {
+			t.Errorf("%s: got a %d byte body with ETag %q, want no body and %q", test.name, recorder.Body.Len(), recorder.Header().Get("ETag"), eTag)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("the handler ran %d times, want once", calls)
+	}
+}
+
+//nolint:paralleltest // Sets helpers.DebugAll
+func TestCachedDebug(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		token    string
+		debugAll bool
+		// How often the handler runs for two requests
+		wantCalls int
+	}{
+		{name: "not debugged", wantCalls: 1},
+		{name: "debugged", query: "?debug=1", token: "secret", wantCalls: 2},
+		{name: "wrong token", query: "?debug=1", token: "guess", wantCalls: 1},
+		{name: "no token", query: "?debug=1", wantCalls: 1},
+		{name: "logging everything", debugAll: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			helpers.DebugAll = tt.debugAll
+			t.Cleanup(func() { helpers.DebugAll = false })
+
+			ps := testHandlerPass()
+			ps.DebugToken = "secret"
+			ps.CacheTTLs = map[string]time.Duration{CachePost: time.Minute}
+
+			var calls int
+			handler := ps.Debug(ps.Cached(CachePost, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Write([]byte("post"))
+			}))
+
+			for range 2 {
+				req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/"+t.Name()+tt.query, http.NoBody)
+				if tt.token != "" {
+					req.Header.Set("X-Debug-Token", tt.token)
+				}
+
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("the handler ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCachedServesStale(t *testing.T) {
+	t.Parallel()
+
+	ps := testHandlerPass()
+	// Expired right away, but usable for a minute more
+	ps.CacheTTLs = map[string]time.Duration{CachePost: time.Nanosecond}
+	ps.CacheStaleTTL = time.Minute
+
+	var upstream http.HandlerFunc
+	handler := ps.Cached(CachePost, func(w http.ResponseWriter, r *http.Request) {
+		upstream(w, r)
+	})
+
+	answer := func(status int, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}
+	}
+
+	tests := []struct {
+		name       string
+		upstream   http.HandlerFunc
+		wantStatus int
+		wantBody   string
+		wantCache  string
+	}{
+		{name: "fills the cache", upstream: answer(http.StatusOK, "first"), wantStatus: http.StatusOK, wantBody: "first", wantCache: "MISS"},
+		{name: "server error", upstream: answer(http.StatusBadGateway, "down"), wantStatus: http.StatusOK, wantBody: "first", wantCache: "STALE"},
+		{
+			name: "error page",
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				ErrorPage(w, pageErrorf(ErrTimeout, "getPost: Timed out"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "first",
+			wantCache:  "STALE",
+		},
+		{name: "recovered", upstream: answer(http.StatusOK, "second"), wantStatus: http.StatusOK, wantBody: "second", wantCache: "MISS"},
+		{name: "fails again", upstream: answer(http.StatusInternalServerError, "down"), wantStatus: http.StatusOK, wantBody: "second", wantCache: "STALE"},
+		// An answer, the post is gone
+		{name: "not found", upstream: answer(http.StatusNotFound, "gone"), wantStatus: http.StatusNotFound, wantBody: "gone", wantCache: "MISS"},
+	}
+
+	// Sequential, every step builds on the cache entry the ones before left
+	for _, test := range tests {
+		upstream = test.upstream
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/"+t.Name(), http.NoBody))
+
+		if recorder.Code != test.wantStatus || recorder.Body.String() != test.wantBody || recorder.Header().Get("X-Cache") != test.wantCache {
+			t.Errorf("%s: got %d %q (X-Cache %s), want %d %q (X-Cache %s)", test.name, recorder.Code, recorder.Body, recorder.Header().Get("X-Cache"), test.wantStatus, test.wantBody, test.wantCache)
+		}
+
+		if isStale := recorder.Header().Get("Warning") != ""; isStale != (test.wantCache == "STALE") {
+			t.Errorf("%s: got Warning %q", test.name, recorder.Header().Get("Warning"))
+		}
+	}
+}
+
+// Everyone asking for an expired entry at the same time waits on the same upstream request, and gets the stale copy if it fails
+func TestCachedRevalidatesOnce(t *testing.T) {
+	t.Parallel()
+
+	const callers = 20
+
+	ps := testHandlerPass()
+	ps.CacheTTLs = map[string]time.Duration{CachePost: time.Nanosecond}
+	ps.CacheStaleTTL = time.Minute
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := ps.Cached(CachePost, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Write([]byte("first"))
+			return
+		}
+
+		<-release
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	target := "https://example.test/" + t.Name()
+
+	// Fills the cache
+	handler(httptest.NewRecorder(), httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, http.NoBody))
+
+	var done sync.WaitGroup
+	for range callers {
+		done.Go(func() {
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, http.NoBody))
+
+			if recorder.Body.String() != "first" || recorder.Header().Get("X-Cache") != "STALE" {
+				t.Errorf("got %q (X-Cache %s), want the stale copy", recorder.Body, recorder.Header().Get("X-Cache"))
+			}
+		})
+	}
+
+	// The upstream holds its answer until everyone had the time to join the revalidation that's already going
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	// Once to fill the cache, once to revalidate
+	if got := calls.Load(); got != 2 {
+		t.Errorf("the handler ran %d times, want twice", got)
+	}
+}
+
+func TestCachedTTLPerKind(t *testing.T) {
+	t.Parallel()
+
+	ps := testHandlerPass()
+	ps.CacheStaleTTL = time.Hour
+	ps.CacheTTLs = map[string]time.Duration{
+		CacheProfile: time.Minute,
+		CachePost:    5 * time.Minute,
+		CacheFeed:    10 * time.Minute,
+		CacheList:    20 * time.Minute,
+		CachePack:    40 * time.Minute,
+		// Off for this one
+		"disabled": 0,
+	}
+
+	tests := []struct {
+		kind string
+		// 0 if it shouldn't be cached at all
+		wantTTL time.Duration
+	}{
+		{kind: CacheProfile, wantTTL: time.Minute},
+		{kind: CachePost, wantTTL: 5 * time.Minute},
+		{kind: CacheFeed, wantTTL: 10 * time.Minute},
+		{kind: CacheList, wantTTL: 20 * time.Minute},
+		{kind: CachePack, wantTTL: 40 * time.Minute},
+		{kind: "disabled"},
+		{kind: "unknown"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			t.Parallel()
+
+			path := "/" + t.Name()
+			handler := ps.Cached(test.kind, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(test.kind))
+			})
+
+			before := time.Now()
+			handler(httptest.NewRecorder(), httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test"+path, http.NoBody))
+			after := time.Now()
+
+			var (
+				entry cacheEntry
+				found bool
+			)
+
+			responseCacheMu.Lock()
+			for key, v := range responseCache {
+				if strings.HasPrefix(key, "https://example.test"+path+"|") {
+					entry, found = v, true
+				}
+			}
+			responseCacheMu.Unlock()
+
+			if test.wantTTL == 0 {
+				if found {
+					t.Errorf("got a cache entry, want none")
+				}
+
+				return
+			}
+
+			if !found {
+				t.Fatal("no cache entry")
+			}
+
+			if entry.expiresAt.Before(before.Add(test.wantTTL)) || entry.expiresAt.After(after.Add(test.wantTTL)) {
+				t.Errorf("expires in %s, want %s", entry.expiresAt.Sub(before), test.wantTTL)
+			}
+
+			if got := entry.staleUntil.Sub(entry.expiresAt); got != ps.CacheStaleTTL {
+				t.Errorf("usable for %s after expiring, want %s", got, ps.CacheStaleTTL)
+			}
+		})
+	}
+}
+
+// The same handle, composed (NFC) or decomposed (NFD), and percent-encoded or not, is one cache entry
+func TestCachedNormalizedPaths(t *testing.T) {
+	t.Parallel()
+
+	ps := testHandlerPass()
+	ps.CacheTTLs = map[string]time.Duration{CacheProfile: time.Minute}
+
+	var calls atomic.Int32
+	handler := ps.Cached(CacheProfile, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte("profile"))
+	})
+
+	base := "https://example.test/" + t.Name() + "/profile/"
+
+	tests := []struct {
+		name      string
+		target    string
+		wantCache string
+	}{
+		{name: "composed", target: base + "caf\u00e9.test", wantCache: "MISS"},
+		{name: "decomposed", target: base + "cafe\u0301.test", wantCache: "HIT"},
+		{name: "composed, encoded", target: base + "caf%C3%A9.test", wantCache: "HIT"},
+		{name: "decomposed, encoded", target: base + "cafe%CC%81.test", wantCache: "HIT"},
+		{name: "another handle", target: base + "cafe.test", wantCache: "MISS"},
+	}
+
+	// Sequential, the first one fills the cache for the others
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, test.target, http.NoBody))
+
+		if got := recorder.Header().Get("X-Cache"); got != test.wantCache {
+			t.Errorf("%s: X-Cache = %s, want %s", test.name, got, test.wantCache)
+		}
+	}
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("the handler ran %d times, want twice", got)
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestPageCacheControl(t *testing.T) {
+	fixtures := map[string]string{
+		"/xrpc/app.bsky.actor.getProfile":      "profile-banner.json",
+		"/xrpc/app.bsky.feed.getPostThread":    "thread-single-image.json",
+		"/xrpc/app.bsky.feed.getFeedGenerator": "feed-online.json",
+		"/xrpc/app.bsky.graph.getList":         "list.json",
+		"/xrpc/app.bsky.graph.getStarterPack":  "pack.json",
+	}
+
+	bodies := map[string][]byte{"/did:plc:abc": []byte("{}")}
+	for path, name := range fixtures {
+		body, readErr := os.ReadFile(filepath.Join("testdata", name))
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+
+		bodies[path] = body
+	}
+
+	stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, found := bodies[r.URL.Path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+
+	configured := map[string]string{
+		CacheProfile: "public, max-age=30",
+		CachePost:    "public, max-age=60",
+		CacheFeed:    "private, max-age=120",
+		CacheList:    "no-store",
+		CachePack:    "public, max-age=600",
+	}
+
+	tests := []struct {
+		kind    string
+		path    string
+		values  map[string]string
+		handler func(ps *HandlerPass) http.HandlerFunc
+	}{
+		{kind: CacheProfile, path: "/profile/did:plc:abc", values: map[string]string{"profileID": "did:plc:abc"}, handler: func(ps *HandlerPass) http.HandlerFunc { return ps.GetProfile }},
+		{kind: CachePost, path: "/profile/did:plc:abc/post/3kpost", values: map[string]string{"profileID": "did:plc:abc", "postID": "3kpost"}, handler: func(ps *HandlerPass) http.HandlerFunc { return ps.GetPost }},
+		{kind: CacheFeed, path: "/profile/did:plc:abc/feed/cats", values: map[string]string{"profileID": "did:plc:abc", "feedID": "cats"}, handler: func(ps *HandlerPass) http.HandlerFunc { return ps.GetFeed }},
+		{kind: CacheList, path: "/profile/did:plc:abc/lists/3klist", values: map[string]string{"profileID": "did:plc:abc", "listID": "3klist"}, handler: func(ps *HandlerPass) http.HandlerFunc { return ps.GetList }},
+		{kind: CachePack, path: "/starter-pack/did:plc:abc/3kpack", values: map[string]string{"profileID": "did:plc:abc", "packID": "3kpack"}, handler: func(ps *HandlerPass) http.HandlerFunc { return ps.GetPack }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			// Its own header when it's set, no-cache otherwise (even if the other pages have one)
+			for _, pageCacheControl := range []map[string]string{configured, nil, {"unknown": "public, max-age=60"}} {
+				ps := testHandlerPass()
+				ps.PageCacheControl = pageCacheControl
+
+				req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test"+test.path, http.NoBody)
+				for name, value := range test.values {
+					req.SetPathValue(name, value)
+				}
+
+				recorder := httptest.NewRecorder()
+				test.handler(ps)(recorder, req)
+
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d", recorder.Code)
+				}
+
+				want := cmp.Or(pageCacheControl[test.kind], "no-cache")
+				if got := recorder.Header().Get("Cache-Control"); got != want {
+					t.Errorf("Cache-Control = %q with %v, want %q", got, pageCacheControl, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"main/internal/helpers"
+)
+
+// How well the API cache is doing, only on the api. subdomain
+func GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Host, "api.") {
+		ErrorPage(w, pageErrorf(ErrNotFound, "Route not found"))
+		return
+	}
+
+	stats := helpers.GetAPICacheStats()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if encodeErr := json.NewEncoder(w).Encode(&stats); encodeErr != nil {
+		ErrorJSON(w, pageErrorf(ErrInternal, "getCacheStats: Failed to encode JSON"))
+		return
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	// Decoders for image.Decode, the CDN is asked for jpegs but other hosts may give us either
+	_ "image/png"
+
+	"main/internal/helpers"
+	"main/internal/types"
+)
+
+// Same layouts as ffmpeg (horizontal, vertical, grid), for hosts without it. Only jpeg comes out, and watermarks are left off since there are no fonts
+func composeMosaic(ctx context.Context, images types.APIImages, layout string, cellWidth, cellHeight int, opts mosaicOptions) ([]byte, error) {
+	key := []string{"compose", layout, strconv.Itoa(cellWidth), strconv.Itoa(cellHeight), strconv.Itoa(opts.Gap), strconv.Itoa(opts.SeparatorWidth), opts.SeparatorColor, strconv.FormatBool(opts.Crop), strconv.Itoa(opts.Quality)}
+	for _, k := range images {
+		key = append(key, k.FullSize, strconv.FormatBool(isSensitiveImage(k.Labels)))
+	}
+
+	return sharedMosaic(ctx, mosaicCacheKey(key), opts, func(runCtx context.Context) ([]byte, error) {
+		decoded, fetchErr := fetchMosaicImages(runCtx, images)
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+
+		canvas := layoutMosaic(decoded, images, layout, cellWidth, cellHeight, opts)
+
+		var output bytes.Buffer
+		if encodeErr := jpeg.Encode(&output, canvas, &jpeg.Options{Quality: opts.Quality}); encodeErr != nil {
+			return nil, encodeErr
+		}
+
+		return output.Bytes(), nil
+	})
+}
+
+// All at once, every one of them has to be there (ffmpeg fails on a missing one too)
+func fetchMosaicImages(ctx context.Context, images types.APIImages) ([]*image.RGBA, error) {
+	decoded := make([]*image.RGBA, len(images))
+	fetchErrs := make([]error, len(images))
+
+	var wg sync.WaitGroup
+	for i, k := range images {
+		wg.Go(func() {
+			decoded[i], fetchErrs[i] = fetchMosaicImage(ctx, cdnFormat(k.FullSize, "jpeg"))
+		})
+	}
+
+	wg.Wait()
+
+	return decoded, errors.Join(fetchErrs...)
+}
+
+func fetchMosaicImage(ctx context.Context, imageURL string) (*image.RGBA, error) {
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, http.NoBody)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+
+	resp, respErr := helpers.TimeoutClient.Do(req)
+	if respErr != nil {
+		return nil, respErr
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status (%s)", resp.Status)
+	}
+
+	img, _, decodeErr := image.Decode(io.LimitReader(resp.Body, helpers.MaxReadLimit))
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	// Plain RGBA from here on, so scaling can read the pixels directly
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	return rgba, nil
+}
+
+// Mirrors the ffmpeg filters in GenMosaic: the spacing goes between images, with the separator in the middle of it
+func layoutMosaic(decoded []*image.RGBA, images types.APIImages, layout string, cellWidth, cellHeight int, opts mosaicOptions) *image.RGBA {
+	spacing := opts.Gap + opts.SeparatorWidth
+	separator := image.NewUniform(parseHexColor(opts.SeparatorColor))
+
+	// Every image gets its size first, the canvas follows from them
+	scaled := make([]*image.RGBA, len(decoded))
+	for i, img := range decoded {
+		width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+		switch {
+		case opts.Crop:
+			scaled[i] = fillCell(img, cellWidth, cellHeight)
+		case layout == mosaicLayoutGrid:
+			scaled[i] = fitCell(img, cellWidth, cellHeight)
+		case layout == mosaicLayoutVertical:
+			scaled[i] = scaleImage(img, cellWidth, evenSize(height*cellWidth/max(width, 1)))
+		default:
+			scaled[i] = scaleImage(img, evenSize(width*cellHeight/max(height, 1)), cellHeight)
+		}
+
+		if isSensitiveImage(images[i].Labels) {
+			scaled[i] = blurImage(scaled[i])
+		}
+	}
+
+	var canvas *image.RGBA
+
+	switch layout {
+	case mosaicLayoutGrid:
+		rows := (len(scaled) + 1) / 2
+		canvas = image.NewRGBA(image.Rect(0, 0, 2*cellWidth+spacing, rows*cellHeight+(rows-1)*spacing))
+		draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+
+		for i, img := range scaled {
+			at := image.Pt((i%2)*(cellWidth+spacing), (i/2)*(cellHeight+spacing))
+			draw.Draw(canvas, img.Bounds().Add(at), img, image.Point{}, draw.Src)
+		}
+
+		if opts.SeparatorWidth > 0 {
+			draw.Draw(canvas, image.Rect(cellWidth+opts.Gap/2, 0, cellWidth+opts.Gap/2+opts.SeparatorWidth, canvas.Bounds().Dy()), separator, image.Point{}, draw.Src)
+			draw.Draw(canvas, image.Rect(0, cellHeight+opts.Gap/2, canvas.Bounds().Dx(), cellHeight+opts.Gap/2+opts.SeparatorWidth), separator, image.Point{}, draw.Src)
+		}
+	case mosaicLayoutVertical:
+		height := (len(scaled) - 1) * spacing
+		for _, img := range scaled {
+			height += img.Bounds().Dy()
+		}
+
+		canvas = image.NewRGBA(image.Rect(0, 0, cellWidth, height))
+		draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+
+		y := 0
+		for i, img := range scaled {
+			draw.Draw(canvas, img.Bounds().Add(image.Pt(0, y)), img, image.Point{}, draw.Src)
+			y += img.Bounds().Dy()
+
+			if opts.SeparatorWidth > 0 && i < len(scaled)-1 {
+				draw.Draw(canvas, image.Rect(0, y+opts.Gap/2, cellWidth, y+opts.Gap/2+opts.SeparatorWidth), separator, image.Point{}, draw.Src)
+			}
+
+			y += spacing
+		}
+	default:
+		width := (len(scaled) - 1) * spacing
+		for _, img := range scaled {
+			width += img.Bounds().Dx()
+		}
+
+		canvas = image.NewRGBA(image.Rect(0, 0, width, cellHeight))
+		draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+
+		x := 0
+		for i, img := range scaled {
+			draw.Draw(canvas, img.Bounds().Add(image.Pt(x, 0)), img, image.Point{}, draw.Src)
+			x += img.Bounds().Dx()
+
+			if opts.SeparatorWidth > 0 && i < len(scaled)-1 {
+				draw.Draw(canvas, image.Rect(x+opts.Gap/2, 0, x+opts.Gap/2+opts.SeparatorWidth, cellHeight), separator, image.Point{}, draw.Src)
+			}
+
+			x += spacing
+		}
+	}
+
+	return canvas
+}
+
+// The whole image in the cell, with black bars (force_original_aspect_ratio=decrease and pad)
+func fitCell(img *image.RGBA, cellWidth, cellHeight int) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	scaledWidth, scaledHeight := cellWidth, height*cellWidth/max(width, 1)
+	if scaledHeight > cellHeight {
+		scaledWidth, scaledHeight = width*cellHeight/max(height, 1), cellHeight
+	}
+
+	cell := image.NewRGBA(image.Rect(0, 0, cellWidth, cellHeight))
+	draw.Draw(cell, cell.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	scaled := scaleImage(img, max(scaledWidth, 1), max(scaledHeight, 1))
+	at := image.Pt((cellWidth-scaledWidth)/2, (cellHeight-scaledHeight)/2)
+	draw.Draw(cell, scaled.Bounds().Add(at), scaled, image.Point{}, draw.Src)
+
+	return cell
+}
+
+// The cell is filled, what sticks out is cut off evenly (force_original_aspect_ratio=increase and crop)
+func fillCell(img *image.RGBA, cellWidth, cellHeight int) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	scaledWidth, scaledHeight := cellWidth, height*cellWidth/max(width, 1)
+	if scaledHeight < cellHeight {
+		scaledWidth, scaledHeight = width*cellHeight/max(height, 1), cellHeight
+	}
+
+	scaled := scaleImage(img, max(scaledWidth, cellWidth), max(scaledHeight, cellHeight))
+
+	cell := image.NewRGBA(image.Rect(0, 0, cellWidth, cellHeight))
+	from := image.Pt((scaled.Bounds().Dx()-cellWidth)/2, (scaled.Bounds().Dy()-cellHeight)/2)
+	draw.Draw(cell, cell.Bounds(), scaled, from, draw.Src)
+
+	return cell
+}
+
+// Averages the source pixels under every target pixel (or takes the nearest one when enlarging), image/draw can't scale by itself
+func scaleImage(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := range height {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+
+		for x := range width {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for p := 0; p < len(row); p += 4 {
+					sum[0] += int(row[p])
+					sum[1] += int(row[p+1])
+					sum[2] += int(row[p+2])
+					sum[3] += int(row[p+3])
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := range sum {
+				dst.Pix[offset+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+
+	return dst
+}
+
+// Scaled way down and back up, about as unrecognizable as ffmpeg's boxblur=20:5
+func blurImage(img *image.RGBA) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return scaleImage(scaleImage(img, max(width/mosaicBlurFactor, 1), max(height/mosaicBlurFactor, 1)), width, height)
+}
+
+// 0xRRGGBB (see isHexColor), anything else is black
+func parseHexColor(hexColor string) color.RGBA {
+	value, parseErr := strconv.ParseUint(strings.TrimPrefix(hexColor, "0x"), 16, 32)
+	if parseErr != nil {
+		return color.RGBA{A: 255}
+	}
+
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}
+}
+
+// Same as -2 in ffmpeg's scale, the encoders don't like odd sizes
+func evenSize(size int) int {
+	return max(size-size%2, 2)
+}
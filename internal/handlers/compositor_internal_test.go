@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"main/internal/types"
+)
+
+// Solid white, so anything else on the canvas came from the layout
+func whiteImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	return img
+}
+
+func TestLayoutMosaicDimensions(t *testing.T) {
+	t.Parallel()
+
+	// One wide and one tall image, and a square one for grids of three
+	sizes := [][2]int{{200, 100}, {100, 200}, {120, 120}}
+
+	tests := []struct {
+		name   string
+		layout string
+		count  int
+		opts   mosaicOptions
+		// Of the whole canvas
+		wantWidth, wantHeight int
+	}{
+		// 300 (wide) + 74 (tall, 75 made even)
+		{name: "horizontal", layout: mosaicLayoutHorizontal, count: 2, wantWidth: 374, wantHeight: 150},
+		{name: "horizontal with spacing", layout: mosaicLayoutHorizontal, count: 2, opts: mosaicOptions{Gap: 4, SeparatorWidth: 2}, wantWidth: 380, wantHeight: 150},
+		{name: "horizontal cropped", layout: mosaicLayoutHorizontal, count: 2, opts: mosaicOptions{Crop: true}, wantWidth: 300, wantHeight: 150},
+		{name: "vertical", layout: mosaicLayoutVertical, count: 2, wantWidth: 150, wantHeight: 374},
+		{name: "vertical with spacing", layout: mosaicLayoutVertical, count: 2, opts: mosaicOptions{Gap: 4, SeparatorWidth: 2}, wantWidth: 150, wantHeight: 380},
+		{name: "grid of two", layout: mosaicLayoutGrid, count: 2, wantWidth: 300, wantHeight: 150},
+		{name: "grid of three", layout: mosaicLayoutGrid, count: 3, opts: mosaicOptions{Gap: 4, SeparatorWidth: 2}, wantWidth: 306, wantHeight: 306},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			decoded := make([]*image.RGBA, test.count)
+			for i := range decoded {
+				decoded[i] = whiteImage(sizes[i][0], sizes[i][1])
+			}
+
+			canvas := layoutMosaic(decoded, make(types.APIImages, test.count), test.layout, 150, 150, test.opts)
+			if width, height := canvas.Bounds().Dx(), canvas.Bounds().Dy(); width != test.wantWidth || height != test.wantHeight {
+				t.Errorf("got %dx%d, want %dx%d", width, height, test.wantWidth, test.wantHeight)
+			}
+		})
+	}
+}
+
+func TestLayoutMosaicSeparator(t *testing.T) {
+	t.Parallel()
+
+	decoded := []*image.RGBA{whiteImage(150, 150), whiteImage(150, 150)}
+	opts := mosaicOptions{Gap: 4, SeparatorWidth: 2, SeparatorColor: "0xff0000"}
+
+	canvas := layoutMosaic(decoded, make(types.APIImages, 2), mosaicLayoutHorizontal, 150, 150, opts)
+
+	// The first image, half the gap, the separator, the other half and the second image
+	tests := []struct {
+		x    int
+		want color.RGBA
+	}{
+		{x: 149, want: color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{x: 151, want: color.RGBA{A: 255}},
+		{x: 152, want: color.RGBA{R: 255, A: 255}},
+		{x: 153, want: color.RGBA{R: 255, A: 255}},
+		{x: 155, want: color.RGBA{A: 255}},
+		{x: 156, want: color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+	}
+
+	for _, test := range tests {
+		if got := canvas.RGBAAt(test.x, 75); got != test.want {
+			t.Errorf("x=%d: got %v, want %v", test.x, got, test.want)
+		}
+	}
+}
@@ -1,28 +1,264 @@
 package handlers
 
+import (
+	"time"
+
+	"main/internal/types"
+)
+
 type (
 	HandlerPass struct {
 		DomainName,
 		ThemeColor,
-		IndexURL string
+		IndexURL,
+		IndexMode,
+		StatsStyle,
+		MosaicFallback,
+		APICORSOrigin,
+		DefaultLanguage,
+		HandleSource,
+		FallbackAvatar,
+		// Served as /robots.txt
+		RobotsFile,
+		// Needed for ?debug=1, empty turns it off
+		DebugToken,
+		FFmpegPath,
+		WatermarkDefault string
+
+		// How many parents to show in the description (1 = just the direct parent)
+		ReplyChainDepth,
+		// Seconds that oEmbed responses can be cached for
+		OembedMaxAge,
+		// Longest a single path segment (handle, rkey, ...) can be
+		MaxPathValueLen,
+		// Default mosaic quality (1-100), 0 means mosaicDefaultQuality
+		MosaicQuality,
+		// Facets turned into links per text, the rest stay plain text
+		MaxFacets,
+		// Finished mosaics kept in memory, 0 entries means none
+		MosaicCacheEntries,
+		MosaicCacheBytes int
+
+		// How long each kind of content is cached for (CacheProfile, CachePost, ...), 0 or missing means not at all
+		CacheTTLs map[string]time.Duration
+		// Cache-Control of each kind of page (CacheProfile, CachePost, ...), for crawlers and browsers
+		PageCacheControl map[string]string
+		// How long expired entries can still be served if the upstream is failing
+		CacheStaleTTL time.Duration
+		// Total time a request gets before it's answered with a timeout page, 0 means no limit
+		RequestTimeout,
+		// How long ffmpeg waits on connecting to (or reading from) an image host
+		MosaicInputTimeout time.Duration
+
+		EmbedFeedSample,
+		TrustForwarded,
+		EnableWatermark,
+		ProfileBanner,
+		NoIndex,
+		EnableServerTiming,
+		MosaicAnimated,
+		MosaicValidateImages,
+		MosaicOGImage,
+		CanonicalSelf,
+		QuoteTimestamps,
+		ExternalSiteName,
+		FeedStatsInDescription,
+		// Found at FFmpegPath when the server started, mosaics are composed in Go without it
+		FFmpegAvailable bool
+	}
+
+	// Template data, one per template
+	indexTemplateData struct {
+		BaseURL  string
+		PassData *HandlerPass
+	}
+
+	postTemplateData struct {
+		Data types.OwnData
+		// Nil if this isn't a reply
+		ReplyTo *replyCard
+		// Empty unless the author turned replies off
+		NoReplies string
+
+		EditedPID,
+		PostID,
+		MediaMsg,
+		EncodedID,
+		BaseURL,
+		DefaultAvatar string
+
+		PhotoNum,
+		TotalPhotos,
+		PrevPhoto,
+		NextPhoto int
+
+		IsTelegram,
+		IsSlack,
+		IsWhatsApp bool
+		PassData *HandlerPass
+	}
+
+	// The parent of a reply, shown above the post on the Telegram page
+	replyCard struct {
+		Author types.APIAuthor
+
+		Label,
+		Text,
+		Media,
+		// Empty unless the parent came with a repost reason
+		RepostedBy,
+		URL string
+	}
+
+	profileTemplateData struct {
+		Profile types.UserProfile
+
+		EncodedID,
+		BaseURL string
+
+		IsTelegram bool
+		PassData   *HandlerPass
+	}
+
+	feedTemplateData struct {
+		Feed types.APIFeed
+
+		FeedID,
+		Stats,
+		EncodedID,
+		BaseURL string
+
+		IsTelegram bool
+		PassData   *HandlerPass
+	}
+
+	listTemplateData struct {
+		List types.APIListView
+
+		ListID,
+		EncodedID,
+		BaseURL,
+		// The member count in notation (12.3K), in the reader's language
+		Members string
+
+		IsTelegram,
+		// Enough members with avatars for the mosaic to be the image
+		MemberMosaic bool
+		PassData *HandlerPass
+	}
+
+	packTemplateData struct {
+		Pack types.APIStarterPackView
+
+		PackID,
+		PackCard,
+		EncodedID,
+		BaseURL string
+
+		IsTelegram bool
+		PassData   *HandlerPass
 	}
 )
 
 const (
-	maxAuthorLen = 256
-	ellipsisLen  = 3
-
-	bskyEmbedImages    = "app.bsky.embed.images#view"
-	galleryImages      = "app.bsky.embed.gallery#view"
-	bskyEmbedExternal  = "app.bsky.embed.external#view"
-	bskyEmbedVideo     = "app.bsky.embed.video#view"
-	bskyEmbedQuote     = "app.bsky.embed.recordWithMedia#view"
-	bskyEmbedText      = "app.bsky.embed.record#view"
-	bskyEmbedTextQuote = "app.bsky.embed.record#viewRecord"
-	bskyEmbedList      = "app.bsky.graph.defs#listView"
-	bskyEmbedFeed      = "app.bsky.feed.defs#generatorView"
-	bskyEmbedPack      = "app.bsky.graph.defs#starterPackViewBasic"
-	unknownType        = "unknownType"
+	maxAuthorLen  = 256
+	ellipsisLen   = 3
+	maxStatsLen   = 100
+	feedSampleLen = 40
+	maxReplyChain = 10
+	// Labelers can offer a lot of labels, only this many are listed
+	maxLabelerLabels = 10
+	// Members fetched for a list's avatar mosaic
+	maxListAvatars = 4
+
+	// Error bodies are tiny, no need to read more than this
+	maxErrorBodyLen = 4096
+
+	maxCacheEntries  = 10000
+	maxCacheEntryLen = 2 * (1024 * 1024)
+	maxCacheBytes    = 256 * (1024 * 1024)
+
+	revalidateTimeout = 30 * time.Second
+
+	mosaicValidateConcurrency = 4
+	mosaicValidateTimeout     = 5 * time.Second
+	// A run isn't cut short by whoever started it (others may be waiting), so it has its own limit
+	mosaicRunTimeout   = time.Minute
+	mosaicCacheControl = "public, max-age=86400"
+	// Sensitive images are shrunk by this much (and back) by the compositor
+	mosaicBlurFactor = 40
+
+	mosaicLayoutAuto       = "auto"
+	mosaicLayoutHorizontal = "horizontal"
+	mosaicLayoutVertical   = "vertical"
+	mosaicLayoutGrid       = "grid"
+
+	mosaicMaxBorderRadius = 256
+	mosaicMaxGap          = 64
+	mosaicMaxSeparator    = 16
+	maxWatermarkLen       = 50
+	mosaicDefaultQuality  = 85
+	mosaicMinOutputLen    = 100
+	mosaicMaxSide         = 4096
+	mosaicDefaultSide     = 1000
+
+	defaultVideoWidth  = 1280
+	defaultVideoHeight = 720
+	// Of the oEmbed video player, the height follows from the video
+	oembedVideoWidth = 600
+	// DIDs and record keys, for the oEmbed video player
+	maxEmbedIdentifierLen = 512
+
+	threadNotFoundPost = "app.bsky.feed.defs#notFoundPost"
+	threadBlockedPost  = "app.bsky.feed.defs#blockedPost"
+	reasonRepost       = "app.bsky.feed.defs#reasonRepost"
+
+	bskyEmbedImages         = "app.bsky.embed.images#view"
+	galleryImages           = "app.bsky.embed.gallery#view"
+	bskyEmbedExternal       = "app.bsky.embed.external#view"
+	bskyEmbedVideo          = "app.bsky.embed.video#view"
+	bskyEmbedQuote          = "app.bsky.embed.recordWithMedia#view"
+	bskyEmbedText           = "app.bsky.embed.record#view"
+	bskyEmbedTextQuote      = "app.bsky.embed.record#viewRecord"
+	bskyEmbedRecordDetached = "app.bsky.embed.record#viewDetached"
+	bskyEmbedList           = "app.bsky.graph.defs#listView"
+	bskyEmbedFeed           = "app.bsky.feed.defs#generatorView"
+	bskyEmbedPack           = "app.bsky.graph.defs#starterPackViewBasic"
+	unknownType             = "unknownType"
+
+	// Served from the repo root, for feeds (and lists/packs) that have no avatar of their own
+	DefaultFeedAvatarPath = "/static/default-feed.svg"
+
+	IndexModeRedirect = "redirect"
+	IndexModeLanding  = "landing"
+	IndexModeNotFound = "notfound"
+
+	CacheProfile = "profile"
+	CachePost    = "post"
+	CacheFeed    = "feed"
+	CacheList    = "list"
+	CachePack    = "pack"
+
+	MosaicFallbackRedirect = "redirect"
+	MosaicFallbackError    = "error"
+
+	CanonicalTargetBluesky = "bsky"
+	CanonicalTargetSelf    = "self"
+
+	HandleSourceAppView = "appview"
+	HandleSourcePLC     = "plc"
+
+	LanguageEnglish = "en"
+	LanguageGerman  = "de"
+	LanguageSpanish = "es"
+
+	StatsStyleEmoji   = "emoji"
+	StatsStyleCompact = "compact"
+	StatsStyleText    = "text"
+
+	crawlerTelegram = "telegram"
+	crawlerSlack    = "slack"
+	crawlerWhatsApp = "whatsapp"
 
 	modList    = "app.bsky.graph.defs#modlist"
 	curateList = "app.bsky.graph.defs#curatelist"
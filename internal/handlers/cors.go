@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// oEmbed is public, so anyone can read it. The API (and raw JSON) only if the operator allows it
+func (ps *HandlerPass) CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var origin string
+		switch {
+		case r.URL.Path == "/oembed":
+			origin = "*"
+		case strings.HasPrefix(r.Host, "api."), strings.HasPrefix(r.URL.Path, "/raw-json/"):
+			origin = allowedOrigin(ps.APICORSOrigin, r.Header.Get("Origin"))
+
+			// Which origin (if any) is allowed depends on who's asking, unless it's all of them
+			if ps.APICORSOrigin != "" && origin != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+		}
+
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			// Preflight, the routes are GET only so this has to be answered before the mux sees it
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// "*" if any origin is allowed, the request's origin if it's one of the allowed ones (comma-separated), empty if it's not
+func allowedOrigin(allowed, origin string) string {
+	for candidate := range strings.SplitSeq(allowed, ",") {
+		switch candidate = strings.TrimSpace(candidate); {
+		case candidate == "*":
+			return "*"
+		case candidate != "" && candidate == origin:
+			return origin
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		allowed string
+		method  string
+		target  string
+		origin  string
+		// Empty if there shouldn't be one
+		wantOrigin string
+		wantVary   bool
+		// Answered by CORS itself, not passed on
+		wantPreflight bool
+	}{
+		{name: "oEmbed", method: http.MethodGet, target: "https://example.test/oembed", origin: "https://tool.example", wantOrigin: "*"},
+		{name: "oEmbed preflight", method: http.MethodOptions, target: "https://example.test/oembed", origin: "https://tool.example", wantOrigin: "*", wantPreflight: true},
+		{name: "page", allowed: "*", method: http.MethodGet, target: "https://example.test/profile/alice.test", origin: "https://tool.example"},
+		{name: "API off", method: http.MethodGet, target: "https://api.example.test/profile/alice.test", origin: "https://tool.example"},
+		{name: "API preflight off", method: http.MethodOptions, target: "https://api.example.test/profile/alice.test", origin: "https://tool.example"},
+		{name: "API any origin", allowed: "*", method: http.MethodGet, target: "https://api.example.test/profile/alice.test", origin: "https://tool.example", wantOrigin: "*"},
+		{
+			name:       "API allowed origin",
+			allowed:    "https://other.example, https://tool.example",
+			method:     http.MethodGet,
+			target:     "https://api.example.test/profile/alice.test",
+			origin:     "https://tool.example",
+			wantOrigin: "https://tool.example",
+			wantVary:   true,
+		},
+		{
+			name:     "API disallowed origin",
+			allowed:  "https://other.example,https://tool.example",
+			method:   http.MethodGet,
+			target:   "https://api.example.test/profile/alice.test",
+			origin:   "https://evil.example",
+			wantVary: true,
+		},
+		{name: "API no origin", allowed: "https://tool.example", method: http.MethodGet, target: "https://api.example.test/profile/alice.test", wantVary: true},
+		{
+			name:          "raw JSON preflight",
+			allowed:       "https://tool.example",
+			method:        http.MethodOptions,
+			target:        "https://example.test/raw-json/profile/alice.test",
+			origin:        "https://tool.example",
+			wantOrigin:    "https://tool.example",
+			wantVary:      true,
+			wantPreflight: true,
+		},
+		{
+			name:     "raw JSON preflight, disallowed origin",
+			allowed:  "https://tool.example",
+			method:   http.MethodOptions,
+			target:   "https://example.test/raw-json/profile/alice.test",
+			origin:   "https://evil.example",
+			wantVary: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := testHandlerPass()
+			ps.APICORSOrigin = tt.allowed
+
+			var passedOn bool
+			handler := ps.CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				passedOn = true
+			}))
+
+			req := httptest.NewRequestWithContext(t.Context(), tt.method, tt.target, http.NoBody)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+
+			if got := slices.Contains(recorder.Header().Values("Vary"), "Origin"); got != tt.wantVary {
+				t.Errorf("Vary: Origin = %t, want %t", got, tt.wantVary)
+			}
+
+			if passedOn == tt.wantPreflight {
+				t.Errorf("passed on = %t, want %t", passedOn, !tt.wantPreflight)
+			}
+
+			if !tt.wantPreflight {
+				return
+			}
+
+			if recorder.Code != http.StatusNoContent {
+				t.Errorf("preflight status = %d, want %d", recorder.Code, http.StatusNoContent)
+			}
+
+			for header, want := range map[string]string{
+				"Access-Control-Allow-Methods": "GET, OPTIONS",
+				"Access-Control-Allow-Headers": "Content-Type",
+				"Access-Control-Max-Age":       "86400",
+			} {
+				if got := recorder.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
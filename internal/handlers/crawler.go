@@ -0,0 +1,17 @@
+package handlers
+
+import "strings"
+
+// Only the crawlers that get something different, everything else is treated the same
+func detectCrawler(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Telegram"):
+		return crawlerTelegram
+	case strings.Contains(userAgent, "Slackbot"), strings.Contains(userAgent, "Slack-ImgProxy"):
+		return crawlerSlack
+	case strings.Contains(userAgent, "WhatsApp"):
+		return crawlerWhatsApp
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+)
+
+// Gives every request RequestTimeout in total, so the client gets a proper answer instead of the connection being cut at WriteTimeout.
+// The handler gets the deadline through its context (cancelling upstream requests), and writes into a buffer until it's done
+func (ps *HandlerPass) Deadline(next http.Handler) http.Handler {
+	if ps.RequestTimeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), ps.RequestTimeout)
+		defer cancel()
+
+		rec := &cacheRecorder{header: make(http.Header), status: http.StatusOK}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+
+		go func() {
+			// The server only recovers panics on its own goroutine, hand this one back
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+		case <-ctx.Done():
+		}
+
+		// Finishing right as the deadline passed still counts, the select above picks either one when both are ready
+		select {
+		case <-done:
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+		default:
+			// The handler may still be writing to rec (or panic later), it's left to it
+			ErrorPage(w, pageErrorf(ErrTimeout, "deadline: Request took longer than REQUEST_TIMEOUT"))
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"in time",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test", "kept")
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("finished"))
+			},
+			http.StatusTeapot, "finished",
+		},
+		{
+			"past the deadline",
+			func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				time.Sleep(50 * time.Millisecond)
+				w.Write([]byte("too late"))
+			},
+			http.StatusGatewayTimeout, html.EscapeString(errorCodes[ErrTimeout].message),
+		},
+		{
+			"ignoring the deadline",
+			func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				w.Write([]byte("too late"))
+			},
+			http.StatusGatewayTimeout, html.EscapeString(errorCodes[ErrTimeout].message),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := &HandlerPass{RequestTimeout: 20 * time.Millisecond}
+
+			recorder := httptest.NewRecorder()
+			ps.Deadline(tt.handler).ServeHTTP(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", http.NoBody))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body doesn't have %q:\n%s", tt.wantBody, recorder.Body.String())
+			}
+
+			if tt.wantStatus == http.StatusTeapot && recorder.Header().Get("X-Test") != "kept" {
+				t.Error("the handler's headers were dropped")
+			}
+		})
+	}
+}
+
+func TestDeadlinePanics(t *testing.T) {
+	t.Parallel()
+
+	ps := &HandlerPass{RequestTimeout: time.Second}
+	handler := ps.Deadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	}))
+
+	defer func() {
+		if p := recover(); p != "handler failed" {
+			t.Errorf("recovered %v, want the handler's panic", p)
+		}
+	}()
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", http.NoBody))
+}
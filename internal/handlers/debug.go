@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"main/internal/helpers"
+)
+
+// ?debug=1 logs what a request sends upstream and how decoding went, but only with the operator's DEBUG_TOKEN
+// in the X-Debug-Token header (the logs are ours, and anyone could fill them up otherwise)
+func (ps *HandlerPass) Debug(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ps.DebugToken != "" && r.URL.Query().Get("debug") == "1" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Debug-Token")), []byte(ps.DebugToken)) == 1 {
+			r = r.WithContext(helpers.WithDebug(r.Context()))
+		}
+
+		helpers.Debugf(r.Context(), "request %s %s%s", r.Method, r.Host, r.URL.Path)
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,12 +1,147 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+
+	"main/internal/types"
+)
+
+type (
+	// What kind of error it was, decides the status and what the visitor is told
+	ErrorCode int
+
+	// The detail says where it happened and what exactly went wrong ("getPost: Photo 5 doesn't exist, this post has 4")
+	PageError struct {
+		Code   ErrorCode
+		Detail string
+	}
+
+	errorCodeInfo struct {
+		status int
+		// For the JSON variant, so it can be told apart without parsing the message
+		name,
+		message string
+	}
+
+	errorJSON struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Detail  string `json:"detail,omitempty"`
+	}
+)
+
+const (
+	// Bluesky failed, or answered with something we can't use
+	ErrUpstream ErrorCode = iota
+	// It doesn't exist (anymore)
+	ErrNotFound
+	// Bluesky took too long
+	ErrTimeout
+	// The link itself is wrong (a photo number that isn't one, for example)
+	ErrBadInput
+	// Part of the link is longer than anything real could be
+	ErrTooLong
+	// It exists, but isn't shown to logged out viewers (blocks, author settings)
+	ErrUnavailable
+	// Our fault
+	ErrInternal
 )
 
-var errorTemplate = template.Must(template.ParseFiles("./views/error.html"))
+var (
+	// Parsed by LoadTemplates
+	errorTemplate *template.Template
+
+	errorCodes = map[ErrorCode]errorCodeInfo{
+		ErrUpstream:    {http.StatusBadGateway, "upstream", "Bluesky didn't give a usable answer"},
+		ErrNotFound:    {http.StatusNotFound, "not_found", "That doesn't exist, it may have been deleted"},
+		ErrTimeout:     {http.StatusGatewayTimeout, "timeout", "This is taking too long, Bluesky may be slow right now. Try again in a bit!"},
+		ErrBadInput:    {http.StatusBadRequest, "bad_input", "That link doesn't look right"},
+		ErrTooLong:     {http.StatusRequestURITooLong, "too_long", "That link is too long"},
+		ErrUnavailable: {http.StatusForbidden, "unavailable", "That isn't available to logged out viewers"},
+		ErrInternal:    {http.StatusInternalServerError, "internal", "Something went wrong on our end"},
+	}
+)
+
+func pageErrorf(code ErrorCode, format string, args ...any) PageError {
+	return PageError{Code: code, Detail: fmt.Sprintf(format, args...)}
+}
+
+func (pe PageError) Error() string {
+	if pe.Detail == "" {
+		return pe.Code.info().message
+	}
+
+	return pe.Code.info().message + " (" + pe.Detail + ")"
+}
+
+// Unknown codes are treated as our own fault
+func (code ErrorCode) info() errorCodeInfo {
+	if info, ok := errorCodes[code]; ok {
+		return info
+	}
+
+	return errorCodes[ErrInternal]
+}
+
+// Anything that isn't a PageError is treated as our own fault
+func asPageError(err error) PageError {
+	var pageErr PageError
+	if errors.As(err, &pageErr) {
+		return pageErr
+	}
+
+	return PageError{Code: ErrInternal, Detail: err.Error()}
+}
+
+func ErrorPage(w http.ResponseWriter, err error) {
+	pageErr := asPageError(err)
+
+	// Errors are usually temporary, nobody (us included) should hold on to them
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(pageErr.Code.info().status)
+	errorTemplate.Execute(w, map[string]string{"errorMsg": pageErr.Error()})
+}
+
+// Same as ErrorPage, for the endpoints that answer with JSON
+func ErrorJSON(w http.ResponseWriter, err error) {
+	pageErr := asPageError(err)
+	info := pageErr.Code.info()
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(info.status)
+	json.NewEncoder(w).Encode(errorJSON{Error: info.name, Message: info.message, Detail: pageErr.Detail})
+}
+
+// Bluesky answers 400 for most things that don't exist (unknown actors, for one), anything else is on them
+func upstreamStatusError(funcName string, resp *http.Response) PageError {
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return pageErrorf(ErrNotFound, "%s: Unexpected status (%s)", funcName, resp.Status)
+	}
+
+	return pageErrorf(ErrUpstream, "%s: Unexpected status (%s)", funcName, resp.Status)
+}
+
+// For our own API (api.<domain>), whose statuses came from errorCodes, so they say which error it was.
+// A 400 is bad input there, unless it's Bluesky's NotFound passed along
+func ownStatusError(funcName string, resp *http.Response) PageError {
+	if resp.StatusCode == http.StatusBadRequest {
+		var apiErr types.APIError
+		if decodeErr := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodyLen)).Decode(&apiErr); decodeErr == nil && apiErr.Error == "NotFound" {
+			return pageErrorf(ErrNotFound, "%s: Unexpected status (%s)", funcName, resp.Status)
+		}
+	}
+
+	for code, info := range errorCodes {
+		if info.status == resp.StatusCode {
+			return pageErrorf(code, "%s: Unexpected status (%s)", funcName, resp.Status)
+		}
+	}
 
-func ErrorPage(w http.ResponseWriter, errorMessage string) {
-	errorTemplate.Execute(w, map[string]string{"errorMsg": errorMessage})
+	return upstreamStatusError(funcName, resp)
 }
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		code        ErrorCode
+		wantStatus  int
+		wantName    string
+		wantMessage string
+	}{
+		{ErrUpstream, http.StatusBadGateway, "upstream", "Bluesky didn't give a usable answer"},
+		{ErrNotFound, http.StatusNotFound, "not_found", "That doesn't exist, it may have been deleted"},
+		{ErrTimeout, http.StatusGatewayTimeout, "timeout", "This is taking too long, Bluesky may be slow right now. Try again in a bit!"},
+		{ErrBadInput, http.StatusBadRequest, "bad_input", "That link doesn't look right"},
+		{ErrTooLong, http.StatusRequestURITooLong, "too_long", "That link is too long"},
+		{ErrUnavailable, http.StatusForbidden, "unavailable", "That isn't available to logged out viewers"},
+		{ErrInternal, http.StatusInternalServerError, "internal", "Something went wrong on our end"},
+		// Unknown codes are our fault
+		{ErrorCode(-1), http.StatusInternalServerError, "internal", "Something went wrong on our end"},
+	}
+
+	if len(tests) != len(errorCodes)+1 {
+		t.Fatalf("%d error codes, but %d are tested", len(errorCodes), len(tests)-1)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantName+"/page", func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+			ErrorPage(recorder, pageErrorf(tt.code, "test: Detail %d", 1))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", cacheControl)
+			}
+
+			if want := html.EscapeString(tt.wantMessage + " (test: Detail 1)"); !strings.Contains(recorder.Body.String(), want) {
+				t.Errorf("page doesn't say %q", want)
+			}
+		})
+
+		t.Run(tt.wantName+"/json", func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+			ErrorJSON(recorder, pageErrorf(tt.code, "test: Detail %d", 1))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			var got errorJSON
+			if decodeErr := json.NewDecoder(recorder.Body).Decode(&got); decodeErr != nil {
+				t.Fatal(decodeErr)
+			}
+
+			if want := (errorJSON{Error: tt.wantName, Message: tt.wantMessage, Detail: "test: Detail 1"}); got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestAsPageError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode ErrorCode
+	}{
+		{"page error", pageErrorf(ErrNotFound, "getPost: Gone"), ErrNotFound},
+		{"wrapped page error", fmt.Errorf("wrapped: %w", pageErrorf(ErrTimeout, "getPost: Slow")), ErrTimeout},
+		{"any other error", errors.New("something else"), ErrInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := asPageError(tt.err); got.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", got.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUpstreamStatusError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status   int
+		wantCode ErrorCode
+	}{
+		{http.StatusBadRequest, ErrNotFound},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusInternalServerError, ErrUpstream},
+		{http.StatusBadGateway, ErrUpstream},
+		{http.StatusTooManyRequests, ErrUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			t.Parallel()
+
+			resp := &http.Response{StatusCode: tt.status, Status: fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status))}
+			if got := upstreamStatusError("test", resp); got.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", got.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestLimitPathValues(t *testing.T) {
+	t.Parallel()
+
+	ps := &HandlerPass{MaxPathValueLen: 10}
+	handler := ps.LimitPathValues(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/profile/short", http.StatusOK},
+		{"/profile/" + strings.Repeat("a", 11), http.StatusRequestURITooLong},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.path, http.NoBody))
+
+		if recorder.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, recorder.Code, tt.wantStatus)
+		}
+	}
+}
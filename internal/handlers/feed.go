@@ -7,14 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"main/internal/helpers"
 	"main/internal/types"
+
+	"golang.org/x/text/message"
 )
 
-var feedTemplate = template.Must(template.ParseFiles("./views/feed.html"))
+// Parsed by LoadTemplates
+var feedTemplate *template.Template
 
 func (ps *HandlerPass) GetFeed(w http.ResponseWriter, r *http.Request) {
 	profileID := r.PathValue("profileID")
@@ -38,54 +43,65 @@ func (ps *HandlerPass) GetFeed(w http.ResponseWriter, r *http.Request) {
 
 	req, reqErr := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
 	if reqErr != nil {
-		ErrorPage(w, "getFeed: failed to create request")
+		ErrorPage(w, pageErrorf(ErrInternal, "getFeed: Failed to create request"))
 		return
 	}
 
-	resp, respErr := helpers.TimeoutClient.Do(req)
+	resp, respErr := helpers.CachedClient.Do(req)
 	if errors.Is(respErr, context.DeadlineExceeded) {
-		ErrorPage(w, "getFeed: Bluesky took too long to respond (timeout exceeded)")
+		ErrorPage(w, pageErrorf(ErrTimeout, "getFeed: Timeout exceeded"))
 		return
 	} else if respErr != nil {
-		ErrorPage(w, "getFeed: failed to do request")
+		ErrorPage(w, pageErrorf(ErrUpstream, "getFeed: Failed to do request"))
 		return
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		ErrorPage(w, fmt.Sprintf("getFeed: Unexpected status (%s)", resp.Status))
+		ErrorPage(w, upstreamStatusError("getFeed", resp))
 		return
 	}
 
 	var feed types.APIFeed
-	if decodeErr := json.NewDecoder(resp.Body).Decode(&feed); decodeErr != nil {
-		ErrorPage(w, "getFeed: failed to decode response")
+	decodeErr := json.NewDecoder(resp.Body).Decode(&feed)
+	helpers.DebugDecode(r.Context(), "getFeed", decodeErr)
+
+	if decodeErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getFeed: Failed to decode response"))
 		return
 	}
 
-	if len(plcData.AKA) > 0 {
-		feed.View.Creator.Handle = strings.TrimPrefix(plcData.AKA[0], "at://")
+	feed.View.Creator.Handle = ps.preferredHandle(feed.View.Creator.Handle, plcData)
 
-		if feed.View.Creator.DisplayName == "" {
-			feed.View.Creator.DisplayName = feed.View.Creator.Handle
-		}
+	if feed.View.Creator.DisplayName == "" {
+		feed.View.Creator.DisplayName = feed.View.Creator.Handle
 	}
 
-	feed.View.Description = fmt.Sprintf("📡 A feed by %s (@%s)\n\n%s", feed.View.Creator.DisplayName, feed.View.Creator.Handle, feed.View.Description)
+	printer := ps.localizer(w, r)
+
+	feed.View.Description = printer.Sprintf(msgFeedBy, feed.View.Creator.DisplayName, feed.View.Creator.Handle) + "\n\n" + feed.View.Description
+
+	// Likes and status used to be oEmbed only, offline or invalid feeds are worth knowing about up front
+	feedStats := printer.Sprintf(msgFeedLikes, helpers.ToNotation(feed.View.LikeCount)) + " - " + feedStatusBadges(printer, &feed.IsOnline, &feed.IsValid)
+	if ps.FeedStatsInDescription {
+		feed.View.Description = feedStats + "\n\n" + feed.View.Description
+	}
 
 	if strings.HasPrefix(r.Host, "api.") {
 		w.Header().Set("Content-Type", "application/json")
 
 		if encodeErr := json.NewEncoder(w).Encode(&feed); encodeErr != nil {
-			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrInternal, "Failed to encode JSON"))
 			return
 		}
 
 		return
 	}
 
-	isTelegramAgent := strings.Contains(r.Header.Get("User-Agent"), "Telegram")
+	feed.View.Avatar = ps.avatarOrFallback(feed.View.Avatar)
+
+	isTelegramAgent := detectCrawler(r.Header.Get("User-Agent")) == crawlerTelegram
 
 	encodedID := types.RichActivityEncoded{
 		Type:   "feed",
@@ -95,9 +111,81 @@ func (ps *HandlerPass) GetFeed(w http.ResponseWriter, r *http.Request) {
 
 	marshaled, err := json.Marshal(encodedID)
 	if err != nil {
-		ErrorPage(w, "getFeed: failed to marshal for activity")
+		ErrorPage(w, pageErrorf(ErrInternal, "getFeed: Failed to marshal for activity"))
 		return
 	}
 
-	feedTemplate.Execute(w, map[string]any{"feed": feed, "feedID": feedID, "isTelegram": isTelegramAgent, "encodedID": hex.EncodeToString(marshaled), "passData": ps})
+	ps.setPageCacheControl(w, CacheFeed)
+
+	feedTemplate.Execute(w, feedTemplateData{
+		Feed:       feed,
+		FeedID:     feedID,
+		Stats:      feedStats,
+		EncodedID:  hex.EncodeToString(marshaled),
+		BaseURL:    helpers.BaseURL(r, ps.TrustForwarded),
+		IsTelegram: isTelegramAgent,
+		PassData:   ps,
+	})
+}
+
+// Feed descriptions tend to be short, so grab the first post of the feed as a sample
+func getFeedSample(ctx context.Context, feedURI string) (string, bool) {
+	if !strings.Contains(feedURI, "app.bsky.feed.generator/") {
+		return "", false
+	}
+
+	apiURL := "https://public.api.bsky.app/xrpc/app.bsky.feed.getFeed?limit=1&feed=" + url.QueryEscape(feedURI)
+	if helpers.IsBlueskyDead.Load() {
+		apiURL = "https://api.bsky.app/xrpc/app.bsky.feed.getFeed?limit=1&feed=" + url.QueryEscape(feedURI)
+	}
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, http.NoBody)
+	if reqErr != nil {
+		return "", false
+	}
+
+	resp, respErr := helpers.TimeoutClient.Do(req)
+	if respErr != nil {
+		return "", false
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+
+	var feedPosts types.APIFeedPosts
+	if decodeErr := json.NewDecoder(io.LimitReader(resp.Body, helpers.MaxReadLimit)).Decode(&feedPosts); decodeErr != nil {
+		return "", false
+	}
+
+	if len(feedPosts.Feed) == 0 || feedPosts.Feed[0].Post.Record.Text == "" {
+		return "", false
+	}
+
+	return helpers.TruncateRunes(feedPosts.Feed[0].Post.Record.Text, feedSampleLen), true
+}
+
+// Same badges as the feed page, but these may be missing from embeds (nil), so skip those
+func feedStatusBadges(printer *message.Printer, isOnline, isValid *bool) string {
+	var badges []string
+
+	if isOnline != nil {
+		if *isOnline {
+			badges = append(badges, printer.Sprintf(msgOnline))
+		} else {
+			badges = append(badges, printer.Sprintf(msgNotOnline))
+		}
+	}
+
+	if isValid != nil {
+		if *isValid {
+			badges = append(badges, printer.Sprintf(msgValid))
+		} else {
+			badges = append(badges, printer.Sprintf(msgNotValid))
+		}
+	}
+
+	return strings.Join(badges, " - ")
 }
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetFeedStats(t *testing.T) {
+	tests := []struct {
+		name          string
+		fixture       string
+		inDescription bool
+		language      string
+		wantStats     string
+	}{
+		{name: "online", fixture: "feed-online.json", wantStats: "🩷 1.2K likes - ✅ Online - ✅ Valid"},
+		{name: "offline", fixture: "feed-offline.json", wantStats: "🩷 0 likes - ❌ Not online - ❌ Not valid"},
+		{name: "in the description", fixture: "feed-offline.json", inDescription: true, wantStats: "🩷 0 likes - ❌ Not online - ❌ Not valid"},
+		{name: "translated", fixture: "feed-online.json", inDescription: true, language: "de", wantStats: "🩷 1.2K Likes - ✅ Online - ✅ Gültig"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, readErr := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+
+			stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Host == "plc.directory":
+					w.Write([]byte("{}"))
+				case r.URL.Path == "/xrpc/app.bsky.feed.getFeedGenerator":
+					w.Header().Set("Content-Type", "application/json")
+					w.Write(body)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+
+			ps := testHandlerPass()
+			ps.FeedStatsInDescription = tt.inDescription
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/feed/cats", http.NoBody)
+			req.Header.Set("Accept-Language", tt.language)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("feedID", "cats")
+
+			recorder := httptest.NewRecorder()
+			ps.GetFeed(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			// Always on the page itself
+			if !strings.Contains(page, "<p>"+tt.wantStats+"</p>") {
+				t.Errorf("no %q on the page:\n%s", tt.wantStats, page)
+			}
+
+			_, description, _ := strings.Cut(page, `<meta property="og:description" content="`)
+			description, _, _ = strings.Cut(description, `">`)
+
+			if got := strings.HasPrefix(description, tt.wantStats); got != tt.inDescription {
+				t.Errorf("og:description %q starts with the stats = %t, want %t", description, got, tt.inDescription)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetFeedFallbackAvatar(t *testing.T) {
+	const fallback = "https://example.test/static/avatar.png"
+
+	tests := []struct {
+		name     string
+		fallback string
+	}{
+		{name: "fallback", fallback: fallback},
+		{name: "no fallback"},
+	}
+
+	// The fixture has no avatar
+	body, readErr := os.ReadFile(filepath.Join("testdata", "feed-online.json"))
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+
+	stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Host == "plc.directory":
+			w.Write([]byte("{}"))
+		case r.URL.Path == "/xrpc/app.bsky.feed.getFeedGenerator":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := testHandlerPass()
+			ps.FallbackAvatar = tt.fallback
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/feed/cats", http.NoBody)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("feedID", "cats")
+
+			recorder := httptest.NewRecorder()
+			ps.GetFeed(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			want := `<meta property="og:image" content="` + fallback + `">`
+			if got := strings.Contains(recorder.Body.String(), want); got != (tt.fallback != "") {
+				t.Errorf("got %q on the page %t, want %t:\n%s", want, got, tt.fallback != "", recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"main/internal/helpers"
+)
+
+// Answers upstream requests with its handler instead of the network
+type stubTransport struct {
+	handler http.Handler
+}
+
+func TestMain(m *testing.M) {
+	if loadErr := LoadTemplates("../../views"); loadErr != nil {
+		log.Fatal(loadErr)
+	}
+
+	os.Exit(m.Run())
+}
+
+func (st stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	st.handler.ServeHTTP(recorder, req)
+
+	resp := recorder.Result()
+	resp.Request = req
+
+	return resp, nil
+}
+
+// Every upstream client talks to handler until the test is over, so tests using it can't run in parallel
+func stubUpstream(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	timeoutTransport, cachedTransport := helpers.TimeoutClient.Transport, helpers.CachedClient.Transport
+	t.Cleanup(func() {
+		helpers.TimeoutClient.Transport, helpers.CachedClient.Transport = timeoutTransport, cachedTransport
+	})
+
+	helpers.TimeoutClient.Transport = stubTransport{handler: handler}
+	helpers.CachedClient.Transport = stubTransport{handler: handler}
+}
+
+// Bluesky, with getPostThread answering status and the fixture in testdata (the DID document is empty, everything else doesn't exist)
+func stubPostThread(t *testing.T, status int, fixture string) {
+	t.Helper()
+
+	body, readErr := os.ReadFile(filepath.Join("testdata", fixture))
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+
+	stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Host == "plc.directory":
+			w.Write([]byte("{}"))
+		case r.URL.Path == "/xrpc/app.bsky.feed.getPostThread":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+// GetPost's answer for did:plc:abc's post 3kpost on host (example.test, raw.example.test, ...), as userAgent sees it
+func requestPost(t *testing.T, host, query, userAgent string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://"+host+"/profile/did:plc:abc/post/3kpost?"+query, http.NoBody)
+	req.Header.Set("User-Agent", userAgent)
+	req.SetPathValue("profileID", "did:plc:abc")
+	req.SetPathValue("postID", "3kpost")
+
+	recorder := httptest.NewRecorder()
+	testHandlerPass().GetPost(recorder, req)
+
+	return recorder
+}
+
+func testHandlerPass() *HandlerPass {
+	return &HandlerPass{DomainName: "example.test", ThemeColor: "#0085ff", StatsStyle: StatsStyleEmoji, MaxFacets: 100}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"strings"
+
+	"main/internal/types"
+)
+
+// The AppView and the PLC can disagree for a while after a handle change, either one can be the stale one.
+// The operator picks which one wins, the other is only used if the first one is missing (or invalid)
+func (ps *HandlerPass) preferredHandle(appViewHandle string, plcData types.PLCDirectory) string {
+	var plcHandle string
+	if len(plcData.AKA) > 0 {
+		plcHandle = strings.TrimPrefix(plcData.AKA[0], "at://")
+	}
+
+	switch {
+	case ps.HandleSource == HandleSourceAppView && isValidHandle(appViewHandle):
+		return appViewHandle
+	case plcHandle != "":
+		return plcHandle
+	default:
+		return appViewHandle
+	}
+}
+
+// https://atproto.com/specs/handle#handle-identifier-syntax
+func isValidHandle(handle string) bool {
+	if handle == "" || len(handle) > 253 || handle == "handle.invalid" {
+		return false
+	}
+
+	labels := strings.Split(strings.ToLower(handle), ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+
+	// The TLD can't start with a number
+	tld := labels[len(labels)-1]
+
+	return tld[0] < '0' || tld[0] > '9'
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// Descriptions are put together from these, the English text doubles as the key
+const (
+	msgFeedBy        = "📡 A feed by %s (@%s)"
+	msgModListBy     = "🚫 A moderation list by %s (@%s)"
+	msgCuratorListBy = "👥 A curator list by %s (@%s)"
+	msgPackBy        = "📦 A starter pack by %s (@%s)"
+	msgMembers       = "👥 %s members"
+	msgLatest        = "Latest: %s"
+	msgDeletedFeed   = "📡 Quoting a deleted feed"
+	msgDetachedQuote = "🔁 Quoting a post [detached by author]"
+	msgQuoting       = "📝 Quoting %s (@%s):"
+	msgReplyingTo    = "💬 Replying to %s (@%s):"
+	msgReplyBlocked  = "💬 Replying to [blocked account]"
+	msgChainBlocked  = "🧵 [blocked account]"
+	msgParentRepost  = "🔁 Parent reposted by %s (@%s)"
+	msgMediaImages   = "🖼️ Images (%d)"
+	msgMediaVideo    = "🎬 Video"
+	msgStartsAt      = "⏱️ Starts at %d:%02d"
+	msgPhotoOf       = "Photo %d of %d"
+	msgPhotosOf      = "Photos %s of %d"
+	msgNoReplies     = "🔒 Replies are disabled"
+	msgProfileStats  = "👥 %s Followers - 🌐 %s Following - ✍️ %s Posts"
+	msgLabeler       = "🏷️ Labeler"
+	msgFeedLikes     = "🩷 %s likes"
+	msgOnline        = "✅ Online"
+	msgNotOnline     = "❌ Not online"
+	msgValid         = "✅ Valid"
+	msgNotValid      = "❌ Not valid"
+	msgOneFeed       = "📡 1 feed"
+	msgFeeds         = "📡 %s feeds"
+	msgOneList       = "📋 1 list"
+	msgLists         = "📋 %s lists"
+	msgOnePack       = "📦 1 starter pack"
+	msgPacks         = "📦 %s starter packs"
+
+	// Plain text versions, for the text endpoint
+	msgTextQuoting    = "Quoting %s (@%s):"
+	msgTextReplyingTo = "Replying to %s (@%s):"
+)
+
+var (
+	// English goes first, it's what the matcher falls back on
+	supportedLanguages = []language.Tag{language.English, language.German, language.Spanish}
+	languageMatcher    = language.NewMatcher(supportedLanguages)
+
+	messageCatalog = newMessageCatalog(map[language.Tag]map[string]string{
+		language.German: {
+			msgFeedBy:         "📡 Ein Feed von %s (@%s)",
+			msgModListBy:      "🚫 Eine Moderationsliste von %s (@%s)",
+			msgCuratorListBy:  "👥 Eine Kuratorenliste von %s (@%s)",
+			msgPackBy:         "📦 Ein Starterpaket von %s (@%s)",
+			msgMembers:        "👥 %s Mitglieder",
+			msgLatest:         "Neueste: %s",
+			msgDeletedFeed:    "📡 Zitiert einen gelöschten Feed",
+			msgDetachedQuote:  "🔁 Zitiert einen Beitrag [vom Autor gelöst]",
+			msgQuoting:        "📝 Zitiert %s (@%s):",
+			msgReplyingTo:     "💬 Antwort an %s (@%s):",
+			msgReplyBlocked:   "💬 Antwort an [blockiertes Konto]",
+			msgChainBlocked:   "🧵 [blockiertes Konto]",
+			msgParentRepost:   "🔁 Vorheriger Beitrag repostet von %s (@%s)",
+			msgMediaImages:    "🖼️ Bilder (%d)",
+			msgMediaVideo:     "🎬 Video",
+			msgStartsAt:       "⏱️ Beginnt bei %d:%02d",
+			msgPhotoOf:        "Foto %d von %d",
+			msgPhotosOf:       "Fotos %s von %d",
+			msgNoReplies:      "🔒 Antworten sind deaktiviert",
+			msgProfileStats:   "👥 %s Follower - 🌐 %s folgt - ✍️ %s Beiträge",
+			msgLabeler:        "🏷️ Labeler",
+			msgFeedLikes:      "🩷 %s Likes",
+			msgOnline:         "✅ Online",
+			msgNotOnline:      "❌ Nicht online",
+			msgValid:          "✅ Gültig",
+			msgNotValid:       "❌ Ungültig",
+			msgOneFeed:        "📡 1 Feed",
+			msgFeeds:          "📡 %s Feeds",
+			msgOneList:        "📋 1 Liste",
+			msgLists:          "📋 %s Listen",
+			msgOnePack:        "📦 1 Starterpaket",
+			msgPacks:          "📦 %s Starterpakete",
+			msgTextQuoting:    "Zitiert %s (@%s):",
+			msgTextReplyingTo: "Antwort an %s (@%s):",
+		},
+		language.Spanish: {
+			msgFeedBy:         "📡 Un feed de %s (@%s)",
+			msgModListBy:      "🚫 Una lista de moderación de %s (@%s)",
+			msgCuratorListBy:  "👥 Una lista de curación de %s (@%s)",
+			msgPackBy:         "📦 Un paquete de inicio de %s (@%s)",
+			msgMembers:        "👥 %s miembros",
+			msgLatest:         "Lo último: %s",
+			msgDeletedFeed:    "📡 Citando un feed eliminado",
+			msgDetachedQuote:  "🔁 Citando una publicación [desvinculada por el autor]",
+			msgQuoting:        "📝 Citando a %s (@%s):",
+			msgReplyingTo:     "💬 Respondiendo a %s (@%s):",
+			msgReplyBlocked:   "💬 Respondiendo a [cuenta bloqueada]",
+			msgChainBlocked:   "🧵 [cuenta bloqueada]",
+			msgParentRepost:   "🔁 Publicación anterior reposteada por %s (@%s)",
+			msgMediaImages:    "🖼️ Imágenes (%d)",
+			msgMediaVideo:     "🎬 Vídeo",
+			msgStartsAt:       "⏱️ Empieza en %d:%02d",
+			msgPhotoOf:        "Foto %d de %d",
+			msgPhotosOf:       "Fotos %s de %d",
+			msgNoReplies:      "🔒 Las respuestas están desactivadas",
+			msgProfileStats:   "👥 %s seguidores - 🌐 %s siguiendo - ✍️ %s publicaciones",
+			msgLabeler:        "🏷️ Etiquetador",
+			msgFeedLikes:      "🩷 %s me gusta",
+			msgOnline:         "✅ En línea",
+			msgNotOnline:      "❌ Sin conexión",
+			msgValid:          "✅ Válido",
+			msgNotValid:       "❌ No válido",
+			msgOneFeed:        "📡 1 feed",
+			msgFeeds:          "📡 %s feeds",
+			msgOneList:        "📋 1 lista",
+			msgLists:          "📋 %s listas",
+			msgOnePack:        "📦 1 paquete de inicio",
+			msgPacks:          "📦 %s paquetes de inicio",
+			msgTextQuoting:    "Citando a %s (@%s):",
+			msgTextReplyingTo: "Respondiendo a %s (@%s):",
+		},
+	})
+)
+
+// English has no entries, missing keys are printed as they are
+func newMessageCatalog(translations map[language.Tag]map[string]string) catalog.Catalog {
+	builder := catalog.NewBuilder(catalog.Fallback(language.English))
+
+	for tag, messages := range translations {
+		for key, translated := range messages {
+			if setErr := builder.SetString(tag, key, translated); setErr != nil {
+				panic(setErr)
+			}
+		}
+	}
+
+	return builder
+}
+
+// Visitors get their own language if we have it, crawlers rarely send one so they get the operator's
+func (ps *HandlerPass) requestLanguage(r *http.Request) language.Tag {
+	tags, _, parseErr := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if parseErr == nil && len(tags) > 0 {
+		if _, index, confidence := languageMatcher.Match(tags...); confidence != language.No {
+			return supportedLanguages[index]
+		}
+	}
+
+	return language.Make(ps.DefaultLanguage)
+}
+
+func (ps *HandlerPass) localizer(w http.ResponseWriter, r *http.Request) *message.Printer {
+	w.Header().Add("Vary", "Accept-Language")
+
+	return message.NewPrinter(ps.requestLanguage(r), message.Catalog(messageCatalog))
+}
@@ -1,14 +1,32 @@
 package handlers
 
 import (
+	"html/template"
 	"net/http"
+
+	"main/internal/helpers"
 )
 
+// Parsed by LoadTemplates
+var indexTemplate *template.Template
+
 func (ps *HandlerPass) IndexPage(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
-		ErrorPage(w, "route not found")
+		ErrorPage(w, pageErrorf(ErrNotFound, "Route not found"))
 		return
 	}
 
-	http.Redirect(w, r, ps.IndexURL, http.StatusFound)
+	switch ps.IndexMode {
+	case IndexModeLanding:
+		indexTemplate.Execute(w, indexTemplateData{BaseURL: helpers.BaseURL(r, ps.TrustForwarded), PassData: ps})
+	case IndexModeNotFound:
+		ErrorPage(w, pageErrorf(ErrNotFound, "Route not found"))
+	default:
+		http.Redirect(w, r, ps.IndexURL, http.StatusFound)
+	}
+}
+
+// Edit the file to change it, crawlers blocked there can't see the noindex tag either
+func (ps *HandlerPass) GetRobots(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, ps.RobotsFile)
 }
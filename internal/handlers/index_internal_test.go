@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexPage(t *testing.T) {
+	t.Parallel()
+
+	const repoURL = "https://github.com/colduw/xbsky"
+
+	tests := []struct {
+		name         string
+		mode         string
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "redirect", mode: IndexModeRedirect, path: "/", wantStatus: http.StatusFound, wantLocation: repoURL},
+		{name: "default", mode: "", path: "/", wantStatus: http.StatusFound, wantLocation: repoURL},
+		{name: "landing", mode: IndexModeLanding, path: "/", wantStatus: http.StatusOK, wantBody: "<code>example.test</code> in any Bluesky link"},
+		{name: "not found", mode: IndexModeNotFound, path: "/", wantStatus: http.StatusNotFound},
+		// Everything the mux doesn't know ends up here too
+		{name: "unknown route", mode: IndexModeRedirect, path: "/nothing-here", wantStatus: http.StatusNotFound},
+		{name: "unknown route, landing", mode: IndexModeLanding, path: "/nothing-here", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := testHandlerPass()
+			ps.IndexMode = tt.mode
+			ps.IndexURL = repoURL
+
+			recorder := httptest.NewRecorder()
+			ps.IndexPage(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test"+tt.path, http.NoBody))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if got := recorder.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("no %q in:\n%s", tt.wantBody, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestGetRobots(t *testing.T) {
+	t.Parallel()
+
+	const robots = "User-agent: *\nDisallow: /\n"
+
+	robotsFile := filepath.Join(t.TempDir(), "robots.txt")
+	if writeErr := os.WriteFile(robotsFile, []byte(robots), 0o600); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "configured", file: robotsFile, wantStatus: http.StatusOK, wantBody: robots},
+		{name: "default", file: "../../robots.txt", wantStatus: http.StatusOK, wantBody: "User-agent: *\nAllow: /\n"},
+		{name: "missing", file: filepath.Join(t.TempDir(), "robots.txt"), wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := testHandlerPass()
+			ps.RobotsFile = tt.file
+
+			recorder := httptest.NewRecorder()
+			ps.GetRobots(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/robots.txt", http.NoBody))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := recorder.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+
+			if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+				t.Errorf("Content-Type = %q, want text/plain", got)
+			}
+		})
+	}
+}
+
+func TestIndexPageNoIndex(t *testing.T) {
+	t.Parallel()
+
+	const noIndex = `<meta name="robots" content="noindex">`
+
+	for _, enabled := range []bool{false, true} {
+		ps := testHandlerPass()
+		ps.IndexMode = IndexModeLanding
+		ps.NoIndex = enabled
+
+		recorder := httptest.NewRecorder()
+		ps.IndexPage(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/", http.NoBody))
+
+		if got := strings.Contains(recorder.Body.String(), noIndex); got != enabled {
+			t.Errorf("NoIndex %t: got the noindex tag %t, want %t", enabled, got, enabled)
+		}
+	}
+}
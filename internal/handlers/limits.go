@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Path values end up in upstream URLs, so anything longer than a handle could be is turned away early.
+// Checking every segment covers all routes, without each handler having to do it
+func (ps *HandlerPass) LimitPathValues(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for segment := range strings.SplitSeq(r.URL.Path, "/") {
+			if len(segment) > ps.MaxPathValueLen {
+				ErrorPage(w, pageErrorf(ErrTooLong, "limitPathValues: Path values can be up to %d characters", ps.MaxPathValueLen))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
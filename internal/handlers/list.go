@@ -14,7 +14,8 @@ import (
 	"main/internal/types"
 )
 
-var listTemplate = template.Must(template.ParseFiles("./views/list.html"))
+// Parsed by LoadTemplates
+var listTemplate *template.Template
 
 func (ps *HandlerPass) GetList(w http.ResponseWriter, r *http.Request) {
 	profileID := r.PathValue("profileID")
@@ -31,66 +32,87 @@ func (ps *HandlerPass) GetList(w http.ResponseWriter, r *http.Request) {
 		editedPID = "at://" + editedPID
 	}
 
-	apiURL := fmt.Sprintf("https://public.api.bsky.app/xrpc/app.bsky.graph.getList?limit=1&list=%s/app.bsky.graph.list/%s", editedPID, listID)
+	apiURL := fmt.Sprintf("https://public.api.bsky.app/xrpc/app.bsky.graph.getList?limit=%d&list=%s/app.bsky.graph.list/%s", maxListAvatars, editedPID, listID)
 	if helpers.IsBlueskyDead.Load() {
-		apiURL = fmt.Sprintf("https://api.bsky.app/xrpc/app.bsky.graph.getList?limit=1&list=%s/app.bsky.graph.list/%s", editedPID, listID)
+		apiURL = fmt.Sprintf("https://api.bsky.app/xrpc/app.bsky.graph.getList?limit=%d&list=%s/app.bsky.graph.list/%s", maxListAvatars, editedPID, listID)
 	}
 
 	req, reqErr := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
 	if reqErr != nil {
-		ErrorPage(w, "getList: failed to create request")
+		ErrorPage(w, pageErrorf(ErrInternal, "getList: Failed to create request"))
 		return
 	}
 
-	resp, respErr := helpers.TimeoutClient.Do(req)
+	resp, respErr := helpers.CachedClient.Do(req)
 	if errors.Is(respErr, context.DeadlineExceeded) {
-		ErrorPage(w, "getList: Bluesky took too long to respond (timeout exceeded)")
+		ErrorPage(w, pageErrorf(ErrTimeout, "getList: Timeout exceeded"))
 		return
 	} else if respErr != nil {
-		ErrorPage(w, "getList: failed to do request")
+		ErrorPage(w, pageErrorf(ErrUpstream, "getList: Failed to do request"))
 		return
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		ErrorPage(w, fmt.Sprintf("getList: Unexpected status (%s)", resp.Status))
+		ErrorPage(w, upstreamStatusError("getList", resp))
 		return
 	}
 
 	var list types.APIList
-	if decodeErr := json.NewDecoder(resp.Body).Decode(&list); decodeErr != nil {
-		ErrorPage(w, "getList: failed to decode response")
+	decodeErr := json.NewDecoder(resp.Body).Decode(&list)
+	helpers.DebugDecode(r.Context(), "getList", decodeErr)
+
+	if decodeErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getList: Failed to decode response"))
 		return
 	}
 
-	if len(plcData.AKA) > 0 {
-		list.List.Creator.Handle = strings.TrimPrefix(plcData.AKA[0], "at://")
+	list.List.Creator.Handle = ps.preferredHandle(list.List.Creator.Handle, plcData)
 
-		if list.List.Creator.DisplayName == "" {
-			list.List.Creator.DisplayName = list.List.Creator.Handle
-		}
+	if list.List.Creator.DisplayName == "" {
+		list.List.Creator.DisplayName = list.List.Creator.Handle
 	}
 
+	printer := ps.localizer(w, r)
+
 	switch list.List.Purpose {
 	case modList:
-		list.List.Description = fmt.Sprintf("🚫 A moderation list by %s (@%s)\n\n%s", list.List.Creator.DisplayName, list.List.Creator.Handle, list.List.Description)
+		list.List.Description = printer.Sprintf(msgModListBy, list.List.Creator.DisplayName, list.List.Creator.Handle) + "\n\n" + list.List.Description
 	case curateList:
-		list.List.Description = fmt.Sprintf("👥 A curator list by %s (@%s)\n\n%s", list.List.Creator.DisplayName, list.List.Creator.Handle, list.List.Description)
+		list.List.Description = printer.Sprintf(msgCuratorListBy, list.List.Creator.DisplayName, list.List.Creator.Handle) + "\n\n" + list.List.Description
+	}
+
+	memberAvatars := listMemberAvatars(list)
+
+	if strings.HasPrefix(r.Host, "mosaic.") {
+		// Avatars are square already, crop anyway in case one isn't
+		opts, optsErr := parseMosaicOptions(r)
+		if optsErr != nil {
+			ErrorPage(w, optsErr)
+			return
+		}
+
+		opts.Crop = true
+
+		GenMosaic(w, r, memberAvatars, ps.withMosaicDefaults(opts), ps.newServerTiming())
+		return
 	}
 
 	if strings.HasPrefix(r.Host, "api.") {
 		w.Header().Set("Content-Type", "application/json")
 
 		if encodeErr := json.NewEncoder(w).Encode(&list); encodeErr != nil {
-			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrInternal, "Failed to encode JSON"))
 			return
 		}
 
 		return
 	}
 
-	isTelegramAgent := strings.Contains(r.Header.Get("User-Agent"), "Telegram")
+	list.List.Avatar = ps.avatarOrFallback(list.List.Avatar)
+
+	isTelegramAgent := detectCrawler(r.Header.Get("User-Agent")) == crawlerTelegram
 
 	encodedID := types.RichActivityEncoded{
 		Type:   "list",
@@ -100,9 +122,38 @@ func (ps *HandlerPass) GetList(w http.ResponseWriter, r *http.Request) {
 
 	marshaled, err := json.Marshal(encodedID)
 	if err != nil {
-		ErrorPage(w, "getList: failed to marshal for activity")
+		ErrorPage(w, pageErrorf(ErrInternal, "getList: Failed to marshal for activity"))
 		return
 	}
 
-	listTemplate.Execute(w, map[string]any{"list": list.List, "listID": listID, "isTelegram": isTelegramAgent, "encodedID": hex.EncodeToString(marshaled), "passData": ps})
+	ps.setPageCacheControl(w, CacheList)
+
+	listTemplate.Execute(w, listTemplateData{
+		List:         list.List,
+		ListID:       listID,
+		EncodedID:    hex.EncodeToString(marshaled),
+		BaseURL:      helpers.BaseURL(r, ps.TrustForwarded),
+		Members:      printer.Sprintf(msgMembers, helpers.ToNotation(list.List.ItemCount)),
+		IsTelegram:   isTelegramAgent,
+		MemberMosaic: len(memberAvatars) > 1,
+		PassData:     ps,
+	})
+}
+
+// The members' avatars, as images for GenMosaic (members without one are skipped)
+func listMemberAvatars(list types.APIList) types.APIImages {
+	var avatars []string
+	for _, item := range list.Items {
+		if item.Subject.Avatar != "" && len(avatars) < maxListAvatars {
+			avatars = append(avatars, item.Subject.Avatar)
+		}
+	}
+
+	images := make(types.APIImages, len(avatars))
+	for i, avatar := range avatars {
+		images[i].FullSize = avatar
+		images[i].AspectRatio = types.APIAspectRatio{Width: 1, Height: 1}
+	}
+
+	return images
 }
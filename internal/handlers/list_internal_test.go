@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetListMembers(t *testing.T) {
+	stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Host == "plc.directory":
+			w.Write([]byte("{}"))
+		case r.URL.Path == "/xrpc/app.bsky.graph.getList":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"list":{"name":"Friends","creator":{"did":"did:plc:abc","handle":"alice.test"},"listItemCount":12345}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{language: "", want: "<p>👥 12.3K members</p>"},
+		{language: "de", want: "<p>👥 12.3K Mitglieder</p>"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/lists/3klist", http.NoBody)
+		req.Header.Set("Accept-Language", test.language)
+		req.SetPathValue("profileID", "did:plc:abc")
+		req.SetPathValue("listID", "3klist")
+
+		recorder := httptest.NewRecorder()
+		testHandlerPass().GetList(recorder, req)
+
+		if body := recorder.Body.String(); !strings.Contains(body, test.want) {
+			t.Errorf("%q: got %s, want it to have %s", test.language, body, test.want)
+		}
+	}
+}
@@ -1,53 +1,517 @@
 package handlers
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"fmt"
 	"net/http"
-	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"main/internal/helpers"
 	"main/internal/types"
 )
 
-func GenMosaic(w http.ResponseWriter, r *http.Request, images types.APIImages) {
+type mosaicOptions struct {
+	// 1-100, 0 until the operator's default is filled in
+	Quality int
+	// "jpeg" or "webp"
+	Format string
+	// Only applies to webp, jpeg has no transparency
+	BorderRadius int
+	// "auto" (picked by the number of images), "horizontal", "vertical" or "grid"
+	Layout string
+	// Pixels between images
+	Gap int
+	// A line between images (in the middle of the gap, if there is one), 0 means none
+	SeparatorWidth int
+	// ffmpeg color (0xRRGGBB)
+	SeparatorColor string
+	// Crop every image to the same cell, instead of scaling them to a common side
+	Crop bool
+	// Drawn in the bottom right corner, only if watermarks are enabled
+	Watermark string
+	// Keep GIFs animated (only if every image is one), only if animated mosaics are enabled
+	Animated bool
+	// Leave out sensitive images, instead of blurring them
+	HideSensitive bool
+	// Redirect to the first image if ffmpeg gives us nothing usable, set by the operator
+	FallbackRedirect bool
+	// "jpeg", "webp" or "png" for when we redirect to the CDN instead, empty keeps whatever the CDN gave us
+	RedirectFormat string
+	// Check every image is there before handing them to ffmpeg, set by the operator
+	ValidateImages bool
+	// Limits of the finished mosaic cache, set by the operator
+	CacheEntries,
+	CacheBytes int
+	// Set by the operator, "ffmpeg" finds it in the PATH
+	FFmpegPath string
+	// How long ffmpeg waits on each image download, set by the operator
+	InputTimeout time.Duration
+	// ffmpeg wasn't found when the server started, see composeMosaic
+	NoFFmpeg bool
+}
+
+// Options come from the query, so the same link can be shared with different settings.
+// Invalid values are ignored and replaced with the defaults, except for the layout, there's no good guess for that one
+func parseMosaicOptions(r *http.Request) (mosaicOptions, error) {
+	query := r.URL.Query()
+
+	opts := mosaicOptions{
+		Format:         "jpeg",
+		Layout:         mosaicLayoutAuto,
+		SeparatorColor: "0xffffff",
+	}
+
+	// q is the short form, quality wins if both are there
+	for _, key := range []string{"q", "quality"} {
+		if quality, atoiErr := strconv.Atoi(query.Get(key)); atoiErr == nil && quality >= 1 && quality <= 100 {
+			opts.Quality = quality
+		}
+	}
+
+	switch format := strings.ToLower(query.Get("format")); format {
+	case "webp":
+		opts.Format = format
+		opts.RedirectFormat = format
+	// The CDN also has these, but we can't make a mosaic out of them
+	case "jpeg", "png":
+		opts.RedirectFormat = format
+	}
+
+	if radius, atoiErr := strconv.Atoi(query.Get("border-radius")); atoiErr == nil && radius > 0 {
+		opts.BorderRadius = min(radius, mosaicMaxBorderRadius)
+	}
+
+	switch layout := strings.ToLower(query.Get("layout")); layout {
+	case "":
+	case mosaicLayoutHorizontal, mosaicLayoutVertical, mosaicLayoutGrid:
+		opts.Layout = layout
+	default:
+		return opts, pageErrorf(ErrBadInput, "genMosaic: Unknown layout, it should be one of horizontal, vertical, grid")
+	}
+
+	if gap, atoiErr := strconv.Atoi(query.Get("gap")); atoiErr == nil && gap > 0 {
+		opts.Gap = min(gap, mosaicMaxGap)
+	}
+
+	if separator, atoiErr := strconv.Atoi(query.Get("separator")); atoiErr == nil && separator > 0 {
+		opts.SeparatorWidth = min(separator, mosaicMaxSeparator)
+	}
+
+	if color := strings.TrimPrefix(strings.ToLower(query.Get("separator-color")), "#"); isHexColor(color) {
+		opts.SeparatorColor = "0x" + color
+	}
+
+	opts.Crop = strings.ToLower(query.Get("fit")) == "crop"
+
+	if watermark := query.Get("watermark"); isValidWatermark(watermark) {
+		opts.Watermark = watermark
+	}
+
+	opts.Animated = query.Get("animated") == "1"
+	opts.HideSensitive = strings.ToLower(query.Get("sensitive")) == "hide"
+
+	return opts, nil
+}
+
+func GenMosaic(w http.ResponseWriter, r *http.Request, images types.APIImages, opts mosaicOptions, timing *serverTiming) {
+	if opts.HideSensitive {
+		var visible types.APIImages
+		for _, k := range images {
+			if !isSensitiveImage(k.Labels) {
+				visible = append(visible, k)
+			}
+		}
+
+		images = visible
+	}
+
 	switch len(images) {
 	case 0:
-		ErrorPage(w, "genMosaic: No images")
+		ErrorPage(w, pageErrorf(ErrNotFound, "genMosaic: No images"))
 		return
 	case 1:
-		http.Redirect(w, r, images[0].FullSize, http.StatusFound)
-		return
+		// A sensitive image still has to go through ffmpeg to get blurred
+		if !isSensitiveImage(images[0].Labels) {
+			http.Redirect(w, r, cdnFormat(images[0].FullSize, opts.RedirectFormat), http.StatusFound)
+			return
+		}
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
+	// ffmpeg can hang for a while on a dead URL, leave out the broken ones instead
+	if opts.ValidateImages {
+		start := time.Now()
+		images = reachableImages(r.Context(), images)
+		timing.track("validate", "image-validate", start)
+
+		if len(images) == 0 {
+			ErrorPage(w, pageErrorf(ErrUpstream, "genMosaic: None of the images could be loaded"))
+			return
+		}
+	}
+
+	// A single still image would turn the whole thing into a still anyway
+	if opts.Animated {
+		allGifs := true
+		for _, k := range images {
+			allGifs = allGifs && isGifImage(k.FullSize)
+		}
+
+		if allGifs {
+			opts.Format = "gif"
+		}
+	}
 
 	var args []string
-	var avgWidth int
+	var avgWidth, avgHeight, knownSizes int
+	// ffmpeg downloads the images itself, these stop it from waiting forever on a slow host (in microseconds, per input)
+	inputTimeout := strconv.FormatInt(opts.InputTimeout.Microseconds(), 10)
+
 	for _, k := range images {
-		args = append(args, "-i", k.FullSize)
-		avgWidth += int(k.AspectRatio.Width)
+		args = append(args, "-timeout", inputTimeout, "-rw_timeout", inputTimeout, "-i", k.FullSize)
+
+		// Bad dimensions would break the scaling, so only the sane ones count
+		if validAspectRatio(k.AspectRatio) {
+			avgWidth += int(k.AspectRatio.Width)
+			avgHeight += int(k.AspectRatio.Height)
+			knownSizes++
+		}
+	}
+
+	if knownSizes > 0 {
+		avgWidth = min(avgWidth/knownSizes, mosaicMaxSide)
+		avgHeight = min(avgHeight/knownSizes, mosaicMaxSide)
+	} else {
+		avgWidth, avgHeight = mosaicDefaultSide, mosaicDefaultSide
+	}
+
+	layout := mosaicLayout(opts.Layout, len(images))
+
+	// Even sizes, the encoders don't like odd ones
+	cellWidth, cellHeight := avgWidth-avgWidth%2, avgHeight-avgHeight%2
+
+	// No ffmpeg on this host, so they're put together here instead (jpeg, no watermark)
+	if opts.NoFFmpeg {
+		composeStart := time.Now()
+		output, composeErr := composeMosaic(r.Context(), images, layout, cellWidth, cellHeight, opts)
+		if composeErr != nil {
+			ErrorPage(w, pageErrorf(ErrUpstream, "genMosaic: Failed to compose (%s)", composeErr))
+			return
+		}
+
+		timing.track("compose", "mosaic", composeStart)
+		writeMosaic(w, r, images, opts, output, "image/jpeg", timing)
+
+		return
+	}
+
+	// Stacking horizontally needs the same height, vertically needs the same width
+	// The separator goes in the middle of the gap, so it's offset from the end by itself plus the other half of the gap
+	spacing := opts.Gap + opts.SeparatorWidth
+	separatorOffset := opts.SeparatorWidth + opts.Gap - opts.Gap/2
+
+	scaleFilter := fmt.Sprintf("scale=-2:%d", avgHeight)
+	padFilter := fmt.Sprintf("pad=iw+%d:ih:0:0", spacing)
+	separatorFilter := fmt.Sprintf("drawbox=x=iw-%d:y=0:w=%d:h=ih:color=%s:t=fill", separatorOffset, opts.SeparatorWidth, opts.SeparatorColor)
+	stackFilter := "hstack"
+
+	switch layout {
+	case mosaicLayoutVertical:
+		scaleFilter = fmt.Sprintf("scale=%d:-2", avgWidth)
+		padFilter = fmt.Sprintf("pad=iw:ih+%d:0:0", spacing)
+		separatorFilter = fmt.Sprintf("drawbox=x=0:y=ih-%d:w=iw:h=%d:color=%s:t=fill", separatorOffset, opts.SeparatorWidth, opts.SeparatorColor)
+		stackFilter = "vstack"
+	case mosaicLayoutGrid:
+		// Every cell is the same size, so the whole image fits in its cell (with bars) and the grid lines up.
+		// The spacing is left between the cells by xstack instead of padding each image
+		scaleFilter = fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[2]d:(ow-iw)/2:(oh-ih)/2", cellWidth, cellHeight)
+		padFilter = ""
+		separatorFilter = fmt.Sprintf("drawbox=x=%[1]d:y=0:w=%[3]d:h=ih:color=%[4]s:t=fill,drawbox=x=0:y=%[2]d:w=iw:h=%[3]d:color=%[4]s:t=fill", cellWidth+opts.Gap/2, cellHeight+opts.Gap/2, opts.SeparatorWidth, opts.SeparatorColor)
+		stackFilter = "xstack"
 	}
 
-	avgWidth /= len(images)
+	// Fill the (average sized) cell and cut off what sticks out, so mixed orientations line up
+	if opts.Crop {
+		scaleFilter = fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=increase,crop=%[1]d:%[2]d", cellWidth, cellHeight)
+	}
 
 	var filterComplex strings.Builder
 	for i := range images {
-		fmt.Fprintf(&filterComplex, "[%d:v]scale=%d:-2[m%d];", i, avgWidth, i)
+		fmt.Fprintf(&filterComplex, "[%d:v]%s", i, scaleFilter)
+
+		if isSensitiveImage(images[i].Labels) {
+			filterComplex.WriteString(",boxblur=20:5")
+		}
+
+		// No gap (or separator) after the last image
+		if spacing > 0 && padFilter != "" && i < len(images)-1 {
+			fmt.Fprintf(&filterComplex, ",%s", padFilter)
+
+			if opts.SeparatorWidth > 0 {
+				fmt.Fprintf(&filterComplex, ",%s", separatorFilter)
+			}
+		}
+
+		fmt.Fprintf(&filterComplex, "[m%d];", i)
 	}
 
-	for i := range images {
-		fmt.Fprintf(&filterComplex, "[m%d]", i)
+	// Stacking needs at least two, a single (sensitive) image just passes through
+	if len(images) > 1 {
+		for i := range images {
+			fmt.Fprintf(&filterComplex, "[m%d]", i)
+		}
+		fmt.Fprintf(&filterComplex, "%s=inputs=%d", stackFilter, len(images))
+
+		// Two columns, left to right then top to bottom. With 3 the last cell is left empty (black, like the gaps)
+		if layout == mosaicLayoutGrid {
+			positions := make([]string, len(images))
+			for i := range images {
+				positions[i] = fmt.Sprintf("%d_%d", (i%2)*(cellWidth+spacing), (i/2)*(cellHeight+spacing))
+			}
+
+			fmt.Fprintf(&filterComplex, ":layout=%s:fill=black", strings.Join(positions, "|"))
+
+			if opts.SeparatorWidth > 0 {
+				fmt.Fprintf(&filterComplex, ",%s", separatorFilter)
+			}
+		}
+	} else {
+		filterComplex.WriteString("[m0]null")
+	}
+
+	// Only safe characters get this far (see isValidWatermark), so nothing can break out of the text
+	if opts.Watermark != "" {
+		fmt.Fprintf(&filterComplex, ",drawtext=text='%s':fontsize=14:fontcolor=white:x=w-tw-10:y=h-th-10:shadowcolor=black:shadowx=1:shadowy=1", opts.Watermark)
+	}
+
+	// https://stackoverflow.com/a/62400465
+	if opts.Format == "webp" && opts.BorderRadius > 0 {
+		fmt.Fprintf(&filterComplex, ",format=yuva420p,geq=lum='p(X,Y)':cb='cb(X,Y)':cr='cr(X,Y)':a='if(gt(abs(W/2-X),W/2-%[1]d)*gt(abs(H/2-Y),H/2-%[1]d),if(lte(hypot(%[1]d-(W/2-abs(W/2-X)),%[1]d-(H/2-abs(H/2-Y))),%[1]d),255,0),255)'", opts.BorderRadius)
+	}
+
+	// One palette for the whole output, instead of the default (and much worse looking) one
+	if opts.Format == "gif" {
+		filterComplex.WriteString(",split[a][b];[a]palettegen[p];[b][p]paletteuse")
+	}
+
+	args = append(args, "-filter_complex", filterComplex.String())
+
+	var contentType string
+	switch opts.Format {
+	case "gif":
+		contentType = "image/gif"
+		args = append(args, "-f", "gif", "-loop", "0")
+	case "webp":
+		contentType = "image/webp"
+		args = append(args, "-f", "webp", "-c:v", "libwebp", "-quality", strconv.Itoa(opts.Quality))
+	default:
+		contentType = "image/jpeg"
+		// mjpeg's scale is inverted, 1 is the best, 31 is the worst (85 ends up as 5)
+		args = append(args, "-f", "image2pipe", "-c:v", "mjpeg", "-q:v", strconv.Itoa(int(31-(float64(opts.Quality-1)/99.0)*30)))
 	}
-	fmt.Fprintf(&filterComplex, "hstack=inputs=%d", len(images))
 
-	args = append(args, "-filter_complex", filterComplex.String(), "-f", "image2pipe", "-c:v", "mjpeg", "pipe:1")
+	args = append(args, "pipe:1")
 
-	//nolint:gosec // This is just ffmpeg, with the only external values being k.FullSize, which is from the API
-	cmd := exec.CommandContext(r.Context(), "ffmpeg", args...)
-	cmd.Stdout = w
+	// Same images with the same options come out of the cache (or wait for the run that's already going)
+	ffmpegStart := time.Now()
+	output, runErr := runMosaic(r.Context(), args, opts)
+	if runErr != nil {
+		ErrorPage(w, pageErrorf(ErrInternal, "genMosaic: Failed to run"))
+		return
+	}
 
-	if runErr := cmd.Run(); runErr != nil {
-		http.Error(w, "genMosaic: Failed to run", http.StatusInternalServerError)
+	timing.track("ffmpeg", "mosaic", ffmpegStart)
+	writeMosaic(w, r, images, opts, output, contentType, timing)
+}
+
+func writeMosaic(w http.ResponseWriter, r *http.Request, images types.APIImages, opts mosaicOptions, output []byte, contentType string, timing *serverTiming) {
+	// ffmpeg can exit fine without producing anything usable (if every download failed, for example)
+	if !isValidMosaicOutput(output, opts.Format) {
+		if opts.FallbackRedirect && !isSensitiveImage(images[0].Labels) {
+			http.Redirect(w, r, cdnFormat(images[0].FullSize, opts.RedirectFormat), http.StatusFound)
+			return
+		}
+
+		ErrorPage(w, pageErrorf(ErrInternal, "genMosaic: No usable output"))
 		return
 	}
+
+	timing.write(w)
+	w.Header().Set("Content-Type", contentType)
+	// Some fetchers (Telegram's) don't do well without it
+	w.Header().Set("Content-Length", strconv.Itoa(len(output)))
+	// The images of a post can't change, only the post itself can be deleted
+	w.Header().Set("Cache-Control", mosaicCacheControl)
+	w.Write(output)
+}
+
+// Checks that the output at least looks like the format we asked for
+func isValidMosaicOutput(output []byte, format string) bool {
+	if len(output) < mosaicMinOutputLen {
+		return false
+	}
+
+	switch format {
+	case "gif":
+		return bytes.HasPrefix(output, []byte("GIF8"))
+	case "webp":
+		return bytes.HasPrefix(output, []byte("RIFF")) && string(output[8:12]) == "WEBP"
+	default:
+		return bytes.HasPrefix(output, []byte{0xFF, 0xD8, 0xFF}) && bytes.HasSuffix(output, []byte{0xFF, 0xD9})
+	}
+}
+
+// The watermark ends up in an ffmpeg filter, so only allow characters that can't escape it
+func isValidWatermark(text string) bool {
+	if text == "" || len(text) > maxWatermarkLen {
+		return false
+	}
+
+	for _, c := range text {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && !strings.ContainsRune(" @.-_", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Only RRGGBB, names and the rest of ffmpeg's color syntax aren't worth validating
+func isHexColor(color string) bool {
+	if len(color) != 6 {
+		return false
+	}
+
+	for _, c := range color {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Labels that get an image blurred (or left out) in mosaics
+func isSensitiveImage(labels []types.APILabel) bool {
+	for _, label := range labels {
+		switch label.Val {
+		case "porn", "sexual", "nudity", "graphic-media", "gore":
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watermarks and animated mosaics are opt-in for the operator, and there may be a site-wide default watermark
+func (ps *HandlerPass) withMosaicDefaults(opts mosaicOptions) mosaicOptions {
+	// GIFs take a lot more CPU than a single frame
+	opts.Animated = opts.Animated && ps.MosaicAnimated
+	opts.FallbackRedirect = ps.MosaicFallback == MosaicFallbackRedirect
+	opts.ValidateImages = ps.MosaicValidateImages
+	opts.CacheEntries = ps.MosaicCacheEntries
+	opts.CacheBytes = ps.MosaicCacheBytes
+	opts.FFmpegPath = ps.FFmpegPath
+	opts.InputTimeout = ps.MosaicInputTimeout
+
+	// The compositor only makes jpegs
+	if !ps.FFmpegAvailable {
+		opts.NoFFmpeg = true
+		opts.Format = "jpeg"
+		opts.Animated = false
+	}
+
+	if opts.Quality == 0 {
+		opts.Quality = cmp.Or(ps.MosaicQuality, mosaicDefaultQuality)
+	}
+
+	if !ps.EnableWatermark {
+		opts.Watermark = ""
+	} else if opts.Watermark == "" && isValidWatermark(ps.WatermarkDefault) {
+		opts.Watermark = ps.WatermarkDefault
+	}
+
+	return opts
+}
+
+// CDN images end with the format (.../<cid>@jpeg), other URLs are left alone
+func cdnFormat(imageURL, format string) string {
+	if format == "" || !strings.HasPrefix(imageURL, "https://cdn.bsky.app/img/") {
+		return imageURL
+	}
+
+	if at := strings.LastIndex(imageURL, "@"); at > strings.LastIndex(imageURL, "/") {
+		imageURL = imageURL[:at]
+	}
+
+	return imageURL + "@" + format
+}
+
+// HEADs every image at once (a few at a time), keeping the ones that are actually images, in the same order
+func reachableImages(ctx context.Context, images types.APIImages) types.APIImages {
+	ctx, cancel := context.WithTimeout(ctx, mosaicValidateTimeout)
+	defer cancel()
+
+	reachable := make([]bool, len(images))
+	limiter := make(chan struct{}, mosaicValidateConcurrency)
+
+	var wg sync.WaitGroup
+	for i, k := range images {
+		wg.Go(func() {
+			select {
+			case limiter <- struct{}{}:
+				defer func() { <-limiter }()
+			case <-ctx.Done():
+				return
+			}
+
+			reachable[i] = isReachableImage(ctx, k.FullSize)
+		})
+	}
+
+	wg.Wait()
+
+	var kept types.APIImages
+	for i, k := range images {
+		if reachable[i] {
+			kept = append(kept, k)
+		}
+	}
+
+	return kept
+}
+
+func isReachableImage(ctx context.Context, imageURL string) bool {
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodHead, imageURL, http.NoBody)
+	if reqErr != nil {
+		return false
+	}
+
+	resp, respErr := helpers.TimeoutClient.Do(req)
+	if respErr != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "image/")
+}
+
+// Two side by side, three or four in a 2x2 grid, anything else (that wouldn't tile) in a column
+func mosaicLayout(layout string, count int) string {
+	if layout != mosaicLayoutAuto {
+		return layout
+	}
+
+	switch count {
+	case 2:
+		return mosaicLayoutHorizontal
+	case 3, 4:
+		return mosaicLayoutGrid
+	default:
+		return mosaicLayoutVertical
+	}
 }
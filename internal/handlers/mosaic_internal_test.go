@@ -0,0 +1,619 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/types"
+)
+
+// An ffmpeg that writes its arguments (one per line) to the returned file and answers with a small, valid looking JPEG
+func fakeFFmpeg(t *testing.T) (ffmpegPath, argsPath string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	ffmpegPath, argsPath = filepath.Join(dir, "ffmpeg"), filepath.Join(dir, "args")
+
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > '" + argsPath + "'\nprintf '\\377\\330\\377%0200d\\377\\331' 0\n"
+	//nolint:gosec // It has to be executable
+	if writeErr := os.WriteFile(ffmpegPath, []byte(script), 0o700); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+
+	return ffmpegPath, argsPath
+}
+
+// Square 100x100 images, with URLs unique to the test so nothing comes out of the mosaic cache
+func testImages(t *testing.T, count int) types.APIImages {
+	t.Helper()
+
+	images := make(types.APIImages, count)
+	for i := range images {
+		images[i].FullSize = "https://cdn.example.test/" + strings.ReplaceAll(t.Name(), "/", "_") + "/" + string(rune('a'+i)) + "@jpeg"
+		images[i].AspectRatio = types.APIAspectRatio{Width: 100, Height: 100}
+	}
+
+	return images
+}
+
+// The arguments GenMosaic ran ffmpeg with, for a request with query (it fails if ffmpeg wasn't run at all)
+func mosaicArgs(t *testing.T, query string, images types.APIImages) []string {
+	t.Helper()
+
+	ffmpegPath, argsPath := fakeFFmpeg(t)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/mosaic?"+query, http.NoBody)
+	opts, parseErr := parseMosaicOptions(req)
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+
+	opts = (&HandlerPass{FFmpegPath: ffmpegPath, FFmpegAvailable: true, MosaicQuality: 85}).withMosaicDefaults(opts)
+
+	// Only the arguments matter, the output (always a JPEG) is thrown away
+	GenMosaic(httptest.NewRecorder(), req, images, opts, &serverTiming{})
+
+	args, readErr := os.ReadFile(argsPath)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+
+	return strings.Split(strings.TrimSuffix(string(args), "\n"), "\n")
+}
+
+// The value that follows flag in args
+func argValue(t *testing.T, args []string, flag string) string {
+	t.Helper()
+
+	i := slices.Index(args, flag)
+	if i == -1 || i == len(args)-1 {
+		t.Fatalf("no %s in %q", flag, args)
+	}
+
+	return args[i+1]
+}
+
+func TestGenMosaicSeparator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		query  string
+		images int
+		// Every one of these has to be in the filter, count times
+		want  []string
+		count int
+	}{
+		{
+			name:   "none",
+			query:  "layout=horizontal",
+			images: 2,
+		},
+		{
+			name:   "horizontal",
+			query:  "layout=horizontal&separator=4&separator-color=%23FF0000",
+			images: 3,
+			want:   []string{"pad=iw+4:ih:0:0,drawbox=x=iw-4:y=0:w=4:h=ih:color=0xff0000:t=fill"},
+			// Not after the last image
+			count: 2,
+		},
+		{
+			name:   "vertical with a gap",
+			query:  "layout=vertical&separator=2&gap=4",
+			images: 2,
+			want:   []string{"pad=iw:ih+6:0:0,drawbox=x=0:y=ih-4:w=iw:h=2:color=0xffffff:t=fill"},
+			count:  1,
+		},
+		{
+			name:   "grid",
+			query:  "layout=grid&separator=2&gap=4&separator-color=00ff00",
+			images: 4,
+			// Both lines, once over the whole grid
+			want:  []string{"xstack=inputs=4:layout=0_0|106_0|0_106|106_106:fill=black,drawbox=x=102:y=0:w=2:h=ih:color=0x00ff00:t=fill,drawbox=x=0:y=102:w=iw:h=2:color=0x00ff00:t=fill"},
+			count: 1,
+		},
+		{
+			name:   "bad color",
+			query:  "layout=horizontal&separator=1&separator-color=red",
+			images: 2,
+			want:   []string{"drawbox=x=iw-1:y=0:w=1:h=ih:color=0xffffff:t=fill"},
+			count:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			filter := argValue(t, mosaicArgs(t, test.query, testImages(t, test.images)), "-filter_complex")
+
+			if len(test.want) == 0 && strings.Contains(filter, "drawbox") {
+				t.Errorf("got a separator in %q, want none", filter)
+			}
+
+			for _, want := range test.want {
+				if got := strings.Count(filter, want); got != test.count {
+					t.Errorf("got %q %d times in %q, want %d", want, got, filter, test.count)
+				}
+			}
+		})
+	}
+}
+
+func TestGenMosaicQuality(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		query string
+		flag  string
+		want  string
+	}{
+		{name: "default", query: "", flag: "-q:v", want: "5"},
+		{name: "best", query: "quality=100", flag: "-q:v", want: "1"},
+		{name: "worst", query: "quality=1", flag: "-q:v", want: "31"},
+		{name: "short form", query: "q=50", flag: "-q:v", want: "16"},
+		{name: "long form wins", query: "q=1&quality=100", flag: "-q:v", want: "1"},
+		{name: "out of range", query: "quality=101", flag: "-q:v", want: "5"},
+		{name: "webp", query: "format=webp&q=70", flag: "-quality", want: "70"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := argValue(t, mosaicArgs(t, test.query, testImages(t, 2)), test.flag); got != test.want {
+				t.Errorf("got %s %s, want %s", test.flag, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenMosaicCrop(t *testing.T) {
+	t.Parallel()
+
+	// 300x200 and 101x100 average out to 200x150, already even
+	const cropped = "scale=200:150:force_original_aspect_ratio=increase,crop=200:150"
+
+	tests := []struct {
+		name  string
+		query string
+		// Each image's own scale, if it isn't cropped
+		want     string
+		wantCrop bool
+	}{
+		{name: "horizontal", query: "layout=horizontal&fit=crop", wantCrop: true},
+		{name: "vertical", query: "layout=vertical&fit=crop", wantCrop: true},
+		{name: "grid", query: "layout=grid&fit=crop", wantCrop: true},
+		{name: "any case", query: "layout=horizontal&fit=CROP", wantCrop: true},
+		{name: "horizontal, not cropped", query: "layout=horizontal", want: "scale=-2:150"},
+		{name: "vertical, not cropped", query: "layout=vertical", want: "scale=200:-2"},
+		{name: "grid, not cropped", query: "layout=grid", want: "scale=200:150:force_original_aspect_ratio=decrease,pad=200:150:(ow-iw)/2:(oh-ih)/2"},
+		{name: "unknown fit", query: "layout=horizontal&fit=stretch", want: "scale=-2:150"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			images := testImages(t, 2)
+			images[0].AspectRatio = types.APIAspectRatio{Width: 300, Height: 200}
+			images[1].AspectRatio = types.APIAspectRatio{Width: 101, Height: 100}
+
+			filter := argValue(t, mosaicArgs(t, test.query, images), "-filter_complex")
+
+			wantCount := 0
+			if test.wantCrop {
+				wantCount = len(images)
+			}
+
+			if got := strings.Count(filter, cropped); got != wantCount {
+				t.Errorf("got %q %d times in %q, want %d", cropped, got, filter, wantCount)
+			}
+
+			for i := range images {
+				if want := "[" + string(rune('0'+i)) + ":v]" + test.want; !test.wantCrop && !strings.Contains(filter, want) {
+					t.Errorf("no %q in %q", want, filter)
+				}
+			}
+		})
+	}
+}
+
+func TestGenMosaicBadAspectRatio(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		aspectRatios []types.APIAspectRatio
+		// The scale every image gets (a horizontal layout only goes by the height)
+		want string
+	}{
+		{name: "all fine", aspectRatios: []types.APIAspectRatio{{Width: 300, Height: 200}, {Width: 300, Height: 400}}, want: "scale=-2:300"},
+		// Left out of the average, instead of dragging it below zero
+		{name: "one negative", aspectRatios: []types.APIAspectRatio{{Width: 300, Height: 200}, {Width: 300, Height: -4000}}, want: "scale=-2:200"},
+		{name: "one zero", aspectRatios: []types.APIAspectRatio{{Width: 0, Height: 0}, {Width: 300, Height: 400}}, want: "scale=-2:400"},
+		{name: "none fine", aspectRatios: []types.APIAspectRatio{{Width: -300, Height: 200}, {Width: 300, Height: 0}}, want: "scale=-2:1000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			images := testImages(t, len(test.aspectRatios))
+			for i, aspectRatio := range test.aspectRatios {
+				images[i].AspectRatio = aspectRatio
+			}
+
+			filter := argValue(t, mosaicArgs(t, "layout=horizontal", images), "-filter_complex")
+
+			if got := strings.Count(filter, test.want); got != len(images) {
+				t.Errorf("got %q %d times in %q, want %d", test.want, got, filter, len(images))
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestReachableImages(t *testing.T) {
+	stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("got a %s request, want HEAD", r.Method)
+		}
+
+		switch r.URL.Path {
+		case "/ok.jpg", "/also-ok.png":
+			w.Header().Set("Content-Type", "image/jpeg")
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+		case "/gone.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	paths := []string{"/gone.jpg", "/ok.jpg", "/html", "/broken.jpg", "/also-ok.png"}
+	images := make(types.APIImages, len(paths))
+	for i, path := range paths {
+		images[i].FullSize = "https://cdn.example.test" + path
+	}
+
+	var got []string
+	for _, image := range reachableImages(t.Context(), images) {
+		got = append(got, strings.TrimPrefix(image.FullSize, "https://cdn.example.test"))
+	}
+
+	// In their original order
+	if want := []string{"/ok.jpg", "/also-ok.png"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostMixedLabels(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-mixed-labels.json")
+
+	const cdn = "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/"
+
+	tests := []struct {
+		name  string
+		query string
+		// The images ffmpeg gets, in order
+		wantInputs []string
+		// Which of them are blurred
+		wantBlurred []bool
+	}{
+		{
+			name:        "blurred",
+			query:       "",
+			wantInputs:  []string{cdn + "bafkclean@jpeg", cdn + "bafknsfw@jpeg", cdn + "bafkspoiler@jpeg"},
+			wantBlurred: []bool{false, true, false},
+		},
+		{
+			name:        "left out",
+			query:       "sensitive=hide",
+			wantInputs:  []string{cdn + "bafkclean@jpeg", cdn + "bafkspoiler@jpeg"},
+			wantBlurred: []bool{false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ffmpegPath, argsPath := fakeFFmpeg(t)
+
+			ps := testHandlerPass()
+			ps.FFmpegPath, ps.FFmpegAvailable = ffmpegPath, true
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://raw.example.test/profile/did:plc:abc/post/3kpost?"+tt.query, http.NoBody)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			recorder := httptest.NewRecorder()
+			ps.GetPost(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			rawArgs, readErr := os.ReadFile(argsPath)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+
+			args := strings.Split(strings.TrimSuffix(string(rawArgs), "\n"), "\n")
+
+			var inputs []string
+			for i, arg := range args[:len(args)-1] {
+				if arg == "-i" {
+					inputs = append(inputs, args[i+1])
+				}
+			}
+
+			if !slices.Equal(inputs, tt.wantInputs) {
+				t.Fatalf("inputs = %q, want %q", inputs, tt.wantInputs)
+			}
+
+			// One filter per image, then the stacking
+			filters := strings.Split(argValue(t, args, "-filter_complex"), ";")
+			for i, wantBlurred := range tt.wantBlurred {
+				if got := strings.Contains(filters[i], "boxblur"); got != wantBlurred {
+					t.Errorf("image %d (%s) blurred = %t, want %t: %q", i, inputs[i], got, wantBlurred, filters[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGenMosaicSingleSensitive(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		query      string
+		sensitive  []bool
+		wantStatus int
+		// Only for redirects, which image it goes to
+		wantLocation int
+	}{
+		{name: "clean", sensitive: []bool{false}, wantStatus: http.StatusFound},
+		// Never redirected to, it has to be blurred first
+		{name: "sensitive", sensitive: []bool{true}, wantStatus: http.StatusOK},
+		{name: "one left", query: "sensitive=hide", sensitive: []bool{true, false}, wantStatus: http.StatusFound, wantLocation: 1},
+		{name: "none left", query: "sensitive=hide", sensitive: []bool{true, true}, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			images := testImages(t, len(tt.sensitive))
+			for i, sensitive := range tt.sensitive {
+				if sensitive {
+					images[i].Labels = []types.APILabel{{Val: "porn"}}
+				}
+			}
+
+			ffmpegPath, _ := fakeFFmpeg(t)
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/mosaic?"+tt.query, http.NoBody)
+			opts, parseErr := parseMosaicOptions(req)
+			if parseErr != nil {
+				t.Fatal(parseErr)
+			}
+
+			opts = (&HandlerPass{FFmpegPath: ffmpegPath, FFmpegAvailable: true}).withMosaicDefaults(opts)
+
+			recorder := httptest.NewRecorder()
+			GenMosaic(recorder, req, images, opts, &serverTiming{})
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusFound {
+				return
+			}
+
+			if got := recorder.Header().Get("Location"); !strings.HasPrefix(got, strings.TrimSuffix(images[tt.wantLocation].FullSize, "@jpeg")) {
+				t.Errorf("Location = %q, want image %d", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestGenMosaicUnusableOutput(t *testing.T) {
+	t.Parallel()
+
+	jpeg := append(append([]byte{0xFF, 0xD8, 0xFF}, bytes.Repeat([]byte{0}, 200)...), 0xFF, 0xD9)
+
+	tests := []struct {
+		name      string
+		output    []byte
+		fallback  string
+		sensitive bool
+		// Redirects always go to the first image
+		wantStatus int
+	}{
+		{name: "fine", output: jpeg, fallback: MosaicFallbackRedirect, wantStatus: http.StatusOK},
+		{name: "empty", output: nil, fallback: MosaicFallbackError, wantStatus: http.StatusInternalServerError},
+		{name: "empty, redirected", output: nil, fallback: MosaicFallbackRedirect, wantStatus: http.StatusFound},
+		{name: "too short", output: jpeg[:50], fallback: MosaicFallbackRedirect, wantStatus: http.StatusFound},
+		{name: "cut off", output: jpeg[:len(jpeg)-2], fallback: MosaicFallbackRedirect, wantStatus: http.StatusFound},
+		{name: "not a JPEG", output: bytes.Repeat([]byte("<html>"), 50), fallback: MosaicFallbackRedirect, wantStatus: http.StatusFound},
+		// It would show what was supposed to be blurred
+		{name: "empty, sensitive", output: nil, fallback: MosaicFallbackRedirect, sensitive: true, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			outputPath, ffmpegPath := filepath.Join(dir, "output"), filepath.Join(dir, "ffmpeg")
+
+			if writeErr := os.WriteFile(outputPath, tt.output, 0o600); writeErr != nil {
+				t.Fatal(writeErr)
+			}
+
+			//nolint:gosec // It has to be executable
+			if writeErr := os.WriteFile(ffmpegPath, []byte("#!/bin/sh\ncat '"+outputPath+"'\n"), 0o700); writeErr != nil {
+				t.Fatal(writeErr)
+			}
+
+			images := testImages(t, 2)
+			if tt.sensitive {
+				images[0].Labels = []types.APILabel{{Val: "gore"}}
+			}
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/mosaic", http.NoBody)
+			opts, parseErr := parseMosaicOptions(req)
+			if parseErr != nil {
+				t.Fatal(parseErr)
+			}
+
+			opts = (&HandlerPass{FFmpegPath: ffmpegPath, FFmpegAvailable: true, MosaicFallback: tt.fallback}).withMosaicDefaults(opts)
+
+			recorder := httptest.NewRecorder()
+			GenMosaic(recorder, req, images, opts, &serverTiming{})
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			switch tt.wantStatus {
+			case http.StatusOK:
+				if !bytes.Equal(recorder.Body.Bytes(), jpeg) {
+					t.Errorf("got %d bytes, want the %d ffmpeg wrote", recorder.Body.Len(), len(jpeg))
+				}
+			case http.StatusFound:
+				if got := recorder.Header().Get("Location"); !strings.HasPrefix(got, strings.TrimSuffix(images[0].FullSize, "@jpeg")) {
+					t.Errorf("Location = %q, want the first image", got)
+				}
+			}
+		})
+	}
+}
+
+func TestCDNFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		imageURL string
+		format   string
+		want     string
+	}{
+		{imageURL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkimage@jpeg", format: "webp", want: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkimage@webp"},
+		{imageURL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkimage", format: "png", want: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkimage@png"},
+		{imageURL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkimage@jpeg", format: "", want: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkimage@jpeg"},
+		// The @ in the DID isn't the format
+		{imageURL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:web:a@b/bafkimage", format: "webp", want: "https://cdn.bsky.app/img/feed_fullsize/plain/did:web:a@b/bafkimage@webp"},
+		{imageURL: "https://media.tenor.com/abc/tenor.gif", format: "webp", want: "https://media.tenor.com/abc/tenor.gif"},
+	}
+
+	for _, tt := range tests {
+		if got := cdnFormat(tt.imageURL, tt.format); got != tt.want {
+			t.Errorf("cdnFormat(%q, %q) = %q, want %q", tt.imageURL, tt.format, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostRawFormat(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-single-image.json")
+
+	const image = "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkonly"
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: image + "@jpeg"},
+		{query: "format=webp", want: image + "@webp"},
+		{query: "format=png", want: image + "@png"},
+		{query: "format=JPEG", want: image + "@jpeg"},
+		// Not something the CDN has, so it's left as it is
+		{query: "format=gif", want: image + "@jpeg"},
+		{query: "format=../../avatar", want: image + "@jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			recorder := requestPost(t, "raw.example.test", tt.query, "")
+			if recorder.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusFound)
+			}
+
+			if got := recorder.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenMosaicInputTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		images  int
+		// In microseconds, like ffmpeg takes it
+		want string
+	}{
+		{name: "default", timeout: 10 * time.Second, images: 2, want: "10000000"},
+		{name: "below a second", timeout: 1500 * time.Millisecond, images: 3, want: "1500000"},
+		{name: "four images", timeout: time.Minute, images: 4, want: "60000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ffmpegPath, argsPath := fakeFFmpeg(t)
+			ps := &HandlerPass{FFmpegPath: ffmpegPath, FFmpegAvailable: true, MosaicQuality: 85, MosaicInputTimeout: tt.timeout}
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/mosaic", http.NoBody)
+			opts, parseErr := parseMosaicOptions(req)
+			if parseErr != nil {
+				t.Fatal(parseErr)
+			}
+
+			GenMosaic(httptest.NewRecorder(), req, testImages(t, tt.images), ps.withMosaicDefaults(opts), &serverTiming{})
+
+			output, readErr := os.ReadFile(argsPath)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+
+			args := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+
+			// Both of them, before every input (they only apply to the next one)
+			var inputs int
+			for i, arg := range args {
+				if arg != "-i" {
+					continue
+				}
+
+				inputs++
+
+				if i < 4 || !slices.Equal(args[i-4:i], []string{"-timeout", tt.want, "-rw_timeout", tt.want}) {
+					t.Errorf("input %d (%s) doesn't have -timeout and -rw_timeout %s before it: %q", inputs, args[i+1], tt.want, args)
+				}
+			}
+
+			if inputs != tt.images {
+				t.Errorf("got %d inputs, want %d: %q", inputs, tt.images, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type (
+	mosaicCacheEntry struct {
+		key    string
+		output []byte
+	}
+
+	// Finished mosaics, the least recently used one goes first when it's full
+	mosaicCache struct {
+		mu      sync.Mutex
+		order   *list.List
+		entries map[string]*list.Element
+		bytes   int
+	}
+)
+
+var (
+	mosaicResults = &mosaicCache{order: list.New(), entries: make(map[string]*list.Element)}
+
+	// Requests for a mosaic that's already being made wait for it, instead of starting another ffmpeg
+	mosaicRuns singleflight.Group
+
+	// Runs aren't tied to a request, so shutting down stops them with this (see StopMosaics)
+	mosaicRunsCtx, stopMosaicRuns = context.WithCancel(context.Background())
+	mosaicRunsActive              sync.WaitGroup
+	// Held while a run is counted in (or the runs are stopped), so nothing is added to mosaicRunsActive once StopMosaics is waiting on it
+	mosaicRunsMu sync.Mutex
+
+	errMosaicsStopped = errors.New("mosaics are stopped")
+)
+
+// The ffmpeg arguments are everything that decides the output: the image URLs (in order, since that's the layout), the filters, the format and the quality
+func mosaicCacheKey(args []string) string {
+	return strings.Join(args, "\x00")
+}
+
+func runMosaic(ctx context.Context, args []string, opts mosaicOptions) ([]byte, error) {
+	return sharedMosaic(ctx, mosaicCacheKey(args), opts, func(runCtx context.Context) ([]byte, error) {
+		//nolint:gosec // This is just ffmpeg, with the only external values being the image URLs, which are from the API
+		cmd := exec.CommandContext(runCtx, opts.FFmpegPath, args...)
+
+		// Buffered instead of streamed, so bad output can still be replaced with something else
+		var output bytes.Buffer
+		cmd.Stdout = &output
+
+		if runErr := cmd.Run(); runErr != nil {
+			return nil, runErr
+		}
+
+		return output.Bytes(), nil
+	})
+}
+
+// Renders (with ffmpeg or the compositor) once per key at a time. The render isn't tied to the request that started it, since others may be waiting on it too
+func sharedMosaic(ctx context.Context, key string, opts mosaicOptions, render func(context.Context) ([]byte, error)) ([]byte, error) {
+	if output, ok := mosaicResults.get(key); ok {
+		return output, nil
+	}
+
+	resultChan := mosaicRuns.DoChan(key, func() (any, error) {
+		mosaicRunsMu.Lock()
+		if mosaicRunsCtx.Err() != nil {
+			mosaicRunsMu.Unlock()
+			return nil, errMosaicsStopped
+		}
+
+		mosaicRunsActive.Add(1)
+		mosaicRunsMu.Unlock()
+
+		defer mosaicRunsActive.Done()
+
+		runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mosaicRunTimeout)
+		defer cancel()
+
+		stopAfter := context.AfterFunc(mosaicRunsCtx, cancel)
+		defer stopAfter()
+
+		output, renderErr := render(runCtx)
+		if renderErr != nil {
+			return nil, renderErr
+		}
+
+		// Unusable output isn't kept, the images may load next time
+		if isValidMosaicOutput(output, opts.Format) {
+			mosaicResults.put(key, output, opts.CacheEntries, opts.CacheBytes)
+		}
+
+		return output, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-resultChan:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+
+		output, _ := result.Val.([]byte)
+
+		return output, nil
+	}
+}
+
+// Stops whatever is still rendering (killing ffmpeg) and waits for it to finish, for after the server stopped taking requests
+func StopMosaics() {
+	mosaicRunsMu.Lock()
+	stopMosaicRuns()
+	mosaicRunsMu.Unlock()
+
+	mosaicRunsActive.Wait()
+}
+
+func (mc *mosaicCache) get(key string) ([]byte, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	element, ok := mc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	mc.order.MoveToFront(element)
+
+	entry, _ := element.Value.(mosaicCacheEntry)
+
+	return entry.output, true
+}
+
+// Limits come from the operator, 0 entries turns the cache off
+func (mc *mosaicCache) put(key string, output []byte, maxEntries, maxBytes int) {
+	if maxEntries <= 0 || len(output) > maxBytes {
+		return
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if element, ok := mc.entries[key]; ok {
+		mc.remove(element)
+	}
+
+	for mc.order.Len() >= maxEntries || mc.bytes+len(output) > maxBytes {
+		mc.remove(mc.order.Back())
+	}
+
+	mc.entries[key] = mc.order.PushFront(mosaicCacheEntry{key: key, output: output})
+	mc.bytes += len(output)
+}
+
+// mu has to be held
+func (mc *mosaicCache) remove(element *list.Element) {
+	entry, _ := element.Value.(mosaicCacheEntry)
+
+	mc.order.Remove(element)
+	delete(mc.entries, entry.key)
+	mc.bytes -= len(entry.output)
+}
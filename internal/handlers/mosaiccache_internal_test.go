@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestMosaicCache() *mosaicCache {
+	return &mosaicCache{order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func TestMosaicCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	// A get if there's no output, a put otherwise
+	type cacheStep struct {
+		key    string
+		output []byte
+	}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int
+		// In this order
+		steps         []cacheStep
+		kept, evicted []string
+	}{
+		{
+			name:       "least recently used goes first",
+			maxEntries: 2,
+			maxBytes:   100,
+			steps:      []cacheStep{{"a", []byte("a")}, {"b", []byte("b")}, {"a", nil}, {"c", []byte("c")}},
+			kept:       []string{"a", "c"},
+			evicted:    []string{"b"},
+		},
+		{
+			name:       "over the byte limit",
+			maxEntries: 10,
+			maxBytes:   10,
+			steps:      []cacheStep{{"a", []byte("aaaaaa")}, {"b", []byte("bbbbbb")}},
+			kept:       []string{"b"},
+			evicted:    []string{"a"},
+		},
+		{
+			name:       "too big to keep",
+			maxEntries: 10,
+			maxBytes:   4,
+			steps:      []cacheStep{{"a", []byte("aaa")}, {"b", []byte("bbbbb")}},
+			kept:       []string{"a"},
+			evicted:    []string{"b"},
+		},
+		{
+			name:       "turned off",
+			maxEntries: 0,
+			maxBytes:   100,
+			steps:      []cacheStep{{"a", []byte("a")}},
+			evicted:    []string{"a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache := newTestMosaicCache()
+			for _, step := range test.steps {
+				if step.output == nil {
+					cache.get(step.key)
+					continue
+				}
+
+				cache.put(step.key, step.output, test.maxEntries, test.maxBytes)
+			}
+
+			for _, key := range test.kept {
+				if _, ok := cache.get(key); !ok {
+					t.Errorf("%s was evicted, want it kept", key)
+				}
+			}
+
+			for _, key := range test.evicted {
+				if _, ok := cache.get(key); ok {
+					t.Errorf("%s was kept, want it evicted", key)
+				}
+			}
+
+			if cache.bytes > test.maxBytes || cache.order.Len() != len(cache.entries) {
+				t.Errorf("got %d bytes in %d entries (%d in the map), want at most %d bytes", cache.bytes, cache.order.Len(), len(cache.entries), test.maxBytes)
+			}
+		})
+	}
+}
+
+func TestSharedMosaicCoalesces(t *testing.T) {
+	t.Parallel()
+
+	opts := mosaicOptions{Format: "jpeg", CacheEntries: 10, CacheBytes: 1 << 20}
+	output := append(append([]byte{0xFF, 0xD8, 0xFF}, make([]byte, mosaicMinOutputLen)...), 0xFF, 0xD9)
+
+	var renders atomic.Int32
+	release := make(chan struct{})
+	render := func(context.Context) ([]byte, error) {
+		renders.Add(1)
+		<-release
+
+		return output, nil
+	}
+
+	// Whoever comes after the run finished gets it from the cache instead, it's still one render either way
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			got, renderErr := sharedMosaic(t.Context(), t.Name(), opts, render)
+			if renderErr != nil || !bytes.Equal(got, output) {
+				t.Errorf("got %d bytes (%v), want the render's %d", len(got), renderErr, len(output))
+			}
+		})
+	}
+
+	close(release)
+	wg.Wait()
+
+	if got := renders.Load(); got != 1 {
+		t.Errorf("rendered %d times, want once", got)
+	}
+}
+
+func TestSharedMosaicDoesNotKeepErrors(t *testing.T) {
+	t.Parallel()
+
+	opts := mosaicOptions{Format: "jpeg", CacheEntries: 10, CacheBytes: 1 << 20}
+	renderErr := errors.New("render failed")
+
+	var renders int
+	render := func(context.Context) ([]byte, error) {
+		renders++
+		return nil, renderErr
+	}
+
+	for range 2 {
+		if _, gotErr := sharedMosaic(t.Context(), t.Name(), opts, render); !errors.Is(gotErr, renderErr) {
+			t.Errorf("got %v, want %v", gotErr, renderErr)
+		}
+	}
+
+	if renders != 2 {
+		t.Errorf("rendered %d times, want every time it failed", renders)
+	}
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"main/internal/helpers"
 	"main/internal/types"
@@ -25,59 +29,61 @@ func (ps *HandlerPass) GenOembed(w http.ResponseWriter, r *http.Request) {
 	case "profile":
 		followers, followersErr := strconv.ParseInt(r.URL.Query().Get("followers"), 10, 64)
 		if followersErr != nil {
-			http.Error(w, "genOembed: followers ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: followers ParseInt failed"))
 			return
 		}
 
 		follows, followsErr := strconv.ParseInt(r.URL.Query().Get("follows"), 10, 64)
 		if followsErr != nil {
-			http.Error(w, "genOembed: follows ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: follows ParseInt failed"))
 			return
 		}
 
 		posts, postsErr := strconv.ParseInt(r.URL.Query().Get("posts"), 10, 64)
 		if postsErr != nil {
-			http.Error(w, "genOembed: posts ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: posts ParseInt failed"))
 			return
 		}
 
 		labeler, labelerErr := strconv.ParseBool(r.URL.Query().Get("labeler"))
 		if labelerErr != nil {
-			http.Error(w, "genOembed: labeler ParseBool failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: labeler ParseBool failed"))
 			return
 		}
 
-		embed.AuthorName = fmt.Sprintf("👥 %s Followers - 🌐 %s Following - ✍️ %s Posts", helpers.ToNotation(followers), helpers.ToNotation(follows), helpers.ToNotation(posts))
+		printer := ps.localizer(w, r)
+
+		embed.AuthorName = printer.Sprintf(msgProfileStats, helpers.ToNotation(followers), helpers.ToNotation(follows), helpers.ToNotation(posts))
 
 		if labeler {
-			embed.AuthorName += " - 🏷️ Labeler"
+			embed.AuthorName += " - " + printer.Sprintf(msgLabeler)
 		}
 	case "post":
 		replies, repliesErr := strconv.ParseInt(r.URL.Query().Get("replies"), 10, 64)
 		if repliesErr != nil {
-			http.Error(w, "genOembed: replies ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: replies ParseInt failed"))
 			return
 		}
 
 		reposts, repostsErr := strconv.ParseInt(r.URL.Query().Get("reposts"), 10, 64)
 		if repostsErr != nil {
-			http.Error(w, "genOembed: reposts ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: reposts ParseInt failed"))
 			return
 		}
 
 		likes, likesErr := strconv.ParseInt(r.URL.Query().Get("likes"), 10, 64)
 		if likesErr != nil {
-			http.Error(w, "genOembed: likes ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: likes ParseInt failed"))
 			return
 		}
 
 		quotes, quotesErr := strconv.ParseInt(r.URL.Query().Get("quotes"), 10, 64)
 		if quotesErr != nil {
-			http.Error(w, "genOembed: quotes ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: quotes ParseInt failed"))
 			return
 		}
 
-		embed.AuthorName = fmt.Sprintf("💬 %s   🔁 %s   🩷 %s   📝 %s", helpers.ToNotation(replies), helpers.ToNotation(reposts), helpers.ToNotation(likes), helpers.ToNotation(quotes))
+		embed.AuthorName = ps.formatStats(replies, reposts, likes, quotes)
 
 		theDesc := r.URL.Query().Get("description")
 		if theDesc != "" {
@@ -85,18 +91,23 @@ func (ps *HandlerPass) GenOembed(w http.ResponseWriter, r *http.Request) {
 
 			theDesc, unescErr = url.PathUnescape(theDesc)
 			if unescErr != nil {
-				http.Error(w, "genOembed: description url.PathUnescape failed", http.StatusInternalServerError)
+				ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: description url.PathUnescape failed"))
 				return
 			}
 
+			// The stats are mostly emoji (4 bytes each), don't let them eat the whole budget
+			if len(embed.AuthorName) > maxStatsLen {
+				embed.AuthorName = cutAtRune(embed.AuthorName, maxStatsLen)
+			}
+
 			cutLen := maxAuthorLen - len(embed.AuthorName+"\n\n")
 			cutLen = max(cutLen, 0) // if cutLen < 0 {cutLen = 0}
 
 			if len(theDesc) > cutLen {
 				if cutLen >= ellipsisLen {
-					theDesc = theDesc[:cutLen-ellipsisLen] + "..."
+					theDesc = cutAtRune(theDesc, cutLen-ellipsisLen) + "..."
 				} else {
-					theDesc = theDesc[:cutLen]
+					theDesc = cutAtRune(theDesc, cutLen)
 				}
 			}
 
@@ -107,45 +118,119 @@ func (ps *HandlerPass) GenOembed(w http.ResponseWriter, r *http.Request) {
 		if mediaMessage != "" {
 			embed.ProviderName = fmt.Sprintf("%s | %s", embed.ProviderName, mediaMessage)
 		}
+
+		if r.URL.Query().Get("video") != "" {
+			if videoErr := oembedVideo(r.URL.Query(), &embed); videoErr != nil {
+				ErrorJSON(w, videoErr)
+				return
+			}
+		}
 	case "feed":
 		likes, likesErr := strconv.ParseInt(r.URL.Query().Get("likes"), 10, 64)
 		if likesErr != nil {
-			http.Error(w, "genOembed: likes ParseInt failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: likes ParseInt failed"))
 			return
 		}
 
 		online, onlineErr := strconv.ParseBool(r.URL.Query().Get("online"))
 		if onlineErr != nil {
-			http.Error(w, "genOembed: online ParseBool failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: online ParseBool failed"))
 			return
 		}
 
 		valid, validErr := strconv.ParseBool(r.URL.Query().Get("valid"))
 		if validErr != nil {
-			http.Error(w, "genOembed: valid ParseBool failed", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: valid ParseBool failed"))
 			return
 		}
 
-		embed.AuthorName = fmt.Sprintf("🩷 %s Likes", helpers.ToNotation(likes))
+		printer := ps.localizer(w, r)
 
-		if online {
-			embed.AuthorName += " - ✅ Online"
-		} else {
-			embed.AuthorName += " - ❌ Not online"
+		embed.AuthorName = printer.Sprintf(msgFeedLikes, helpers.ToNotation(likes)) + " - " + feedStatusBadges(printer, &online, &valid)
+	case "list":
+		itemCount, itemCountErr := strconv.ParseInt(r.URL.Query().Get("itemCount"), 10, 64)
+		if itemCountErr != nil {
+			ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: itemCount ParseInt failed"))
+			return
 		}
 
-		if valid {
-			embed.AuthorName += " - ✅ Valid"
-		} else {
-			embed.AuthorName += " - ❌ Not valid"
-		}
+		embed.AuthorName = ps.localizer(w, r).Sprintf(msgMembers, helpers.ToNotation(itemCount))
 	default:
-		http.Error(w, "genOembed: Invalid option", http.StatusInternalServerError)
+		ErrorJSON(w, pageErrorf(ErrBadInput, "genOembed: Invalid option"))
 		return
 	}
 
-	if encodeErr := json.NewEncoder(w).Encode(&embed); encodeErr != nil {
-		http.Error(w, "genOembed: Failed to encode JSON", http.StatusInternalServerError)
+	var buf bytes.Buffer
+	if encodeErr := json.NewEncoder(&buf).Encode(&embed); encodeErr != nil {
+		ErrorJSON(w, pageErrorf(ErrInternal, "genOembed: Failed to encode JSON"))
 		return
 	}
+
+	// Everything comes from the query, so the same URL always gives the same response
+	// The output is full of emoji, some strict clients won't assume UTF-8
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", ps.OembedMaxAge))
+	w.Write(buf.Bytes())
+}
+
+// Bluesky's own embed of the post plays the video, starting at the timestamp if the link had one
+func oembedVideo(query url.Values, embed *types.OEmbed) error {
+	did, rkey := query.Get("video"), query.Get("post")
+	if !strings.HasPrefix(did, "did:") || !isEmbedIdentifier(did) || !isEmbedIdentifier(rkey) {
+		return pageErrorf(ErrBadInput, "genOembed: video and post should be a DID and a record key")
+	}
+
+	embedURL := fmt.Sprintf("https://embed.bsky.app/embed/%s/app.bsky.feed.post/%s", did, rkey)
+	if query.Has("timestamp") {
+		timestamp, ok := parseVideoTimestamp(query.Get("timestamp"))
+		if !ok {
+			return pageErrorf(ErrBadInput, "genOembed: timestamp should be a positive number of seconds")
+		}
+
+		embedURL += "?start=" + strconv.Itoa(timestamp)
+	}
+
+	// The video's aspect ratio (16:9 if it's missing or broken), but never taller than it is wide
+	width, height := int64(oembedVideoWidth), int64(oembedVideoWidth*defaultVideoHeight/defaultVideoWidth)
+
+	aspectWidth, widthErr := strconv.ParseInt(query.Get("width"), 10, 64)
+	aspectHeight, heightErr := strconv.ParseInt(query.Get("height"), 10, 64)
+	if widthErr == nil && heightErr == nil && validAspectRatio(types.APIAspectRatio{Width: aspectWidth, Height: aspectHeight}) {
+		height = max(min(width*aspectHeight/aspectWidth, width), 1)
+	}
+
+	embed.Type = "video"
+	embed.Width, embed.Height = width, height
+	embed.HTML = fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" frameborder="0" allowfullscreen></iframe>`, html.EscapeString(embedURL), width, height)
+
+	return nil
+}
+
+// DIDs and record keys only ever have these, anything else would end up in the iframe's URL
+func isEmbedIdentifier(id string) bool {
+	if id == "" || len(id) > maxEmbedIdentifierLen {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && !strings.ContainsRune(".-_:~%", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Cuts to at most maxBytes, backing up to the start of a rune so a character is never split in half
+func cutAtRune(in string, maxBytes int) string {
+	if len(in) <= maxBytes {
+		return in
+	}
+
+	i := maxBytes
+	for i > 0 && !utf8.RuneStart(in[i]) {
+		i--
+	}
+
+	return in[:i]
 }
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"main/internal/types"
+)
+
+// GenOembed's response to query, decoded if it was a 200
+func requestOembed(t *testing.T, ps *HandlerPass, query, language string) (*httptest.ResponseRecorder, types.OEmbed) {
+	t.Helper()
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/oembed?"+query, http.NoBody)
+	req.Header.Set("Accept-Language", language)
+
+	recorder := httptest.NewRecorder()
+	ps.GenOembed(recorder, req)
+
+	var embed types.OEmbed
+	if recorder.Code == http.StatusOK {
+		if decodeErr := json.NewDecoder(recorder.Body).Decode(&embed); decodeErr != nil {
+			t.Fatal(decodeErr)
+		}
+	}
+
+	return recorder, embed
+}
+
+func TestGenOembedVideo(t *testing.T) {
+	t.Parallel()
+
+	const post = "for=post&replies=1&reposts=2&likes=3&quotes=4"
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantHTML   string
+		wantHeight int64
+	}{
+		{
+			name:       "not a video",
+			query:      post,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "landscape",
+			query:      post + "&video=did:plc:abc&post=3kpost&width=1920&height=1080",
+			wantStatus: http.StatusOK,
+			wantHTML:   `<iframe src="https://embed.bsky.app/embed/did:plc:abc/app.bsky.feed.post/3kpost" width="600" height="337" frameborder="0" allowfullscreen></iframe>`,
+			wantHeight: 337,
+		},
+		{
+			name:       "starts later",
+			query:      post + "&video=did:plc:abc&post=3kpost&width=1920&height=1080&timestamp=90",
+			wantStatus: http.StatusOK,
+			wantHTML:   `<iframe src="https://embed.bsky.app/embed/did:plc:abc/app.bsky.feed.post/3kpost?start=90" width="600" height="337" frameborder="0" allowfullscreen></iframe>`,
+			wantHeight: 337,
+		},
+		{
+			name:       "portrait is capped",
+			query:      post + "&video=did:plc:abc&post=3kpost&width=1080&height=1920",
+			wantStatus: http.StatusOK,
+			wantHTML:   `<iframe src="https://embed.bsky.app/embed/did:plc:abc/app.bsky.feed.post/3kpost" width="600" height="600" frameborder="0" allowfullscreen></iframe>`,
+			wantHeight: 600,
+		},
+		{
+			name:       "no aspect ratio",
+			query:      post + "&video=did:plc:abc&post=3kpost",
+			wantStatus: http.StatusOK,
+			wantHTML:   `<iframe src="https://embed.bsky.app/embed/did:plc:abc/app.bsky.feed.post/3kpost" width="600" height="337" frameborder="0" allowfullscreen></iframe>`,
+			wantHeight: 337,
+		},
+		{
+			name:       "negative aspect ratio",
+			query:      post + "&video=did:plc:abc&post=3kpost&width=-1080&height=1920",
+			wantStatus: http.StatusOK,
+			wantHTML:   `<iframe src="https://embed.bsky.app/embed/did:plc:abc/app.bsky.feed.post/3kpost" width="600" height="337" frameborder="0" allowfullscreen></iframe>`,
+			wantHeight: 337,
+		},
+		{
+			name:       "zero aspect ratio",
+			query:      post + "&video=did:plc:abc&post=3kpost&width=0&height=0",
+			wantStatus: http.StatusOK,
+			wantHTML:   `<iframe src="https://embed.bsky.app/embed/did:plc:abc/app.bsky.feed.post/3kpost" width="600" height="337" frameborder="0" allowfullscreen></iframe>`,
+			wantHeight: 337,
+		},
+		{name: "negative timestamp", query: post + "&video=did:plc:abc&post=3kpost&timestamp=-5", wantStatus: http.StatusBadRequest},
+		{name: "timestamp not a number", query: post + "&video=did:plc:abc&post=3kpost&timestamp=abc", wantStatus: http.StatusBadRequest},
+		{name: "not a DID", query: post + "&video=plc:abc&post=3kpost", wantStatus: http.StatusBadRequest},
+		{name: "markup in the DID", query: post + "&video=did:plc:abc%22%3E%3Cscript%3E&post=3kpost", wantStatus: http.StatusBadRequest},
+		{name: "no record key", query: post + "&video=did:plc:abc", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder, embed := requestOembed(t, testHandlerPass(), tt.query, "")
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if embed.HTML != tt.wantHTML {
+				t.Errorf("html = %q, want %q", embed.HTML, tt.wantHTML)
+			}
+
+			wantType, wantWidth := "link", int64(0)
+			if tt.wantHTML != "" {
+				wantType, wantWidth = "video", oembedVideoWidth
+			}
+
+			if embed.Type != wantType || embed.Width != wantWidth || embed.Height != tt.wantHeight {
+				t.Errorf("got a %s of %dx%d, want a %s of %dx%d", embed.Type, embed.Width, embed.Height, wantType, wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestGenOembedLocalized(t *testing.T) {
+	t.Parallel()
+
+	const (
+		profile = "for=profile&followers=1200&follows=3&posts=45&labeler=true"
+		feed    = "for=feed&likes=7&online=true&valid=false"
+	)
+
+	tests := []struct {
+		name     string
+		query    string
+		language string
+		want     string
+	}{
+		{name: "profile", query: profile, want: "👥 1.2K Followers - 🌐 3 Following - ✍️ 45 Posts - 🏷️ Labeler"},
+		{name: "profile de", query: profile, language: "de", want: "👥 1.2K Follower - 🌐 3 folgt - ✍️ 45 Beiträge - 🏷️ Labeler"},
+		{name: "profile es", query: profile, language: "es", want: "👥 1.2K seguidores - 🌐 3 siguiendo - ✍️ 45 publicaciones - 🏷️ Etiquetador"},
+		{name: "feed", query: feed, want: "🩷 7 likes - ✅ Online - ❌ Not valid"},
+		{name: "feed de", query: feed, language: "de", want: "🩷 7 Likes - ✅ Online - ❌ Ungültig"},
+		{name: "feed es", query: feed, language: "es", want: "🩷 7 me gusta - ✅ En línea - ❌ No válido"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder, embed := requestOembed(t, testHandlerPass(), tt.query, tt.language)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			if embed.AuthorName != tt.want {
+				t.Errorf("author_name = %q, want %q", embed.AuthorName, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenOembedHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		query            string
+		wantStatus       int
+		wantCacheControl string
+		// Translated, so caches have to keep a copy per language
+		wantVary bool
+	}{
+		{name: "profile", query: "for=profile&followers=1&follows=2&posts=3&labeler=false", wantStatus: http.StatusOK, wantCacheControl: "public, max-age=600", wantVary: true},
+		// Translated before it gets here (mediaMsg), the stats are emoji
+		{name: "post", query: "for=post&replies=1&reposts=2&likes=3&quotes=4", wantStatus: http.StatusOK, wantCacheControl: "public, max-age=600"},
+		{name: "feed", query: "for=feed&likes=1&online=true&valid=true", wantStatus: http.StatusOK, wantCacheControl: "public, max-age=600", wantVary: true},
+		{name: "list", query: "for=list&itemCount=5", wantStatus: http.StatusOK, wantCacheControl: "public, max-age=600", wantVary: true},
+		// Errors aren't kept, the next link may be fine
+		{name: "bad number", query: "for=list&itemCount=five", wantStatus: http.StatusBadRequest, wantCacheControl: "no-store"},
+		{name: "unknown", query: "for=nothing", wantStatus: http.StatusBadRequest, wantCacheControl: "no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := testHandlerPass()
+			ps.OembedMaxAge = 600
+
+			recorder, _ := requestOembed(t, ps, tt.query, "")
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if got := recorder.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+
+			if got := slices.Contains(recorder.Header().Values("Vary"), "Accept-Language"); got != tt.wantVary {
+				t.Errorf("Vary: Accept-Language = %t, want %t", got, tt.wantVary)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			// The output is full of emoji, strict clients need the charset
+			if got := recorder.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want application/json; charset=utf-8", got)
+			}
+		})
+	}
+}
@@ -8,13 +8,15 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"main/internal/helpers"
 	"main/internal/types"
 )
 
-var packTemplate = template.Must(template.ParseFiles("./views/pack.html"))
+// Parsed by LoadTemplates
+var packTemplate *template.Template
 
 func (ps *HandlerPass) GetPack(w http.ResponseWriter, r *http.Request) {
 	profileID := r.PathValue("profileID")
@@ -38,54 +40,55 @@ func (ps *HandlerPass) GetPack(w http.ResponseWriter, r *http.Request) {
 
 	req, reqErr := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
 	if reqErr != nil {
-		ErrorPage(w, "getPack: failed to create request")
+		ErrorPage(w, pageErrorf(ErrInternal, "getPack: Failed to create request"))
 		return
 	}
 
-	resp, respErr := helpers.TimeoutClient.Do(req)
+	resp, respErr := helpers.CachedClient.Do(req)
 	if errors.Is(respErr, context.DeadlineExceeded) {
-		ErrorPage(w, "getPack: Bluesky took too long to respond (timeout exceeded)")
+		ErrorPage(w, pageErrorf(ErrTimeout, "getPack: Timeout exceeded"))
 		return
 	} else if respErr != nil {
-		ErrorPage(w, "getPack: failed to do request")
+		ErrorPage(w, pageErrorf(ErrUpstream, "getPack: Failed to do request"))
 		return
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		ErrorPage(w, fmt.Sprintf("getPack: Unexpected status (%s)", resp.Status))
+		ErrorPage(w, upstreamStatusError("getPack", resp))
 		return
 	}
 
 	var pack types.APIPack
-	if decodeErr := json.NewDecoder(resp.Body).Decode(&pack); decodeErr != nil {
-		ErrorPage(w, "getPack: failed to decode response")
+	decodeErr := json.NewDecoder(resp.Body).Decode(&pack)
+	helpers.DebugDecode(r.Context(), "getPack", decodeErr)
+
+	if decodeErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getPack: Failed to decode response"))
 		return
 	}
 
-	if len(plcData.AKA) > 0 {
-		pack.StarterPack.Creator.Handle = strings.TrimPrefix(plcData.AKA[0], "at://")
+	pack.StarterPack.Creator.Handle = ps.preferredHandle(pack.StarterPack.Creator.Handle, plcData)
 
-		if pack.StarterPack.Creator.DisplayName == "" {
-			pack.StarterPack.Creator.DisplayName = pack.StarterPack.Creator.Handle
-		}
+	if pack.StarterPack.Creator.DisplayName == "" {
+		pack.StarterPack.Creator.DisplayName = pack.StarterPack.Creator.Handle
 	}
 
-	pack.StarterPack.Record.Description = fmt.Sprintf("📦 A starter pack by %s (@%s)\n\n%s", pack.StarterPack.Creator.DisplayName, pack.StarterPack.Creator.Handle, pack.StarterPack.Record.Description)
+	pack.StarterPack.Record.Description = ps.localizer(w, r).Sprintf(msgPackBy, pack.StarterPack.Creator.DisplayName, pack.StarterPack.Creator.Handle) + "\n\n" + pack.StarterPack.Record.Description
 
 	if strings.HasPrefix(r.Host, "api.") {
 		w.Header().Set("Content-Type", "application/json")
 
 		if encodeErr := json.NewEncoder(w).Encode(&pack); encodeErr != nil {
-			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrInternal, "Failed to encode JSON"))
 			return
 		}
 
 		return
 	}
 
-	isTelegramAgent := strings.Contains(r.Header.Get("User-Agent"), "Telegram")
+	isTelegramAgent := detectCrawler(r.Header.Get("User-Agent")) == crawlerTelegram
 
 	encodedID := types.RichActivityEncoded{
 		Type:   "pack",
@@ -95,9 +98,28 @@ func (ps *HandlerPass) GetPack(w http.ResponseWriter, r *http.Request) {
 
 	marshaled, err := json.Marshal(encodedID)
 	if err != nil {
-		ErrorPage(w, "getPack: failed to marshal for activity")
+		ErrorPage(w, pageErrorf(ErrInternal, "getPack: Failed to marshal for activity"))
 		return
 	}
 
-	packTemplate.Execute(w, map[string]any{"pack": pack.StarterPack, "packID": packID, "isTelegram": isTelegramAgent, "encodedID": hex.EncodeToString(marshaled), "passData": ps})
+	ps.setPageCacheControl(w, CachePack)
+
+	packTemplate.Execute(w, packTemplateData{
+		Pack:       pack.StarterPack,
+		PackID:     packID,
+		PackCard:   starterPackCard(pack.StarterPack.Creator.DID, packID, ps.avatarOrFallback(pack.StarterPack.Creator.Avatar)),
+		EncodedID:  hex.EncodeToString(marshaled),
+		BaseURL:    helpers.BaseURL(r, ps.TrustForwarded),
+		IsTelegram: isTelegramAgent,
+		PassData:   ps,
+	})
+}
+
+// Builds the starter pack card URL, or falls back when the DID or record key is missing (which would make a broken URL)
+func starterPackCard(did, packID, fallback string) string {
+	if !strings.HasPrefix(did, "did:") || packID == "" {
+		return fallback
+	}
+
+	return fmt.Sprintf("https://ogcard.cdn.bsky.app/start/%s/%s", url.PathEscape(did), url.PathEscape(packID))
 }
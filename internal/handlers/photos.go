@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errPhotoOutOfRange = errors.New("out of range")
+
+// Parses selections like "1,3" or "1-3" (or both, "1-2,4"), into 0-based indexes in the order they were given.
+// Every number has to be a photo that exists, repeats are only counted once
+func parsePhotoSelection(selection string, imageCount int) ([]int, error) {
+	var indexes []int
+	seen := make(map[int]bool)
+
+	for part := range strings.SplitSeq(selection, ",") {
+		start, end, isRange := strings.Cut(part, "-")
+		if !isRange {
+			end = start
+		}
+
+		first, firstErr := strconv.Atoi(strings.TrimSpace(start))
+		last, lastErr := strconv.Atoi(strings.TrimSpace(end))
+		if firstErr != nil || lastErr != nil {
+			return nil, errors.New("not a number")
+		}
+
+		if first < 1 || last > imageCount || first > last {
+			return nil, errPhotoOutOfRange
+		}
+
+		for i := first - 1; i < last; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+
+	return indexes, nil
+}
+
+// The other way around, 0-based indexes back into "1-3, 5", with runs turned into ranges
+func describePhotoSelection(indexes []int) string {
+	var parts []string
+
+	for i := 0; i < len(indexes); {
+		j := i
+		for j+1 < len(indexes) && indexes[j+1] == indexes[j]+1 {
+			j++
+		}
+
+		if i == j {
+			parts = append(parts, strconv.Itoa(indexes[i]+1))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", indexes[i]+1, indexes[j]+1))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(parts, ", ")
+}
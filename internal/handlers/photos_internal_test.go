@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePhotoSelection(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		selection  string
+		imageCount int
+		want       []int
+		wantErr    bool
+		wantRange  bool
+		// Only checked if it parsed
+		wantSummary string
+	}{
+		{selection: "1-3", imageCount: 4, want: []int{0, 1, 2}, wantSummary: "1-3"},
+		{selection: "1,1", imageCount: 4, want: []int{0}, wantSummary: "1"},
+		{selection: "2,4", imageCount: 4, want: []int{1, 3}, wantSummary: "2, 4"},
+		{selection: "1-2,4", imageCount: 4, want: []int{0, 1, 3}, wantSummary: "1-2, 4"},
+		{selection: "3,1-2", imageCount: 4, want: []int{2, 0, 1}, wantSummary: "3, 1-2"},
+		{selection: " 1 - 2 ", imageCount: 4, want: []int{0, 1}, wantSummary: "1-2"},
+		{selection: "3-1", imageCount: 4, wantErr: true, wantRange: true},
+		{selection: "0", imageCount: 4, wantErr: true, wantRange: true},
+		{selection: "5", imageCount: 4, wantErr: true, wantRange: true},
+		{selection: "2-5", imageCount: 4, wantErr: true, wantRange: true},
+		{selection: "1-", imageCount: 4, wantErr: true},
+		{selection: "", imageCount: 4, wantErr: true},
+		{selection: "1,,2", imageCount: 4, wantErr: true},
+		{selection: "one", imageCount: 4, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selection, func(t *testing.T) {
+			t.Parallel()
+
+			got, parseErr := parsePhotoSelection(tt.selection, tt.imageCount)
+			if (parseErr != nil) != tt.wantErr || errors.Is(parseErr, errPhotoOutOfRange) != tt.wantRange {
+				t.Fatalf("parsePhotoSelection(%q, %d) error = %v, want error %t (out of range %t)", tt.selection, tt.imageCount, parseErr, tt.wantErr, tt.wantRange)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parsePhotoSelection(%q, %d) = %v, want %v", tt.selection, tt.imageCount, got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if summary := describePhotoSelection(got); summary != tt.wantSummary {
+				t.Errorf("describePhotoSelection(%v) = %q, want %q", got, summary, tt.wantSummary)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostPhotoSelection(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-reply-images.json")
+
+	tests := []struct {
+		photoNum     string
+		language     string
+		wantStatus   int
+		wantMediaMsg string
+	}{
+		{photoNum: "2", wantStatus: http.StatusOK, wantMediaMsg: "Photo 2 of 3"},
+		{photoNum: "1-2", wantStatus: http.StatusOK, wantMediaMsg: "Photos 1-2 of 3"},
+		{photoNum: "3,1", wantStatus: http.StatusOK, wantMediaMsg: "Photos 3, 1 of 3"},
+		{photoNum: "2,2", wantStatus: http.StatusOK, wantMediaMsg: "Photo 2 of 3"},
+		{photoNum: "1-3", language: "de", wantStatus: http.StatusOK, wantMediaMsg: "Fotos 1-3 von 3"},
+		{photoNum: "3-1", wantStatus: http.StatusNotFound},
+		{photoNum: "4", wantStatus: http.StatusNotFound},
+		{photoNum: "1-", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.photoNum+tt.language, func(t *testing.T) {
+			recorder := requestPhoto(t, tt.photoNum, "TelegramBot (like TwitterBot)", tt.language)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := oembedLinkQuery(t, recorder.Body.String()).Get("mediaMsg"); got != tt.wantMediaMsg {
+				t.Errorf("oEmbed mediaMsg = %q, want %q", got, tt.wantMediaMsg)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostPhotoOutOfRange(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-reply-images.json")
+
+	tests := []struct {
+		photoNum   string
+		wantStatus int
+		// In the error page, or the oEmbed mediaMsg if it worked
+		want string
+	}{
+		{photoNum: "4", wantStatus: http.StatusNotFound, want: "getPost: Photo 4 doesn&#39;t exist, this post has 3"},
+		{photoNum: "99", wantStatus: http.StatusNotFound, want: "getPost: Photo 99 doesn&#39;t exist, this post has 3"},
+		{photoNum: "2-9", wantStatus: http.StatusNotFound, want: "getPost: Photo selection is out of range, this post has 3"},
+		{photoNum: "1,5", wantStatus: http.StatusNotFound, want: "getPost: Photo selection is out of range, this post has 3"},
+		{photoNum: "x", wantStatus: http.StatusBadRequest, want: "getPost: Invalid photo number"},
+		// Anything below the first is the first
+		{photoNum: "0", wantStatus: http.StatusOK, want: "Photo 1 of 3"},
+		{photoNum: "3", wantStatus: http.StatusOK, want: "Photo 3 of 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.photoNum, func(t *testing.T) {
+			recorder := requestPhoto(t, tt.photoNum, "TelegramBot (like TwitterBot)", "")
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				if got := oembedLinkQuery(t, recorder.Body.String()).Get("mediaMsg"); got != tt.want {
+					t.Errorf("oEmbed mediaMsg = %q, want %q", got, tt.want)
+				}
+
+				return
+			}
+
+			if !strings.Contains(recorder.Body.String(), tt.want) {
+				t.Errorf("no %q in the error page:\n%s", tt.want, recorder.Body)
+			}
+		})
+	}
+}
@@ -8,76 +8,135 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"main/internal/helpers"
 	"main/internal/types"
+
+	"golang.org/x/text/message"
 )
 
-var postTemplate = template.Must(template.New("post.html").Funcs(template.FuncMap{"escapePath": url.PathEscape, "nl2br": helpers.NL2BR}).ParseFiles("./views/post.html"))
+// Parsed by LoadTemplates, the lite one is for ?lite=1 (slow connections, embedding)
+var postTemplate, postLiteTemplate *template.Template
 
 func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 	profileID := r.PathValue("profileID")
 	postID := r.PathValue("postID")
 	postID = strings.ReplaceAll(postID, "|", "")
 
+	timing := ps.newServerTiming()
+	printer := ps.localizer(w, r)
+
 	editedPID := profileID
 	if !strings.HasPrefix(editedPID, "did:plc") {
+		resolveStart := time.Now()
 		editedPID = helpers.ResolveHandle(r.Context(), editedPID)
+		timing.track("resolve", "handle", resolveStart)
 	}
+
+	plcStart := time.Now()
 	plcData := helpers.ResolvePLC(r.Context(), editedPID)
+	timing.track("plc", "PLC", plcStart)
 
 	if !strings.HasPrefix(editedPID, "at://") {
 		editedPID = "at://" + editedPID
 	}
 
-	apiURL := fmt.Sprintf("https://public.api.bsky.app/xrpc/app.bsky.feed.getPostThread?depth=0&uri=%s/app.bsky.feed.post/%s", editedPID, postID)
+	parentHeight := min(max(ps.ReplyChainDepth, 1), maxReplyChain)
+
+	apiURL := fmt.Sprintf("https://public.api.bsky.app/xrpc/app.bsky.feed.getPostThread?depth=0&parentHeight=%d&uri=%s/app.bsky.feed.post/%s", parentHeight, editedPID, postID)
 	if helpers.IsBlueskyDead.Load() {
-		apiURL = fmt.Sprintf("https://api.bsky.app/xrpc/app.bsky.feed.getPostThread?depth=0&uri=%s/app.bsky.feed.post/%s", editedPID, postID)
+		apiURL = fmt.Sprintf("https://api.bsky.app/xrpc/app.bsky.feed.getPostThread?depth=0&parentHeight=%d&uri=%s/app.bsky.feed.post/%s", parentHeight, editedPID, postID)
 	}
 
+	apiStart := time.Now()
+
 	postReq, postReqErr := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
 	if postReqErr != nil {
-		ErrorPage(w, "getPost: Failed to create request")
+		ErrorPage(w, pageErrorf(ErrInternal, "getPost: Failed to create request"))
 		return
 	}
 
-	postResp, postRespErr := helpers.TimeoutClient.Do(postReq)
+	postResp, postRespErr := helpers.CachedClient.Do(postReq)
 	if errors.Is(postRespErr, context.DeadlineExceeded) {
-		ErrorPage(w, "getPost: Bluesky took too long to respond (timeout exceeded)")
+		ErrorPage(w, pageErrorf(ErrTimeout, "getPost: Timeout exceeded"))
 		return
 	} else if postRespErr != nil {
-		ErrorPage(w, "getPost: Failed to do request")
+		ErrorPage(w, pageErrorf(ErrUpstream, "getPost: Failed to do request"))
 		return
 	}
 
 	defer postResp.Body.Close()
 
 	if postResp.StatusCode != http.StatusOK {
-		ErrorPage(w, fmt.Sprintf("getPost: Unexpected status (%s)", postResp.Status))
+		// Not being logged in looks different from a deleted post, only the body tells them apart
+		var apiErr types.APIError
+
+		errDecodeErr := json.NewDecoder(io.LimitReader(postResp.Body, maxErrorBodyLen)).Decode(&apiErr)
+		helpers.DebugDecode(r.Context(), "getPost", errDecodeErr)
+
+		// Without it a 400 could be either, so it's neither
+		if errDecodeErr != nil && postResp.StatusCode == http.StatusBadRequest {
+			ErrorPage(w, pageErrorf(ErrUpstream, "getPost: Unexpected status (%s) with an unreadable error", postResp.Status))
+			return
+		}
+
+		if isAuthRequired(postResp.StatusCode, apiErr) {
+			ErrorPage(w, pageErrorf(ErrUnavailable, "getPost: This post requires logging in to view"))
+			return
+		}
+
+		ErrorPage(w, upstreamStatusError("getPost", postResp))
 		return
 	}
 
 	var postData types.APIThread
 
-	if decodeErr := json.NewDecoder(postResp.Body).Decode(&postData); decodeErr != nil {
-		ErrorPage(w, "getPost: Failed to decode response")
+	decodeErr := json.NewDecoder(postResp.Body).Decode(&postData)
+	helpers.DebugDecode(r.Context(), "getPost", decodeErr)
+
+	if decodeErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getPost: Failed to decode response"))
 		return
 	}
 
+	switch postData.Thread.Type {
+	case threadNotFoundPost:
+		ErrorPage(w, pageErrorf(ErrNotFound, "getPost: This post was not found"))
+		return
+	case threadBlockedPost:
+		ErrorPage(w, pageErrorf(ErrUnavailable, "getPost: This post is unavailable because of a block"))
+		return
+	}
+
+	// Anything else that isn't a post decodes to nothing at all
+	if isEmptyPost(postData.Thread.Post) {
+		ErrorPage(w, pageErrorf(ErrNotFound, "getPost: This post is unavailable"))
+		return
+	}
+
+	normalizeEmbedTypes(&postData.Thread.Post)
+	for parent := postData.Thread.Parent; parent != nil; parent = parent.Parent {
+		normalizeEmbedTypes(&parent.Post)
+	}
+
+	timing.track("api", "post-api", apiStart)
+	embedStart := time.Now()
+
 	// Build data here instead of in the template
 	var selfData types.OwnData
 
 	selfData.Author = postData.Thread.Post.Author
-	if len(plcData.AKA) > 0 {
-		selfData.Author.Handle = strings.TrimPrefix(plcData.AKA[0], "at://")
+	selfData.Author.Handle = ps.preferredHandle(selfData.Author.Handle, plcData)
 
-		if selfData.Author.DisplayName == "" {
-			selfData.Author.DisplayName = selfData.Author.Handle
-		}
+	if selfData.Author.DisplayName == "" {
+		selfData.Author.DisplayName = selfData.Author.Handle
 	}
 
 	selfData.PDS = "https://bsky.social"
@@ -87,9 +146,10 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 	selfData.RepostCount = postData.Thread.Post.RepostCount
 	selfData.LikeCount = postData.Thread.Post.LikeCount
 	selfData.QuoteCount = postData.Thread.Post.QuoteCount
+	selfData.RepliesDisabled = repliesDisabled(postData.Thread.Post)
 
 	selfData.Description = selfData.Record.Text
-	selfData.StatsForTG = fmt.Sprintf("💬 %s   🔁 %s   🩷 %s   📝 %s", helpers.ToNotation(postData.Thread.Post.ReplyCount), helpers.ToNotation(postData.Thread.Post.RepostCount), helpers.ToNotation(postData.Thread.Post.LikeCount), helpers.ToNotation(postData.Thread.Post.QuoteCount))
+	selfData.StatsForTG = ps.formatStats(postData.Thread.Post.ReplyCount, postData.Thread.Post.RepostCount, postData.Thread.Post.LikeCount, postData.Thread.Post.QuoteCount)
 
 	// This is to reduce redundancy in the templates
 	switch postData.Thread.Post.Embed.Type {
@@ -111,6 +171,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 		selfData.VideoDID = postData.Thread.Post.Author.DID
 		selfData.AspectRatio = postData.Thread.Post.Embed.AspectRatio
 		selfData.Thumbnail = postData.Thread.Post.Embed.Thumbnail
+		selfData.VideoAlt = postData.Thread.Post.Embed.Alt
 		selfData.IsVideo = true
 	case bskyEmbedQuote:
 		// Quote
@@ -130,6 +191,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 			selfData.VideoDID = postData.Thread.Post.Author.DID
 			selfData.AspectRatio = postData.Thread.Post.Embed.Media.AspectRatio
 			selfData.Thumbnail = postData.Thread.Post.Embed.Media.Thumbnail
+			selfData.VideoAlt = postData.Thread.Post.Embed.Media.Alt
 			selfData.IsVideo = true
 		default:
 			selfData.Type = unknownType
@@ -156,6 +218,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 				selfData.VideoDID = postData.Thread.Post.Embed.Record.Author.DID
 				selfData.AspectRatio = theEmbed.AspectRatio
 				selfData.Thumbnail = theEmbed.Thumbnail
+				selfData.VideoAlt = theEmbed.Alt
 				selfData.IsVideo = true
 			case bskyEmbedQuote:
 				switch theEmbed.Media.Type {
@@ -174,6 +237,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 					selfData.VideoDID = postData.Thread.Post.Embed.Record.Author.DID
 					selfData.AspectRatio = theEmbed.Media.AspectRatio
 					selfData.Thumbnail = theEmbed.Media.Thumbnail
+					selfData.VideoAlt = theEmbed.Media.Alt
 					selfData.IsVideo = true
 				default:
 					selfData.Type = unknownType
@@ -187,6 +251,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 					selfData.CommonEmbeds.Avatar = theEmbed.Record.Avatar
 					selfData.CommonEmbeds.Description = theEmbed.Record.Description
 					selfData.CommonEmbeds.Purpose = theEmbed.Record.Purpose
+					selfData.CommonEmbeds.ItemCount = theEmbed.Record.ItemCount
 					selfData.CommonEmbeds.Creator = theEmbed.Record.Creator
 				case bskyEmbedPack:
 					selfData.Type = bskyEmbedPack
@@ -194,16 +259,21 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 					selfData.CommonEmbeds.Description = theEmbed.Record.Record.Description
 					selfData.CommonEmbeds.Creator = theEmbed.Record.Creator
 
-					// Show a starter pack card. Discard before and then find the id after this --v, then construct a URL if found (ok)
-					if _, packID, ok := strings.Cut(theEmbed.Record.URI, "app.bsky.graph.starterpack/"); ok {
-						selfData.CommonEmbeds.Avatar = fmt.Sprintf("https://ogcard.cdn.bsky.app/start/%s/%s", theEmbed.Record.Creator.DID, packID)
-					}
+					// Show a starter pack card. Discard before and then find the id after this --v, the creator's avatar is used if either is missing
+					_, packID, _ := strings.Cut(theEmbed.Record.URI, "app.bsky.graph.starterpack/")
+					selfData.CommonEmbeds.Avatar = starterPackCard(theEmbed.Record.Creator.DID, packID, theEmbed.Record.Creator.Avatar)
 				case bskyEmbedFeed:
 					selfData.Type = bskyEmbedFeed
+					selfData.CommonEmbeds.URI = theEmbed.Record.URI
+					selfData.CommonEmbeds.IsOnline = theEmbed.Record.IsOnline
+					selfData.CommonEmbeds.IsValid = theEmbed.Record.IsValid
 					selfData.CommonEmbeds.Name = theEmbed.Record.DisplayName
 					selfData.CommonEmbeds.Avatar = theEmbed.Record.Avatar
 					selfData.CommonEmbeds.Description = theEmbed.Record.Description
 					selfData.CommonEmbeds.Creator = theEmbed.Record.Creator
+				case bskyEmbedRecordDetached:
+					// The quote was detached by its author, there is no media to show
+					selfData.Type = unknownType
 				default:
 					selfData.Type = unknownType
 				}
@@ -217,6 +287,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 				selfData.CommonEmbeds.Avatar = postData.Thread.Post.Embed.Record.Avatar
 				selfData.CommonEmbeds.Description = postData.Thread.Post.Embed.Record.Description
 				selfData.CommonEmbeds.Purpose = postData.Thread.Post.Embed.Record.Purpose
+				selfData.CommonEmbeds.ItemCount = postData.Thread.Post.Embed.Record.ItemCount
 				selfData.CommonEmbeds.Creator = postData.Thread.Post.Embed.Record.Creator
 			case bskyEmbedPack:
 				selfData.Type = bskyEmbedPack
@@ -224,16 +295,21 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 				selfData.CommonEmbeds.Description = postData.Thread.Post.Embed.Record.Record.Description
 				selfData.CommonEmbeds.Creator = postData.Thread.Post.Embed.Record.Creator
 
-				// Show a starter pack card. Discard before and then find the id after this --v, then construct a URL if found (ok)
-				if _, packID, ok := strings.Cut(postData.Thread.Post.Embed.Record.URI, "app.bsky.graph.starterpack/"); ok {
-					selfData.CommonEmbeds.Avatar = fmt.Sprintf("https://ogcard.cdn.bsky.app/start/%s/%s", postData.Thread.Post.Embed.Record.Creator.DID, packID)
-				}
+				// Show a starter pack card. Discard before and then find the id after this --v, the creator's avatar is used if either is missing
+				_, packID, _ := strings.Cut(postData.Thread.Post.Embed.Record.URI, "app.bsky.graph.starterpack/")
+				selfData.CommonEmbeds.Avatar = starterPackCard(postData.Thread.Post.Embed.Record.Creator.DID, packID, postData.Thread.Post.Embed.Record.Creator.Avatar)
 			case bskyEmbedFeed:
 				selfData.Type = bskyEmbedFeed
+				selfData.CommonEmbeds.URI = postData.Thread.Post.Embed.Record.URI
+				selfData.CommonEmbeds.IsOnline = postData.Thread.Post.Embed.Record.IsOnline
+				selfData.CommonEmbeds.IsValid = postData.Thread.Post.Embed.Record.IsValid
 				selfData.CommonEmbeds.Name = postData.Thread.Post.Embed.Record.DisplayName
 				selfData.CommonEmbeds.Avatar = postData.Thread.Post.Embed.Record.Avatar
 				selfData.CommonEmbeds.Description = postData.Thread.Post.Embed.Record.Description
 				selfData.CommonEmbeds.Creator = postData.Thread.Post.Embed.Record.Creator
+			case bskyEmbedRecordDetached:
+				// The quote was detached by its author, there is no media to show
+				selfData.Type = unknownType
 			default:
 				selfData.Type = unknownType
 			}
@@ -258,6 +334,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 				selfData.VideoDID = postData.Thread.Parent.Post.Author.DID
 				selfData.AspectRatio = postData.Thread.Parent.Post.Embed.AspectRatio
 				selfData.Thumbnail = postData.Thread.Parent.Post.Embed.Thumbnail
+				selfData.VideoAlt = postData.Thread.Parent.Post.Embed.Alt
 				selfData.IsVideo = true
 			case bskyEmbedQuote:
 				switch postData.Thread.Parent.Post.Embed.Media.Type {
@@ -266,7 +343,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 					selfData.Images = postData.Thread.Parent.Post.Embed.Media.Images
 				case galleryImages:
 					selfData.Type = galleryImages
-					selfData.Images = postData.Thread.Parent.Post.Embed.Items
+					selfData.Images = postData.Thread.Parent.Post.Embed.Media.Items
 				case bskyEmbedExternal:
 					selfData.Type = bskyEmbedExternal
 					selfData.External = postData.Thread.Parent.Post.Embed.Media.External
@@ -276,6 +353,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 					selfData.VideoDID = postData.Thread.Parent.Post.Author.DID
 					selfData.AspectRatio = postData.Thread.Parent.Post.Embed.Media.AspectRatio
 					selfData.Thumbnail = postData.Thread.Parent.Post.Embed.Media.Thumbnail
+					selfData.VideoAlt = postData.Thread.Parent.Post.Embed.Media.Alt
 					selfData.IsVideo = true
 				default:
 					selfData.Type = unknownType
@@ -288,6 +366,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 					selfData.CommonEmbeds.Avatar = postData.Thread.Parent.Post.Embed.Record.Avatar
 					selfData.CommonEmbeds.Description = postData.Thread.Parent.Post.Embed.Record.Description
 					selfData.CommonEmbeds.Purpose = postData.Thread.Parent.Post.Embed.Record.Purpose
+					selfData.CommonEmbeds.ItemCount = postData.Thread.Parent.Post.Embed.Record.ItemCount
 					selfData.CommonEmbeds.Creator = postData.Thread.Parent.Post.Embed.Record.Creator
 				case bskyEmbedPack:
 					selfData.Type = bskyEmbedPack
@@ -295,16 +374,55 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 					selfData.CommonEmbeds.Description = postData.Thread.Parent.Post.Embed.Record.Record.Description
 					selfData.CommonEmbeds.Creator = postData.Thread.Parent.Post.Embed.Record.Creator
 
-					// Show a starter pack card. Discard before and then find the id after this --v, then construct a URL if found (ok)
-					if _, packID, ok := strings.Cut(postData.Thread.Parent.Post.Embed.Record.URI, "app.bsky.graph.starterpack/"); ok {
-						selfData.CommonEmbeds.Avatar = fmt.Sprintf("https://ogcard.cdn.bsky.app/start/%s/%s", postData.Thread.Parent.Post.Embed.Record.Creator.DID, packID)
-					}
+					// Show a starter pack card. Discard before and then find the id after this --v, the creator's avatar is used if either is missing
+					_, packID, _ := strings.Cut(postData.Thread.Parent.Post.Embed.Record.URI, "app.bsky.graph.starterpack/")
+					selfData.CommonEmbeds.Avatar = starterPackCard(postData.Thread.Parent.Post.Embed.Record.Creator.DID, packID, postData.Thread.Parent.Post.Embed.Record.Creator.Avatar)
 				case bskyEmbedFeed:
 					selfData.Type = bskyEmbedFeed
+					selfData.CommonEmbeds.URI = postData.Thread.Parent.Post.Embed.Record.URI
+					selfData.CommonEmbeds.IsOnline = postData.Thread.Parent.Post.Embed.Record.IsOnline
+					selfData.CommonEmbeds.IsValid = postData.Thread.Parent.Post.Embed.Record.IsValid
 					selfData.CommonEmbeds.Name = postData.Thread.Parent.Post.Embed.Record.DisplayName
 					selfData.CommonEmbeds.Avatar = postData.Thread.Parent.Post.Embed.Record.Avatar
 					selfData.CommonEmbeds.Description = postData.Thread.Parent.Post.Embed.Record.Description
 					selfData.CommonEmbeds.Creator = postData.Thread.Parent.Post.Embed.Record.Creator
+				case bskyEmbedTextQuote:
+					// The parent quotes a post, use its media (if it has any)
+					selfData.Type = unknownType
+
+					if len(postData.Thread.Parent.Post.Embed.Record.Embeds) > 0 {
+						quotedEmbed := postData.Thread.Parent.Post.Embed.Record.Embeds[0]
+
+						quotedMedia := quotedEmbed.MediaData
+						if quotedEmbed.Type == bskyEmbedQuote {
+							quotedMedia = quotedEmbed.Media
+						}
+
+						switch quotedMedia.Type {
+						case bskyEmbedImages:
+							selfData.Type = bskyEmbedImages
+							selfData.Images = quotedMedia.Images
+						case galleryImages:
+							selfData.Type = galleryImages
+							selfData.Images = quotedMedia.Items
+						case bskyEmbedExternal:
+							selfData.Type = bskyEmbedExternal
+							selfData.External = quotedMedia.External
+						case bskyEmbedVideo:
+							selfData.Type = bskyEmbedVideo
+							selfData.VideoCID = quotedMedia.CID
+							selfData.VideoDID = postData.Thread.Parent.Post.Embed.Record.Author.DID
+							selfData.AspectRatio = quotedMedia.AspectRatio
+							selfData.Thumbnail = quotedMedia.Thumbnail
+							selfData.VideoAlt = quotedMedia.Alt
+							selfData.IsVideo = true
+						default:
+							selfData.Type = unknownType
+						}
+					}
+				case bskyEmbedRecordDetached:
+					// The quote was detached by its author, there is no media to show
+					selfData.Type = unknownType
 				default:
 					selfData.Type = unknownType
 				}
@@ -316,31 +434,62 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var mediaMsg string
+	var mediaMsg, quotedExternal string
+	var photoNum, totalPhotos int
 	switch selfData.Type {
 	case bskyEmbedList:
 		if selfData.CommonEmbeds.Creator.DisplayName == "" {
 			selfData.CommonEmbeds.Creator.DisplayName = selfData.CommonEmbeds.Creator.Handle
 		}
 
+		// So the template doesn't have to match the purpose itself
 		switch selfData.CommonEmbeds.Purpose {
 		case modList:
-			selfData.Description += fmt.Sprintf("\n\n%s\n🚫 A moderation list by %s (@%s)\n\n%s", selfData.CommonEmbeds.Name, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle, selfData.CommonEmbeds.Description)
+			selfData.CommonEmbeds.PurposeIcon = "🚫"
 		case curateList:
-			selfData.Description += fmt.Sprintf("\n\n%s\n👥 A curator list by %s (@%s)\n\n%s", selfData.CommonEmbeds.Name, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle, selfData.CommonEmbeds.Description)
+			selfData.CommonEmbeds.PurposeIcon = "📋"
+		default:
+			selfData.CommonEmbeds.PurposeIcon = "📝"
+		}
+
+		switch selfData.CommonEmbeds.Purpose {
+		case modList:
+			selfData.Description += "\n\n" + selfData.CommonEmbeds.Name + "\n" + printer.Sprintf(msgModListBy, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle) + "\n\n" + selfData.CommonEmbeds.Description
+		case curateList:
+			selfData.Description += "\n\n" + selfData.CommonEmbeds.Name + "\n" + printer.Sprintf(msgCuratorListBy, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle) + "\n\n" + selfData.CommonEmbeds.Description
+		}
+
+		if selfData.CommonEmbeds.ItemCount > 0 {
+			selfData.Description += "\n\n" + printer.Sprintf(msgMembers, helpers.ToNotation(selfData.CommonEmbeds.ItemCount))
 		}
 	case bskyEmbedPack:
 		if selfData.CommonEmbeds.Creator.DisplayName == "" {
 			selfData.CommonEmbeds.Creator.DisplayName = selfData.CommonEmbeds.Creator.Handle
 		}
 
-		selfData.Description += fmt.Sprintf("\n\n%s\n📦 A starter pack by %s (@%s)\n\n%s", selfData.CommonEmbeds.Name, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle, selfData.CommonEmbeds.Description)
+		selfData.Description += "\n\n" + selfData.CommonEmbeds.Name + "\n" + printer.Sprintf(msgPackBy, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle) + "\n\n" + selfData.CommonEmbeds.Description
 	case bskyEmbedFeed:
+		// Deleted feeds still come through as a generator, just with nothing in it
+		if selfData.CommonEmbeds.Name == "" && selfData.CommonEmbeds.Creator.Handle == "" {
+			selfData.Type = unknownType
+			selfData.Description += "\n\n" + printer.Sprintf(msgDeletedFeed)
+			break
+		}
+
 		if selfData.CommonEmbeds.Creator.DisplayName == "" {
 			selfData.CommonEmbeds.Creator.DisplayName = selfData.CommonEmbeds.Creator.Handle
 		}
 
-		selfData.Description += fmt.Sprintf("\n\n%s\n📡 A feed by %s (@%s)\n\n%s", selfData.CommonEmbeds.Name, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle, selfData.CommonEmbeds.Description)
+		// The api is always given the sample, everything else only when enabled
+		if ps.EmbedFeedSample || strings.HasPrefix(r.Host, "api.") {
+			if sample, ok := getFeedSample(r.Context(), selfData.CommonEmbeds.URI); ok {
+				selfData.CommonEmbeds.Description = printer.Sprintf(msgLatest, sample) + " | " + selfData.CommonEmbeds.Description
+			}
+		}
+
+		selfData.Description += "\n\n" + selfData.CommonEmbeds.Name + "\n" + printer.Sprintf(msgFeedBy, selfData.CommonEmbeds.Creator.DisplayName, selfData.CommonEmbeds.Creator.Handle) + "\n\n" + selfData.CommonEmbeds.Description
+
+		selfData.CommonEmbeds.StatusBadges = feedStatusBadges(printer, selfData.CommonEmbeds.IsOnline, selfData.CommonEmbeds.IsValid)
 	case bskyEmbedExternal:
 		parsedURL, parseErr := url.Parse(selfData.External.URI)
 		if parseErr != nil {
@@ -351,32 +500,106 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if selfData.IsGif {
+			// Tenor puts the size in the URL, grab it before it's cut off below
+			if selfData.External.AspectRatio.Width <= 0 || selfData.External.AspectRatio.Height <= 0 {
+				width, widthErr := strconv.ParseInt(parsedURL.Query().Get("ww"), 10, 64)
+				height, heightErr := strconv.ParseInt(parsedURL.Query().Get("hh"), 10, 64)
+
+				if widthErr == nil && heightErr == nil && width > 0 && height > 0 {
+					selfData.External.AspectRatio = types.APIAspectRatio{Width: width, Height: height}
+				}
+			}
+
 			// The template is stupidly persistent on rewriting & to &amp; come hell or high water it will rewrite it
 			selfData.External.URI = "https://" + parsedURL.Host + parsedURL.Path
+
+			// Telegram plays these better as a video
+			if parsedURL.Host == "media.tenor.com" {
+				selfData.GifVideoURL = tenorMP4URL(parsedURL.Path)
+			}
 		} else {
-			// Not a GIF, Add the external's title & description to the template description
-			selfData.Description += "\n\n" + selfData.External.Title + "\n" + selfData.External.Description
+			if parseErr == nil {
+				selfData.ExternalDomain = strings.TrimPrefix(strings.ToLower(parsedURL.Hostname()), "www.")
+			}
+
+			// Not a GIF, Add the external's title & description to the template description.
+			// If it came from the quoted post, it goes after the quote instead, so it doesn't look like ours
+			externalDesc := selfData.External.Title + "\n" + selfData.External.Description
+			if postData.Thread.Post.Embed.Type == bskyEmbedText && postData.Thread.Post.Embed.Record.Type == bskyEmbedTextQuote {
+				quotedExternal = externalDesc
+			} else {
+				selfData.Description += "\n\n" + externalDesc
+			}
 		}
 	case bskyEmbedImages, galleryImages:
-		pnStr := r.PathValue("photoNum")
-		if pnStr != "" {
-			pnValue, atoiErr := strconv.Atoi(pnStr)
-			if atoiErr != nil {
-				ErrorPage(w, "getPost: Invalid photo number")
-				return
+		totalPhotos = len(selfData.Images)
+
+		// Unknown dimensions are left out of the tags, rather than sending nonsense
+		for i := range selfData.Images {
+			if !validAspectRatio(selfData.Images[i].AspectRatio) {
+				selfData.Images[i].AspectRatio = types.APIAspectRatio{}
 			}
+		}
+
+		pnStr := r.PathValue("photoNum")
+		imgLen := len(selfData.Images)
 
+		if pnValue, atoiErr := strconv.Atoi(pnStr); pnStr != "" && atoiErr == nil {
 			if pnValue < 1 {
 				pnValue = 1
 			}
 
-			imgLen := len(selfData.Images)
-			if imgLen > 1 && imgLen >= pnValue {
-				mediaMsg = fmt.Sprintf("Photo %d of %d", pnValue, imgLen)
+			if pnValue > imgLen {
+				ErrorPage(w, pageErrorf(ErrNotFound, "getPost: Photo %d doesn't exist, this post has %d", pnValue, imgLen))
+				return
+			}
+
+			if imgLen > 1 {
+				mediaMsg = printer.Sprintf(msgPhotoOf, pnValue, imgLen)
+				photoNum = pnValue
 				selfData.Images = types.APIImages{selfData.Images[pnValue-1]}
 			}
+		} else if pnStr != "" {
+			// Not a single number, so a list (1,3) and/or range (1-3) of them for the mosaic
+			indexes, selectionErr := parsePhotoSelection(pnStr, imgLen)
+			if errors.Is(selectionErr, errPhotoOutOfRange) {
+				ErrorPage(w, pageErrorf(ErrNotFound, "getPost: Photo selection is out of range, this post has %d", imgLen))
+				return
+			} else if selectionErr != nil {
+				ErrorPage(w, pageErrorf(ErrBadInput, "getPost: Invalid photo number"))
+				return
+			}
+
+			if imgLen > 1 {
+				var selected types.APIImages
+				for _, i := range indexes {
+					selected = append(selected, selfData.Images[i])
+				}
+
+				if len(indexes) == 1 {
+					mediaMsg = printer.Sprintf(msgPhotoOf, indexes[0]+1, imgLen)
+				} else {
+					mediaMsg = printer.Sprintf(msgPhotosOf, describePhotoSelection(indexes), imgLen)
+				}
+
+				selfData.Images = selected
+			}
+		}
+
+		// GIFs uploaded as images are still images, but they should not be turned into a (static) mosaic
+		for _, v := range selfData.Images {
+			if isGifImage(v.FullSize) {
+				selfData.IsGif = true
+				selfData.GifURL = v.FullSize
+				break
+			}
 		}
 	case bskyEmbedVideo:
+		// The player needs some size, so assume the usual 16:9
+		if !validAspectRatio(selfData.AspectRatio) {
+			selfData.AspectRatio = types.APIAspectRatio{Width: defaultVideoWidth, Height: defaultVideoHeight}
+		}
+
 		vidOwnerPLC := helpers.ResolvePLC(r.Context(), selfData.VideoDID)
 		for _, k := range vidOwnerPLC.Service {
 			if k.ID == "#atproto_pds" && k.Type == "AtprotoPersonalDataServer" {
@@ -384,6 +607,18 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 				break
 			}
 		}
+
+		// YouTube-style deep links (?timestamp=42)
+		if timestamp, ok := parseVideoTimestamp(r.URL.Query().Get("timestamp")); ok {
+			selfData.VideoTimestamp = timestamp
+
+			startsAt := printer.Sprintf(msgStartsAt, timestamp/60, timestamp%60)
+			if mediaMsg != "" {
+				mediaMsg += " - " + startsAt
+			} else {
+				mediaMsg = startsAt
+			}
+		}
 	}
 
 	// Add description details, could be done in the switch above, but it's easier to find it here.
@@ -404,13 +639,34 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 				selfData.OriginalPostID = qPID
 			}
 
-			selfData.Description += fmt.Sprintf("📝 Quoting %s (@%s):\n%s", postData.Thread.Post.Embed.Record.Author.DisplayName, postData.Thread.Post.Embed.Record.Author.Handle, postData.Thread.Post.Embed.Record.Value.Text)
+			selfData.Description += printer.Sprintf(msgQuoting, postData.Thread.Post.Embed.Record.Author.DisplayName, postData.Thread.Post.Embed.Record.Author.Handle) + "\n" + postData.Thread.Post.Embed.Record.Value.Text
+
+			if quotedAt, ok := ps.quoteTimestamp(postData.Thread.Post.Embed.Record.Value.CreatedAt); ok {
+				selfData.Description += "\n" + quotedAt
+			}
+
+			if quotedExternal != "" {
+				selfData.Description += "\n\n" + quotedExternal
+			}
+		} else if postData.Thread.Post.Embed.Record.Type == bskyEmbedRecordDetached {
+			if selfData.Description != "" {
+				selfData.Description += "\n\n"
+			}
+
+			selfData.Description += printer.Sprintf(msgDetachedQuote)
 		}
 	case bskyEmbedQuote:
+		// The media's part (an external link's title and description) is already in, the quote goes after it
 		if selfData.Description != "" {
 			selfData.Description += "\n\n"
 		}
 
+		// Detached quotes have no author or text to show
+		if postData.Thread.Post.Embed.Record.Record.Type == bskyEmbedRecordDetached {
+			selfData.Description += printer.Sprintf(msgDetachedQuote)
+			break
+		}
+
 		if postData.Thread.Post.Embed.Record.Record.Author.DisplayName == "" {
 			postData.Thread.Post.Embed.Record.Record.Author.DisplayName = postData.Thread.Post.Embed.Record.Record.Author.Handle
 		}
@@ -420,7 +676,11 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 			selfData.OriginalPostID = qPID
 		}
 
-		selfData.Description += fmt.Sprintf("📝 Quoting %s (@%s):\n%s", postData.Thread.Post.Embed.Record.Record.Author.DisplayName, postData.Thread.Post.Embed.Record.Record.Author.Handle, postData.Thread.Post.Embed.Record.Record.Value.Text)
+		selfData.Description += printer.Sprintf(msgQuoting, postData.Thread.Post.Embed.Record.Record.Author.DisplayName, postData.Thread.Post.Embed.Record.Record.Author.Handle) + "\n" + postData.Thread.Post.Embed.Record.Record.Value.Text
+
+		if quotedAt, ok := ps.quoteTimestamp(postData.Thread.Post.Embed.Record.Record.Value.CreatedAt); ok {
+			selfData.Description += "\n" + quotedAt
+		}
 	}
 
 	if postData.Thread.Parent != nil {
@@ -428,6 +688,11 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 			selfData.Description += "\n\n"
 		}
 
+		// Older parents go first (oldest to newest), but are cut short so the direct parent still fits
+		if olderChain := replyChain(printer, postData.Thread.Parent.Parent, parentHeight-1); olderChain != "" {
+			selfData.Description += olderChain + "\n\n"
+		}
+
 		if postData.Thread.Parent.Post.Author.DisplayName == "" {
 			postData.Thread.Parent.Post.Author.DisplayName = postData.Thread.Parent.Post.Author.Handle
 		}
@@ -437,23 +702,53 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 			selfData.OriginalPostID = qPID
 		}
 
-		selfData.Description += fmt.Sprintf("💬 Replying to %s (@%s):\n%s", postData.Thread.Parent.Post.Author.DisplayName, postData.Thread.Parent.Post.Author.Handle, postData.Thread.Parent.Post.Record.Text)
+		switch {
+		case !isBlockedAuthor(postData.Thread.Parent.Post.Author):
+			selfData.Description += printer.Sprintf(msgReplyingTo, postData.Thread.Parent.Post.Author.DisplayName, postData.Thread.Parent.Post.Author.Handle) + "\n" + postData.Thread.Parent.Post.Record.Text
+		case postData.Thread.Parent.Post.Record.Text != "":
+			selfData.Description += printer.Sprintf(msgReplyBlocked) + ":\n" + postData.Thread.Parent.Post.Record.Text
+		default:
+			selfData.Description += printer.Sprintf(msgReplyBlocked)
+		}
+
+		if repostedBy := parentRepostedBy(printer, postData.Thread.Parent); repostedBy != "" {
+			selfData.Description += "\n" + repostedBy
+		}
 	}
 
+	timing.track("embed", "embed-resolve", embedStart)
+
 	if strings.HasPrefix(r.Host, "mosaic.") {
 		if selfData.Type == bskyEmbedImages || selfData.Type == galleryImages {
-			GenMosaic(w, r, selfData.Images)
+			opts, optsErr := parseMosaicOptions(r)
+			if optsErr != nil {
+				ErrorPage(w, optsErr)
+				return
+			}
+
+			GenMosaic(w, r, selfData.Images, ps.withMosaicDefaults(opts), timing)
 			return
 		}
 
-		ErrorPage(w, "getPost: Invalid type")
+		ErrorPage(w, pageErrorf(ErrBadInput, "getPost: Invalid type"))
 		return
 	}
 
 	if strings.HasPrefix(r.Host, "raw.") {
 		switch selfData.Type {
 		case bskyEmbedImages, galleryImages:
-			GenMosaic(w, r, selfData.Images)
+			if selfData.IsGif {
+				http.Redirect(w, r, selfData.GifURL, http.StatusFound)
+				return
+			}
+
+			opts, optsErr := parseMosaicOptions(r)
+			if optsErr != nil {
+				ErrorPage(w, optsErr)
+				return
+			}
+
+			GenMosaic(w, r, selfData.Images, ps.withMosaicDefaults(opts), timing)
 			return
 		case bskyEmbedExternal:
 			if selfData.IsGif {
@@ -462,14 +757,25 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 			}
 
 			if selfData.External.Thumb != "" {
+				if thumbNotModified(w, r, selfData.External.Thumb) {
+					return
+				}
+
 				http.Redirect(w, r, selfData.External.Thumb, http.StatusFound)
 				return
 			}
 
-			ErrorPage(w, "getPost: No suitable media found")
+			ErrorPage(w, pageErrorf(ErrNotFound, "getPost: No suitable media found"))
 			return
 		case bskyEmbedVideo:
-			http.Redirect(w, r, fmt.Sprintf("%s/xrpc/com.atproto.sync.getBlob?cid=%s&did=%s", selfData.PDS, selfData.VideoCID, selfData.VideoDID), http.StatusFound)
+			blobURL := fmt.Sprintf("%s/xrpc/com.atproto.sync.getBlob?cid=%s&did=%s", selfData.PDS, selfData.VideoCID, selfData.VideoDID)
+
+			// Blobs ignore media fragments for now, this is here for when videos get proxied (HLS)
+			if selfData.VideoTimestamp > 0 {
+				blobURL += fmt.Sprintf("#t=%d", selfData.VideoTimestamp)
+			}
+
+			http.Redirect(w, r, blobURL, http.StatusFound)
 			return
 		case bskyEmbedList, bskyEmbedPack, bskyEmbedFeed:
 			if selfData.CommonEmbeds.Avatar != "" {
@@ -477,10 +783,10 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			ErrorPage(w, "getPost: No suitable media found")
+			ErrorPage(w, pageErrorf(ErrNotFound, "getPost: No suitable media found"))
 			return
 		default:
-			ErrorPage(w, "getPost: Invalid type")
+			ErrorPage(w, pageErrorf(ErrBadInput, "getPost: Invalid type"))
 			return
 		}
 	}
@@ -492,7 +798,7 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 
 		var buf bytes.Buffer
 		if encodeErr := json.NewEncoder(&buf).Encode(map[string]any{"originalData": postData, "parsedData": selfData}); encodeErr != nil {
-			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrInternal, "Failed to encode JSON"))
 			return
 		}
 
@@ -501,7 +807,14 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	isTelegramAgent := strings.Contains(r.Header.Get("User-Agent"), "Telegram")
+	crawler := detectCrawler(r.Header.Get("User-Agent"))
+
+	selfData.Author.Avatar = ps.avatarOrFallback(selfData.Author.Avatar)
+
+	replyTo := newReplyCard(printer, postData.Thread.Parent)
+	if replyTo != nil && !isBlockedAuthor(replyTo.Author) {
+		replyTo.Author.Avatar = ps.avatarOrFallback(replyTo.Author.Avatar)
+	}
 
 	encodedID := types.RichActivityEncoded{
 		Type:     "post",
@@ -512,9 +825,285 @@ func (ps *HandlerPass) GetPost(w http.ResponseWriter, r *http.Request) {
 
 	marshaled, err := json.Marshal(encodedID)
 	if err != nil {
-		ErrorPage(w, "getPost: failed to marshal for activity")
+		ErrorPage(w, pageErrorf(ErrInternal, "getPost: Failed to marshal for activity"))
 		return
 	}
 
-	postTemplate.Execute(w, map[string]any{"data": selfData, "editedPID": strings.TrimPrefix(editedPID, "at://"), "postID": postID, "isTelegram": isTelegramAgent, "mediaMsg": mediaMsg, "encodedID": hex.EncodeToString(marshaled), "passData": ps})
+	var noReplies string
+	if selfData.RepliesDisabled {
+		noReplies = printer.Sprintf(msgNoReplies)
+	}
+
+	templateData := postTemplateData{
+		Data:          selfData,
+		ReplyTo:       replyTo,
+		NoReplies:     noReplies,
+		EditedPID:     strings.TrimPrefix(editedPID, "at://"),
+		PostID:        postID,
+		MediaMsg:      mediaMsg,
+		EncodedID:     hex.EncodeToString(marshaled),
+		BaseURL:       helpers.BaseURL(r, ps.TrustForwarded),
+		DefaultAvatar: DefaultFeedAvatarPath,
+		PhotoNum:      photoNum,
+		TotalPhotos:   totalPhotos,
+		PrevPhoto:     photoNum - 1,
+		NextPhoto:     photoNum + 1,
+		IsTelegram:    crawler == crawlerTelegram,
+		IsSlack:       crawler == crawlerSlack,
+		IsWhatsApp:    crawler == crawlerWhatsApp,
+		PassData:      ps,
+	}
+
+	if validErr := validPostTemplateData(templateData); validErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getPost: %s", validErr))
+		return
+	}
+
+	// Rendered into a buffer first, so the render time can still go in the headers
+	templateStart := time.Now()
+
+	// Same data, just a page meant to be read instead of a redirect with embed tags
+	pageTemplate := postTemplate
+	if r.URL.Query().Get("lite") == "1" {
+		pageTemplate = postLiteTemplate
+	}
+
+	var buf bytes.Buffer
+	if execErr := pageTemplate.Execute(&buf, templateData); execErr != nil {
+		ErrorPage(w, pageErrorf(ErrInternal, "getPost: Failed to render"))
+		return
+	}
+
+	timing.track("template", "render", templateStart)
+	timing.write(w)
+
+	ps.setPageCacheControl(w, CachePost)
+	w.Write(buf.Bytes())
+}
+
+// Swaps the size in a CDN image URL (feed_fullsize, feed_thumbnail, ...), other URLs are left alone
+func cdnVariant(imageURL, variant string) string {
+	return strings.Replace(imageURL, "/img/feed_fullsize/", "/img/"+variant+"/", 1)
+}
+
+func validAspectRatio(aspectRatio types.APIAspectRatio) bool {
+	return aspectRatio.Width > 0 && aspectRatio.Height > 0
+}
+
+// Some responses leave the fragment off (app.bsky.embed.images instead of app.bsky.embed.images#view), or call it #main.
+// Those are turned into the views we know, so everything else can keep comparing against the constants
+func embedType(lexiconType string) string {
+	base, fragment, hasFragment := strings.Cut(lexiconType, "#")
+	if hasFragment && fragment != "main" {
+		return lexiconType
+	}
+
+	for _, known := range []string{bskyEmbedImages, galleryImages, bskyEmbedExternal, bskyEmbedVideo, bskyEmbedQuote, bskyEmbedText} {
+		if knownBase, _, _ := strings.Cut(known, "#"); knownBase == base {
+			return known
+		}
+	}
+
+	return lexiconType
+}
+
+// Only the embed and media types, records have more than one view (#viewRecord, #viewDetached, ...) so there's no telling which one was meant
+func normalizeEmbedTypes(post *types.APIPost) {
+	post.Embed.Type = embedType(post.Embed.Type)
+	post.Embed.Media.Type = embedType(post.Embed.Media.Type)
+
+	for i := range post.Embed.Record.Embeds {
+		post.Embed.Record.Embeds[i].Type = embedType(post.Embed.Record.Embeds[i].Type)
+		post.Embed.Record.Embeds[i].Media.Type = embedType(post.Embed.Record.Embeds[i].Media.Type)
+	}
+}
+
+// Only if the operator wants them, and the record has a sane date (it's set by the client, so it may not)
+func (ps *HandlerPass) quoteTimestamp(createdAt string) (string, bool) {
+	if !ps.QuoteTimestamps || createdAt == "" {
+		return "", false
+	}
+
+	parsedTime, parseErr := time.Parse(time.RFC3339, createdAt)
+	if parseErr != nil {
+		return "", false
+	}
+
+	return "🕒 " + parsedTime.UTC().Format("2 Jan 2006 15:04 UTC"), true
+}
+
+func repliesDisabled(post types.APIPost) bool {
+	return post.Viewer.ReplyDisabled || (post.Threadgate != nil && post.Threadgate.Record.Allow != nil && len(post.Threadgate.Record.Allow) == 0)
+}
+
+func isEmptyPost(post types.APIPost) bool {
+	return post.Author.DID == "" && post.Record.Text == "" && post.Embed.Type == ""
+}
+
+func isAuthRequired(statusCode int, apiErr types.APIError) bool {
+	return statusCode == http.StatusUnauthorized || apiErr.Error == "AuthRequired" || apiErr.Error == "AuthenticationRequired"
+}
+
+// Tenor media ids end with the format (AAAAC is a GIF, AAAPo is an mp4), the rest of the path stays the same.
+// /<id>AAAAC/<name>.gif -> https://media.tenor.com/<id>AAAPo/<name>.mp4, empty if it doesn't look like that
+func tenorMP4URL(gifPath string) string {
+	mediaID, fileName, found := strings.Cut(strings.TrimPrefix(gifPath, "/"), "/")
+	if !found || strings.Contains(fileName, "/") {
+		return ""
+	}
+
+	baseID, isGif := strings.CutSuffix(mediaID, "AAAAC")
+	baseName, isGifFile := strings.CutSuffix(fileName, ".gif")
+	if !isGif || !isGifFile || baseID == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("https://media.tenor.com/%sAAAPo/%s.mp4", baseID, baseName)
+}
+
+// Seconds into the video, missing, zero, negative or non-numeric ones are left out (the video starts at the beginning)
+func parseVideoTimestamp(value string) (int, bool) {
+	timestamp, atoiErr := strconv.Atoi(value)
+	if atoiErr != nil || timestamp <= 0 {
+		return 0, false
+	}
+
+	return timestamp, true
+}
+
+// The CDN marks GIFs either with an @gif suffix, or with a format parameter
+func isGifImage(imageURL string) bool {
+	if strings.HasSuffix(imageURL, "@gif") {
+		return true
+	}
+
+	parsedURL, parseErr := url.Parse(imageURL)
+
+	return parseErr == nil && parsedURL.Query().Get("format") == "gif"
+}
+
+// Blocked (or otherwise unavailable) authors only come with a DID, there's nothing to show for them
+func newReplyCard(printer *message.Printer, parent *types.APIThreadParent) *replyCard {
+	if parent == nil {
+		return nil
+	}
+
+	card := &replyCard{
+		Author:     parent.Post.Author,
+		Text:       parent.Post.Record.Text,
+		RepostedBy: parentRepostedBy(printer, parent),
+	}
+
+	// Blocked authors only have a DID, so no name, avatar or link
+	if isBlockedAuthor(card.Author) {
+		card.Label = printer.Sprintf(msgReplyBlocked)
+		return card
+	}
+
+	if card.Author.DisplayName == "" {
+		card.Author.DisplayName = card.Author.Handle
+	}
+
+	card.Label = printer.Sprintf(msgReplyingTo, card.Author.DisplayName, card.Author.Handle)
+
+	if _, parentID, found := strings.Cut(parent.Post.URI, "app.bsky.feed.post/"); found {
+		card.URL = fmt.Sprintf("https://bsky.app/profile/%s/post/%s", url.PathEscape(card.Author.DID), url.PathEscape(parentID))
+	}
+
+	// Quotes with media have it one level down
+	embed := parent.Post.Embed
+	if embed.Type == bskyEmbedQuote {
+		card.Media = mediaIndicator(printer, embed.Media)
+	} else {
+		card.Media = mediaIndicator(printer, types.MediaData{Type: embed.Type, Images: embed.Images, Items: embed.Items, External: embed.External})
+	}
+
+	return card
+}
+
+// getPostThread rarely says who reposted the parent, nothing (or a reposter with no handle) means there's nothing to say
+func parentRepostedBy(printer *message.Printer, parent *types.APIThreadParent) string {
+	if parent.Reason == nil || parent.Reason.Type != reasonRepost || parent.Reason.By.Handle == "" {
+		return ""
+	}
+
+	by := parent.Reason.By
+	if by.DisplayName == "" {
+		by.DisplayName = by.Handle
+	}
+
+	return printer.Sprintf(msgParentRepost, by.DisplayName, by.Handle)
+}
+
+// A short hint of what's attached, since the card has no room for the media itself
+func mediaIndicator(printer *message.Printer, media types.MediaData) string {
+	switch media.Type {
+	case bskyEmbedImages:
+		return printer.Sprintf(msgMediaImages, len(media.Images))
+	case galleryImages:
+		return printer.Sprintf(msgMediaImages, len(media.Items))
+	case bskyEmbedVideo:
+		return printer.Sprintf(msgMediaVideo)
+	case bskyEmbedExternal:
+		if media.External.Title != "" {
+			return "🔗 " + media.External.Title
+		}
+
+		return "🔗 " + media.External.URI
+	default:
+		return ""
+	}
+}
+
+func isBlockedAuthor(author types.APIAuthor) bool {
+	return author.Handle == "" && author.DisplayName == "" && author.DID != ""
+}
+
+// Walks up the parents (at most maxParents), and returns them oldest to newest.
+// The maxAuthorLen budget is split between them, since embeds cut off the description anyway
+func replyChain(printer *message.Printer, parent *types.APIThreadParent, maxParents int) string {
+	var chain []string
+
+	for ; parent != nil && len(chain) < maxParents; parent = parent.Parent {
+		if isBlockedAuthor(parent.Post.Author) {
+			chain = append(chain, printer.Sprintf(msgChainBlocked))
+			continue
+		}
+
+		if parent.Post.Author.DisplayName == "" {
+			parent.Post.Author.DisplayName = parent.Post.Author.Handle
+		}
+
+		chain = append(chain, fmt.Sprintf("🧵 %s (@%s):\n%s", parent.Post.Author.DisplayName, parent.Post.Author.Handle, parent.Post.Record.Text))
+	}
+
+	if len(chain) == 0 {
+		return ""
+	}
+
+	// +1 for the direct parent, which is not part of this chain
+	budget := maxAuthorLen / (len(chain) + 1)
+
+	slices.Reverse(chain)
+	for i := range chain {
+		chain[i] = helpers.TruncateRunes(chain[i], budget)
+	}
+
+	return strings.Join(chain, "\n\n")
+}
+
+// Catch missing data before it turns into a broken embed
+func validPostTemplateData(d postTemplateData) error {
+	switch {
+	case d.PassData == nil:
+		return errors.New("missing handler data")
+	case d.PostID == "":
+		return errors.New("missing post ID")
+	case d.EditedPID == "":
+		return errors.New("missing profile ID")
+	case d.Data.Author.Handle == "" && d.Data.Author.DID == "":
+		return errors.New("missing post author")
+	default:
+		return nil
+	}
 }
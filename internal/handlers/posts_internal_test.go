@@ -0,0 +1,1702 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"main/internal/types"
+)
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		fixture    string
+		wantStatus int
+		wantText   string
+	}{
+		{"needs logging in", http.StatusBadRequest, "thread-auth-required.json", http.StatusForbidden, "This post requires logging in to view"},
+		{"deleted", http.StatusBadRequest, "thread-not-found.json", http.StatusNotFound, errorCodes[ErrNotFound].message},
+		{"unauthorized, whatever the body", http.StatusUnauthorized, "not-json.txt", http.StatusForbidden, "This post requires logging in to view"},
+		{"unreadable 400", http.StatusBadRequest, "not-json.txt", http.StatusBadGateway, "with an unreadable error"},
+		{"Bluesky failing", http.StatusInternalServerError, "not-json.txt", http.StatusBadGateway, errorCodes[ErrUpstream].message},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, tt.status, tt.fixture)
+			recorder := requestPost(t, "example.test", "", "")
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if !strings.Contains(recorder.Body.String(), html.EscapeString(tt.wantText)) {
+				t.Errorf("page doesn't say %q:\n%s", tt.wantText, recorder.Body.String())
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostQuoteWithExternal(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-quote-external.json")
+
+	const thumb = "https://cdn.bsky.app/img/feed_thumbnail/plain/did:plc:abc/bafkthumb@jpeg"
+
+	t.Run("page", func(t *testing.T) {
+		recorder := requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d", recorder.Code)
+		}
+
+		page := recorder.Body.String()
+
+		// The card, then the quote (the author has no display name, so the handle stands in)
+		wantDescription := "Worth a read\n\nAn article\nAbout things\n\n📝 Quoting bob.test (@bob.test):\nThe quoted post"
+		if !strings.Contains(page, `<meta property="og:description" content="`+strings.ReplaceAll(html.EscapeString(wantDescription), "\n", "&lt;br&gt;")+`">`) {
+			t.Errorf("description isn't %q:\n%s", wantDescription, page)
+		}
+
+		for _, want := range []string{
+			`<meta property="og:image" content="` + thumb + `">`,
+			`<img src="` + thumb + `" alt="About things">`,
+			"🔗 example.com",
+		} {
+			if !strings.Contains(page, want) {
+				t.Errorf("page doesn't have %s", want)
+			}
+		}
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		recorder := requestPost(t, "raw.example.test", "", "")
+		if recorder.Code != http.StatusFound || recorder.Header().Get("Location") != thumb {
+			t.Errorf("got %d to %q, want a redirect to the card's thumbnail", recorder.Code, recorder.Header().Get("Location"))
+		}
+	})
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostQuoteWithImages(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-quote-images.json")
+
+	recorder := requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d", recorder.Code)
+	}
+
+	page := recorder.Body.String()
+
+	// Both images as the media, the quote in the description (the author has no display name, so the handle stands in)
+	wantDescription := "Same view, two years apart\n\n📝 Quoting bob.test (@bob.test):\nPost your favorite lake"
+	if !strings.Contains(page, `<meta property="og:description" content="`+strings.ReplaceAll(html.EscapeString(wantDescription), "\n", "&lt;br&gt;")+`">`) {
+		t.Errorf("description isn't %q:\n%s", wantDescription, page)
+	}
+
+	for _, want := range []string{
+		`<img src="https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkfirst@jpeg" alt="A lake in summer" width="1200" height="800">`,
+		`<img src="https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafksecond@jpeg" alt="The same lake in winter" width="1200" height="800">`,
+		// Telegram gets the mosaic for more than one image
+		`<meta property="og:image" content="https://mosaic.example.test/profile/did:plc:abc/post/3kpost">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page doesn't have %s", want)
+		}
+	}
+
+	// Everyone else gets every image
+	page = requestPost(t, "example.test", "", "Discordbot/2.0").Body.String()
+	for _, want := range []string{
+		`<meta property="og:image" content="https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkfirst@jpeg">`,
+		`<meta property="og:image" content="https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafksecond@jpeg">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page doesn't have %s", want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostGifImage(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-gif-image.json")
+
+	const (
+		gifURL   = "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkanimated@gif"
+		stillURL = "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkstill@jpeg"
+	)
+
+	tests := []struct {
+		name      string
+		query     string
+		userAgent string
+		want      []string
+		dontWant  []string
+	}{
+		{
+			"page", "", "TelegramBot (like TwitterBot)",
+			[]string{
+				`<meta property="og:image" content="` + gifURL + `">`,
+				`<img src="` + gifURL + `" alt="A dancing cat" width="320" height="240">`,
+			},
+			[]string{`<img src="` + stillURL, "<video"},
+		},
+		{
+			"lite page", "lite=1", "",
+			[]string{`<img src="` + gifURL + `" alt="A dancing cat" loading="lazy">`},
+			[]string{"feed_thumbnail/plain/did:plc:abc/bafkanimated"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := requestPost(t, "example.test", tt.query, tt.userAgent)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range tt.want {
+				if !strings.Contains(page, want) {
+					t.Errorf("page doesn't have %s:\n%s", want, page)
+				}
+			}
+
+			for _, dontWant := range tt.dontWant {
+				if strings.Contains(page, dontWant) {
+					t.Errorf("page has %s:\n%s", dontWant, page)
+				}
+			}
+		})
+	}
+
+	t.Run("raw", func(t *testing.T) {
+		recorder := requestPost(t, "raw.example.test", "", "")
+		if recorder.Code != http.StatusFound || recorder.Header().Get("Location") != gifURL {
+			t.Errorf("got %d to %q, want a redirect to the GIF", recorder.Code, recorder.Header().Get("Location"))
+		}
+	})
+}
+
+func TestIsGifImage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		imageURL string
+		want     bool
+	}{
+		{"https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkanimated@gif", true},
+		{"https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkstill@jpeg", false},
+		{"https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkstill@png", false},
+		{"https://video.cdn.example/image?cid=bafk&format=gif", true},
+		{"https://video.cdn.example/image?format=gif", true},
+		{"https://video.cdn.example/image?format=gifv", false},
+		{"https://video.cdn.example/image?cid=bafk&format=gif&w=100", true},
+		{"https://video.cdn.example/image?alt=format=gif", false},
+		{"https://video.cdn.example/image?format=jpeg", false},
+		{"https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafk@gif/more", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isGifImage(tt.imageURL); got != tt.want {
+			t.Errorf("isGifImage(%q) = %v, want %v", tt.imageURL, got, tt.want)
+		}
+	}
+}
+
+func TestParseVideoTimestamp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value  string
+		want   int
+		wantOK bool
+	}{
+		{"42", 42, true},
+		{"3600", 3600, true},
+		{"", 0, false},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"abc", 0, false},
+		{"1.5", 0, false},
+		{"1:30", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := parseVideoTimestamp(tt.value); got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseVideoTimestamp(%q) = %d, %t, want %d, %t", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// The query of the page's oEmbed link
+func oembedLinkQuery(t *testing.T, page string) url.Values {
+	t.Helper()
+
+	const prefix = `<link rel="alternate" type="application/json+oembed" href="`
+
+	_, link, found := strings.Cut(page, prefix)
+	link, _, closed := strings.Cut(link, `"`)
+	if !found || !closed {
+		t.Fatalf("no oEmbed link in:\n%s", page)
+	}
+
+	// Not html.UnescapeString, it would read &times in &timestamp as ×, which browsers don't do inside attributes
+	parsedURL, parseErr := url.Parse(strings.ReplaceAll(link, "&amp;", "&"))
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+
+	return parsedURL.Query()
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostVideoTimestamp(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-video.json")
+
+	tests := []struct {
+		name     string
+		query    string
+		language string
+		// Empty if the video starts at the beginning
+		wantTimestamp string
+		wantMediaMsg  string
+	}{
+		{name: "none", query: ""},
+		{name: "90 seconds", query: "timestamp=90", wantTimestamp: "90", wantMediaMsg: "⏱️ Starts at 1:30"},
+		{name: "translated", query: "timestamp=5", language: "de", wantTimestamp: "5", wantMediaMsg: "⏱️ Beginnt bei 0:05"},
+		{name: "negative", query: "timestamp=-5"},
+		{name: "not a number", query: "timestamp=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/post/3kpost?"+tt.query, http.NoBody)
+			req.Header.Set("User-Agent", "TelegramBot (like TwitterBot)")
+			req.Header.Set("Accept-Language", tt.language)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			recorder := httptest.NewRecorder()
+			testHandlerPass().GetPost(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+			query := oembedLinkQuery(t, page)
+
+			if got := query.Get("timestamp"); got != tt.wantTimestamp {
+				t.Errorf("oEmbed timestamp = %q, want %q", got, tt.wantTimestamp)
+			}
+
+			if got := query.Get("mediaMsg"); got != tt.wantMediaMsg {
+				t.Errorf("oEmbed mediaMsg = %q, want %q", got, tt.wantMediaMsg)
+			}
+
+			if query.Get("video") != "did:plc:abc" || query.Get("post") != "3kpost" {
+				t.Errorf("oEmbed link doesn't point at the post: %v", query)
+			}
+
+			// The player starts there too
+			if tt.wantTimestamp == "" && strings.Contains(page, "#t=") {
+				t.Errorf("video source has a media fragment, want none:\n%s", page)
+			} else if tt.wantTimestamp != "" && !strings.Contains(page, `#t=`+tt.wantTimestamp+`" type="video/mp4">`) {
+				t.Errorf("video source doesn't start at %s:\n%s", tt.wantTimestamp, page)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostLocalized(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-reply-images.json")
+
+	tests := []struct {
+		language     string
+		wantMediaMsg string
+		// Every one of these has to be on the page
+		want []string
+	}{
+		{
+			language:     "",
+			wantMediaMsg: "Photo 2 of 3",
+			want:         []string{"💬 Replying to [blocked account]:", "🔒 Replies are disabled"},
+		},
+		{
+			language:     "de",
+			wantMediaMsg: "Foto 2 von 3",
+			want:         []string{"💬 Antwort an [blockiertes Konto]:", "🔒 Antworten sind deaktiviert"},
+		},
+		{
+			language:     "es-MX,es;q=0.9",
+			wantMediaMsg: "Foto 2 de 3",
+			want:         []string{"💬 Respondiendo a [cuenta bloqueada]:", "🔒 Las respuestas están desactivadas"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			recorder := requestPhoto(t, "2", "TelegramBot (like TwitterBot)", tt.language)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			if got := oembedLinkQuery(t, page).Get("mediaMsg"); got != tt.wantMediaMsg {
+				t.Errorf("oEmbed mediaMsg = %q, want %q", got, tt.wantMediaMsg)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+
+			if vary := recorder.Header().Values("Vary"); !slices.Contains(vary, "Accept-Language") {
+				t.Errorf("Vary = %q, want Accept-Language in it", vary)
+			}
+		})
+	}
+}
+
+// Like requestPost, for /photo/{photoNum} (all of them if photoNum is empty)
+func requestPhoto(t *testing.T, photoNum, userAgent, language string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	target := "https://example.test/profile/did:plc:abc/post/3kpost"
+	if photoNum != "" {
+		target += "/photo/" + photoNum
+	}
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, http.NoBody)
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Language", language)
+	req.SetPathValue("profileID", "did:plc:abc")
+	req.SetPathValue("postID", "3kpost")
+	req.SetPathValue("photoNum", photoNum)
+
+	recorder := httptest.NewRecorder()
+	testHandlerPass().GetPost(recorder, req)
+
+	return recorder
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostPhotoNav(t *testing.T) {
+	const photoPath = `/profile/did:plc:abc/post/3kpost/photo/`
+
+	tests := []struct {
+		name     string
+		fixture  string
+		photoNum string
+		// Empty if there shouldn't be a link
+		wantPrev string
+		wantNext string
+	}{
+		{name: "first", fixture: "thread-reply-images.json", photoNum: "1", wantNext: "2"},
+		{name: "middle", fixture: "thread-reply-images.json", photoNum: "2", wantPrev: "1", wantNext: "3"},
+		{name: "last", fixture: "thread-reply-images.json", photoNum: "3", wantPrev: "2"},
+		{name: "all of them", fixture: "thread-reply-images.json", photoNum: ""},
+		{name: "a mosaic of some", fixture: "thread-reply-images.json", photoNum: "1-2"},
+		{name: "only photo", fixture: "thread-single-image.json", photoNum: "1"},
+		{name: "gallery first", fixture: "thread-gallery.json", photoNum: "1", wantNext: "2"},
+		{name: "gallery last", fixture: "thread-gallery.json", photoNum: "2", wantPrev: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			// Telegram gets the article, everyone else the redirect page, both have the links
+			for _, userAgent := range []string{"TelegramBot (like TwitterBot)", "Mozilla/5.0"} {
+				recorder := requestPhoto(t, tt.photoNum, userAgent, "")
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("%s: status = %d", userAgent, recorder.Code)
+				}
+
+				page := recorder.Body.String()
+
+				for _, link := range []struct{ label, want string }{{"← Previous", tt.wantPrev}, {"Next →", tt.wantNext}} {
+					if link.want == "" && strings.Contains(page, link.label) {
+						t.Errorf("%s: got a %q link, want none:\n%s", userAgent, link.label, page)
+					} else if link.want != "" && !strings.Contains(page, `<a href="`+photoPath+link.want+`">`+link.label+`</a>`) {
+						t.Errorf("%s: no %q link to photo %s:\n%s", userAgent, link.label, link.want, page)
+					}
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostBaseURL(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-quote-images.json")
+
+	tests := []struct {
+		name    string
+		trusted bool
+		want    string
+	}{
+		{name: "direct", want: "http://10.0.0.2:8080/oembed?"},
+		{name: "behind a trusted proxy", trusted: true, want: "https://xbsky.test/oembed?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://10.0.0.2:8080/profile/did:plc:abc/post/3kpost", http.NoBody)
+			req.Header.Set("User-Agent", "TelegramBot (like TwitterBot)")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("X-Forwarded-Host", "xbsky.test")
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			ps := testHandlerPass()
+			ps.TrustForwarded = tt.trusted
+
+			recorder := httptest.NewRecorder()
+			ps.GetPost(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			if page := recorder.Body.String(); !strings.Contains(page, `type="application/json+oembed" href="`+tt.want) {
+				t.Errorf("the oEmbed link doesn't start with %s:\n%s", tt.want, page)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostExternalAspectRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		// Empty if the size isn't known
+		wantWidth, wantHeight string
+	}{
+		{name: "from the API", fixture: "thread-tenor-gif.json", wantWidth: "498", wantHeight: "280"},
+		{name: "from the Tenor URL", fixture: "thread-tenor-gif-url.json", wantWidth: "320", wantHeight: "240"},
+		{name: "unknown", fixture: "thread-quote-external.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			if tt.wantWidth == "" {
+				if strings.Contains(page, "og:image:width") || strings.Contains(page, "og:video:width") {
+					t.Errorf("got dimensions for an external embed without them:\n%s", page)
+				}
+
+				return
+			}
+
+			for _, want := range []string{
+				`<meta property="og:image:width" content="` + tt.wantWidth + `">`,
+				`<meta property="og:image:height" content="` + tt.wantHeight + `">`,
+				// Telegram plays Tenor GIFs as videos, and the article has the GIF too
+				`<meta property="og:video:width" content="` + tt.wantWidth + `">`,
+				`<meta property="og:video:height" content="` + tt.wantHeight + `">`,
+				`width="` + tt.wantWidth + `" height="` + tt.wantHeight + `">`,
+			} {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %s in:\n%s", want, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostDetachedQuote(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		// Whether the detached message is in the description
+		wantDetached bool
+		wantImage    string
+	}{
+		{name: "quote", fixture: "thread-detached-quote.json", wantDetached: true},
+		{name: "quote with media", fixture: "thread-detached-quote-images.json", wantDetached: true, wantImage: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkphoto@jpeg"},
+		// The parent's quote isn't ours to describe, and there's no media in it
+		{name: "reply to one", fixture: "thread-reply-detached-quote.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			if got := strings.Contains(page, msgDetachedQuote); got != tt.wantDetached {
+				t.Errorf("detached message on the page: %t, want %t:\n%s", got, tt.wantDetached, page)
+			}
+
+			// Nothing about whoever was quoted
+			if strings.Contains(page, "📝 Quoting") || strings.Contains(page, "did:plc:bob") {
+				t.Errorf("the detached post is on the page:\n%s", page)
+			}
+
+			gotImage := strings.Contains(page, `<meta property="og:image"`)
+			if gotImage != (tt.wantImage != "") || (gotImage && !strings.Contains(page, `<meta property="og:image" content="`+tt.wantImage+`">`)) {
+				t.Errorf("want og:image %q:\n%s", tt.wantImage, page)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostStatsStyle(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-quote-external.json")
+
+	tests := []struct {
+		style string
+		want  string
+	}{
+		{style: StatsStyleEmoji, want: "💬 1   🔁 2   🩷 3   📝 4"},
+		{style: StatsStyleCompact, want: "💬1 🔁2 🩷3 📝4"},
+		{style: StatsStyleText, want: "1 replies · 2 reposts · 3 likes · 4 quotes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			ps := testHandlerPass()
+			ps.StatsStyle = tt.style
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/post/3kpost", http.NoBody)
+			req.Header.Set("User-Agent", "TelegramBot (like TwitterBot)")
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			recorder := httptest.NewRecorder()
+			ps.GetPost(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+			if !strings.Contains(page, "<p>"+tt.want+"</p>") {
+				t.Errorf("no %q on the page:\n%s", tt.want, page)
+			}
+
+			// The oEmbed the page links to has to show the same thing
+			_, embed := requestOembed(t, ps, oembedLinkQuery(t, page).Encode(), "")
+			if embed.AuthorName != tt.want {
+				t.Errorf("oEmbed author_name = %q, want %q", embed.AuthorName, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCrawler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{userAgent: "TelegramBot (like TwitterBot)", want: crawlerTelegram},
+		{userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", want: crawlerSlack},
+		{userAgent: "Slack-ImgProxy (+https://api.slack.com/robots)", want: crawlerSlack},
+		{userAgent: "WhatsApp/2.23.20.0", want: crawlerWhatsApp},
+		{userAgent: "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", want: ""},
+		{userAgent: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := detectCrawler(tt.userAgent); got != tt.want {
+			t.Errorf("detectCrawler(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostSlackVideo(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-video.json")
+
+	const thumbnail = "https://video.bsky.app/watch/did:plc:abc/bafkvideo/thumbnail.jpg"
+
+	tests := []struct {
+		name      string
+		userAgent string
+		// Every one of these has to be on the page, none of the unwanted ones
+		want   []string
+		unwant []string
+	}{
+		{
+			name:      "Slack",
+			userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			want: []string{
+				`<meta property="twitter:card" content="summary_large_image">`,
+				`<meta property="og:image" content="` + thumbnail + `">`,
+				`<meta property="og:image:width" content="1080">`,
+				`<meta property="og:image:height" content="1920">`,
+				`<meta property="twitter:image" content="` + thumbnail + `">`,
+			},
+			unwant: []string{`property="og:video`, `content="player"`},
+		},
+		{
+			name:      "everyone else",
+			userAgent: "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)",
+			want: []string{
+				`<meta property="twitter:card" content="player">`,
+				`<meta property="og:video:type" content="video/mp4">`,
+				`<meta property="og:image" content="` + thumbnail + `">`,
+			},
+			unwant: []string{`content="summary_large_image"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := requestPost(t, "example.test", "", tt.userAgent)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range tt.want {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+
+			for _, unwant := range tt.unwant {
+				if strings.Contains(page, unwant) {
+					t.Errorf("got %q on the page, want none:\n%s", unwant, page)
+				}
+			}
+		})
+	}
+}
+
+func TestCDNVariant(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		imageURL string
+		want     string
+	}{
+		{
+			imageURL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkimage@jpeg",
+			want:     "https://cdn.bsky.app/img/feed_thumbnail/plain/did:plc:abc/bafkimage@jpeg",
+		},
+		{
+			imageURL: "https://cdn.bsky.app/img/avatar/plain/did:plc:abc/bafkimage@jpeg",
+			want:     "https://cdn.bsky.app/img/avatar/plain/did:plc:abc/bafkimage@jpeg",
+		},
+		{imageURL: "https://media.tenor.com/abc/tenor.gif", want: "https://media.tenor.com/abc/tenor.gif"},
+	}
+
+	for _, tt := range tests {
+		if got := cdnVariant(tt.imageURL, "feed_thumbnail"); got != tt.want {
+			t.Errorf("cdnVariant(%q) = %q, want %q", tt.imageURL, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostWhatsAppImage(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-single-image.json")
+
+	const (
+		fullSize  = "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkonly@jpeg"
+		thumbnail = "https://cdn.bsky.app/img/feed_thumbnail/plain/did:plc:abc/bafkonly@jpeg"
+	)
+
+	tests := []struct {
+		name      string
+		userAgent string
+		wantImage string
+	}{
+		{name: "WhatsApp", userAgent: "WhatsApp/2.23.20.0", wantImage: thumbnail},
+		{name: "everyone else", userAgent: "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", wantImage: fullSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := requestPost(t, "example.test", "", tt.userAgent)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			// Only og:image, which is what WhatsApp reads
+			for _, want := range []string{
+				`<meta property="og:image" content="` + tt.wantImage + `">`,
+				`<meta property="twitter:image" content="` + fullSize + `">`,
+			} {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostInteractionStatistic(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-quote-external.json")
+
+	// Quotes (4) have no schema.org action
+	want := map[string]int64{
+		"https://schema.org/CommentAction": 1,
+		"https://schema.org/ShareAction":   2,
+		"https://schema.org/LikeAction":    3,
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+	}{
+		{name: "Telegram", userAgent: "TelegramBot (like TwitterBot)"},
+		{name: "everyone else", userAgent: "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := requestPost(t, "example.test", "", tt.userAgent)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			_, script, found := strings.Cut(page, `<script type="application/ld+json">`)
+			script, _, closed := strings.Cut(script, "</script>")
+			if !found || !closed {
+				t.Fatalf("no JSON-LD on the page:\n%s", page)
+			}
+
+			var posting struct {
+				Type                 string `json:"@type"`
+				URL                  string `json:"url"`
+				InteractionStatistic []struct {
+					InteractionType      string `json:"interactionType"`
+					UserInteractionCount int64  `json:"userInteractionCount"`
+				} `json:"interactionStatistic"`
+			}
+
+			if decodeErr := json.Unmarshal([]byte(script), &posting); decodeErr != nil {
+				t.Fatalf("JSON-LD doesn't decode (%v):\n%s", decodeErr, script)
+			}
+
+			if posting.Type != "SocialMediaPosting" || posting.URL != "https://bsky.app/profile/alice.test/post/3kpost" {
+				t.Errorf("got a %s at %s, want a SocialMediaPosting at the post", posting.Type, posting.URL)
+			}
+
+			got := make(map[string]int64)
+			for _, stat := range posting.InteractionStatistic {
+				got[stat.InteractionType] = stat.UserInteractionCount
+			}
+
+			if !maps.Equal(got, want) {
+				t.Errorf("interactionStatistic = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidAspectRatio(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		aspectRatio types.APIAspectRatio
+		want        bool
+	}{
+		{aspectRatio: types.APIAspectRatio{Width: 1200, Height: 800}, want: true},
+		{aspectRatio: types.APIAspectRatio{Width: 1, Height: 1}, want: true},
+		{aspectRatio: types.APIAspectRatio{}, want: false},
+		{aspectRatio: types.APIAspectRatio{Width: 0, Height: 800}, want: false},
+		{aspectRatio: types.APIAspectRatio{Width: 1200, Height: 0}, want: false},
+		{aspectRatio: types.APIAspectRatio{Width: -1200, Height: 800}, want: false},
+		{aspectRatio: types.APIAspectRatio{Width: 1200, Height: -800}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := validAspectRatio(tt.aspectRatio); got != tt.want {
+			t.Errorf("validAspectRatio(%+v) = %t, want %t", tt.aspectRatio, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostBadAspectRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		// Every one of these has to be on the page exactly once
+		want []string
+		// None of these may be
+		unwant []string
+	}{
+		{
+			name:    "images",
+			fixture: "thread-bad-aspect-ratio.json",
+			// Only the one with a sane size gets dimensions
+			want: []string{
+				`<meta property="og:image:width" content="1200">`,
+				`<meta property="og:image:height" content="800">`,
+				`<meta property="twitter:image:width" content="1200">`,
+			},
+			unwant: []string{`content="-`, `og:image:width" content="0"`, `og:image:height" content="0"`, `og:image:width" content="800"`},
+		},
+		{
+			name:    "video",
+			fixture: "thread-video-bad-aspect-ratio.json",
+			// The player needs a size, so it's the default
+			want: []string{
+				`<meta property="og:video:width" content="1280">`,
+				`<meta property="og:video:height" content="720">`,
+				`<meta property="twitter:player:width" content="1280">`,
+			},
+			unwant: []string{`content="-`, "1920"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range tt.want {
+				if got := strings.Count(page, want); got != 1 {
+					t.Errorf("got %q %d times on the page, want once:\n%s", want, got, page)
+				}
+			}
+
+			for _, unwant := range tt.unwant {
+				if strings.Contains(page, unwant) {
+					t.Errorf("got %q on the page, want none:\n%s", unwant, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostAPIAltText(t *testing.T) {
+	tests := []struct {
+		name         string
+		fixture      string
+		wantAlts     []string
+		wantVideoAlt string
+	}{
+		{name: "images", fixture: "thread-reply-images.json", wantAlts: []string{"Morning", "Noon", "Evening"}},
+		{name: "gallery", fixture: "thread-gallery.json", wantAlts: []string{"Before", "After"}},
+		{name: "video", fixture: "thread-video.json", wantVideoAlt: "A sunset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "api.example.test", "", "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			var output struct {
+				ParsedData types.OwnData `json:"parsedData"`
+			}
+
+			if decodeErr := json.Unmarshal(recorder.Body.Bytes(), &output); decodeErr != nil {
+				t.Fatal(decodeErr)
+			}
+
+			var alts []string
+			for _, image := range output.ParsedData.Images {
+				alts = append(alts, image.Alt)
+			}
+
+			if !slices.Equal(alts, tt.wantAlts) {
+				t.Errorf("image alts = %q, want %q", alts, tt.wantAlts)
+			}
+
+			if output.ParsedData.VideoAlt != tt.wantVideoAlt {
+				t.Errorf("videoAlt = %q, want %q", output.ParsedData.VideoAlt, tt.wantVideoAlt)
+			}
+		})
+	}
+}
+
+func TestTenorMP4URL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		gifPath string
+		want    string
+	}{
+		{gifPath: "/AbCdEfGhIjKAAAAC/cat-monday.gif", want: "https://media.tenor.com/AbCdEfGhIjKAAAPo/cat-monday.mp4"},
+		{gifPath: "AbCdEfGhIjKAAAAC/cat-monday.gif", want: "https://media.tenor.com/AbCdEfGhIjKAAAPo/cat-monday.mp4"},
+		// Already something else than a GIF
+		{gifPath: "/AbCdEfGhIjKAAAPo/cat-monday.mp4", want: ""},
+		{gifPath: "/AbCdEfGhIjKAAAAC/cat-monday.webp", want: ""},
+		{gifPath: "/AAAAC/cat-monday.gif", want: ""},
+		{gifPath: "/AbCdEfGhIjKAAAAC/nested/cat-monday.gif", want: ""},
+		{gifPath: "/cat-monday.gif", want: ""},
+		{gifPath: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := tenorMP4URL(tt.gifPath); got != tt.want {
+			t.Errorf("tenorMP4URL(%q) = %q, want %q", tt.gifPath, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostTenorVideo(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-tenor-gif.json")
+
+	const mp4 = "https://media.tenor.com/AbCdEfGhIjKAAAPo/cat-monday.mp4"
+
+	tests := []struct {
+		name      string
+		userAgent string
+		wantVideo bool
+	}{
+		{name: "Telegram", userAgent: "TelegramBot (like TwitterBot)", wantVideo: true},
+		{name: "everyone else", userAgent: "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := requestPost(t, "example.test", "", tt.userAgent)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range []string{
+				`<meta property="og:video" content="` + mp4 + `">`,
+				`<meta property="og:video:secure_url" content="` + mp4 + `">`,
+				`<meta property="og:video:type" content="video/mp4">`,
+			} {
+				if got := strings.Contains(page, want); got != tt.wantVideo {
+					t.Errorf("got %q on the page %t, want %t:\n%s", want, got, tt.wantVideo, page)
+				}
+			}
+
+			// The GIF stays the image either way, for whoever can't play the video
+			if want := `<meta property="og:image" content="https://media.tenor.com/AbCdEfGhIjKAAAAC/cat-monday.gif">`; !strings.Contains(page, want) {
+				t.Errorf("no %q on the page:\n%s", want, page)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostQuotedFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		// Every one of these has to be in the description
+		want []string
+		// None of these may be on the page
+		unwant []string
+	}{
+		{
+			name:    "feed",
+			fixture: "thread-feed.json",
+			want:    []string{"Cats\n📡 A feed by Bob (@bob.test)\n\nOnly cats"},
+			unwant:  []string{"deleted feed"},
+		},
+		{
+			name:    "deleted feed",
+			fixture: "thread-deleted-feed.json",
+			want:    []string{"This feed was great\n\n📡 Quoting a deleted feed"},
+			// Not a blank card for it
+			unwant: []string{"A feed by", `content="summary_large_image"`, "og:image"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			_, description, _ := strings.Cut(page, `<meta property="og:description" content="`)
+			description, _, _ = strings.Cut(description, `">`)
+			description = html.UnescapeString(description)
+
+			for _, want := range tt.want {
+				if !strings.Contains(description, want) {
+					t.Errorf("no %q in the description %q", want, description)
+				}
+			}
+
+			for _, unwant := range tt.unwant {
+				if strings.Contains(page, unwant) {
+					t.Errorf("got %q on the page, want none:\n%s", unwant, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostLabeler(t *testing.T) {
+	tests := []struct {
+		name      string
+		fixture   string
+		wantTitle string
+	}{
+		{name: "labeler", fixture: "thread-labeler.json", wantTitle: "Alice's Moderation (@mod.alice.test) 🏷️"},
+		{name: "not a labeler", fixture: "thread-single-image.json", wantTitle: "Alice (@alice.test)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := html.UnescapeString(recorder.Body.String())
+
+			for _, want := range []string{
+				`<meta property="og:title" content="` + tt.wantTitle + `">`,
+				`<meta property="twitter:title" content="` + tt.wantTitle + `">`,
+			} {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostReplyCard(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		// Empty if there shouldn't be a card, otherwise everything that has to be in it
+		want []string
+		// None of these may be in it
+		unwant []string
+	}{
+		{
+			name:    "reply",
+			fixture: "thread-reply.json",
+			want: []string{
+				`<img src="https://cdn.bsky.app/img/avatar/plain/did:plc:bob/bafkbob@jpeg" alt="Avatar" width="48" height="48">`,
+				`<a href="https://bsky.app/profile/did:plc:bob/post/3kparent">💬 Replying to Bob (@bob.test):</a>`,
+				"<p>Two from the pier</p>",
+				"<p>🖼️ Images (2)</p>",
+			},
+		},
+		{
+			name:    "blocked parent",
+			fixture: "thread-reply-images.json",
+			want:    []string{"<p>💬 Replying to [blocked account]</p>", "<p>Show me the pier</p>"},
+			// Nothing that points at who it is
+			unwant: []string{"<img", "<a ", "did:plc:blocked"},
+		},
+		{name: "not a reply", fixture: "thread-single-image.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			_, card, found := strings.Cut(page, "<blockquote>")
+			card, _, _ = strings.Cut(card, "</blockquote>")
+
+			if found != (len(tt.want) > 0) {
+				t.Fatalf("got a reply card %t, want %t:\n%s", found, len(tt.want) > 0, page)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(card, want) {
+					t.Errorf("no %q in the reply card:\n%s", want, card)
+				}
+			}
+
+			for _, unwant := range tt.unwant {
+				if strings.Contains(card, unwant) {
+					t.Errorf("got %q in the reply card, want none:\n%s", unwant, card)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		lexiconType string
+		want        string
+	}{
+		{lexiconType: "app.bsky.embed.images#view", want: bskyEmbedImages},
+		{lexiconType: "app.bsky.embed.images", want: bskyEmbedImages},
+		{lexiconType: "app.bsky.embed.images#main", want: bskyEmbedImages},
+		{lexiconType: "app.bsky.embed.gallery", want: galleryImages},
+		{lexiconType: "app.bsky.embed.external", want: bskyEmbedExternal},
+		{lexiconType: "app.bsky.embed.video#main", want: bskyEmbedVideo},
+		{lexiconType: "app.bsky.embed.recordWithMedia", want: bskyEmbedQuote},
+		{lexiconType: "app.bsky.embed.record", want: bskyEmbedText},
+		// A fragment that isn't the view is kept, it means something else
+		{lexiconType: "app.bsky.embed.record#viewDetached", want: bskyEmbedRecordDetached},
+		{lexiconType: "app.bsky.embed.images#image", want: "app.bsky.embed.images#image"},
+		// Close, but not the same lexicon
+		{lexiconType: "app.bsky.embed.imagesExtra", want: "app.bsky.embed.imagesExtra"},
+		{lexiconType: "app.example.embed.images", want: "app.example.embed.images"},
+		{lexiconType: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := embedType(tt.lexiconType); got != tt.want {
+			t.Errorf("embedType(%q) = %q, want %q", tt.lexiconType, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostEmbedTypeWithoutFragment(t *testing.T) {
+	const image = "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkonly@jpeg"
+
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{name: "with #view", fixture: "thread-single-image.json"},
+		{name: "without", fixture: "thread-image-no-fragment.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			// Both come out the same, rather than as an unknown type
+			recorder := requestPost(t, "api.example.test", "", "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			var output struct {
+				ParsedData types.OwnData `json:"parsedData"`
+			}
+
+			if decodeErr := json.Unmarshal(recorder.Body.Bytes(), &output); decodeErr != nil {
+				t.Fatal(decodeErr)
+			}
+
+			if output.ParsedData.Type != bskyEmbedImages || len(output.ParsedData.Images) != 1 || output.ParsedData.Images[0].FullSize != image {
+				t.Errorf("got a %s with %d images, want a %s with the one", output.ParsedData.Type, len(output.ParsedData.Images), bskyEmbedImages)
+			}
+
+			recorder = requestPost(t, "example.test", "", "")
+			if want := `<meta property="og:image" content="` + image + `">`; !strings.Contains(recorder.Body.String(), want) {
+				t.Errorf("no %q on the page:\n%s", want, recorder.Body)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostCanonical(t *testing.T) {
+	stubPostThread(t, http.StatusOK, "thread-single-image.json")
+
+	tests := []struct {
+		name          string
+		query         string
+		canonicalSelf bool
+		want          string
+	}{
+		{name: "bsky.app", want: "https://bsky.app/profile/alice.test/post/3kpost"},
+		{name: "self", canonicalSelf: true, want: "https://example.test/profile/alice.test/post/3kpost"},
+		{name: "lite page", query: "lite=1", want: "https://bsky.app/profile/alice.test/post/3kpost"},
+		{name: "lite page on self", query: "lite=1", canonicalSelf: true, want: "https://example.test/profile/alice.test/post/3kpost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := testHandlerPass()
+			ps.CanonicalSelf = tt.canonicalSelf
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/post/3kpost?"+tt.query, http.NoBody)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			recorder := httptest.NewRecorder()
+			ps.GetPost(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			// Exactly one, with the handle rather than the DID it was asked for with
+			page := recorder.Body.String()
+			if want := `<link rel="canonical" href="` + tt.want + `">`; strings.Count(page, `rel="canonical"`) != 1 || !strings.Contains(page, want) {
+				t.Errorf("want only %q on the page:\n%s", want, page)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostRepliesDisabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    bool
+	}{
+		{name: "turned off by the viewer flag", fixture: "thread-reply-images.json", want: true},
+		{name: "no one allowed by the threadgate", fixture: "thread-threadgate-closed.json", want: true},
+		// Still open to some, so not disabled
+		{name: "followers only", fixture: "thread-threadgate-followers.json"},
+		{name: "no threadgate", fixture: "thread-single-image.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			if got := strings.Contains(recorder.Body.String(), "<p>🔒 Replies are disabled</p>"); got != tt.want {
+				t.Errorf("got the note %t, want %t:\n%s", got, tt.want, recorder.Body)
+			}
+
+			recorder = requestPost(t, "api.example.test", "", "")
+
+			var output struct {
+				ParsedData types.OwnData `json:"parsedData"`
+			}
+
+			if decodeErr := json.Unmarshal(recorder.Body.Bytes(), &output); decodeErr != nil {
+				t.Fatal(decodeErr)
+			}
+
+			if output.ParsedData.RepliesDisabled != tt.want {
+				t.Errorf("repliesDisabled = %t, want %t", output.ParsedData.RepliesDisabled, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteTimestamp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		createdAt string
+		enabled   bool
+		want      string
+		wantOK    bool
+	}{
+		{createdAt: "2024-04-30T08:00:00.000Z", enabled: true, want: "🕒 30 Apr 2024 08:00 UTC", wantOK: true},
+		// Always shown in UTC
+		{createdAt: "2023-12-24T18:30:00.000-05:00", enabled: true, want: "🕒 24 Dec 2023 23:30 UTC", wantOK: true},
+		{createdAt: "2024-04-30T08:00:00.000Z", enabled: false},
+		{createdAt: "", enabled: true},
+		{createdAt: "last Tuesday", enabled: true},
+		{createdAt: "2024-04-30", enabled: true},
+	}
+
+	for _, tt := range tests {
+		ps := testHandlerPass()
+		ps.QuoteTimestamps = tt.enabled
+
+		if got, ok := ps.quoteTimestamp(tt.createdAt); got != tt.want || ok != tt.wantOK {
+			t.Errorf("quoteTimestamp(%q) with it %t = %q, %t, want %q, %t", tt.createdAt, tt.enabled, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostQuoteTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		enabled bool
+		// Empty if there shouldn't be one
+		want string
+	}{
+		{name: "quote", fixture: "thread-quote.json", enabled: true, want: "Lakes are better in winter\n🕒 24 Dec 2023 23:30 UTC"},
+		{name: "quote with media", fixture: "thread-quote-images.json", enabled: true, want: "Post your favorite lake\n🕒 30 Apr 2024 08:00 UTC"},
+		{name: "turned off", fixture: "thread-quote.json"},
+		{name: "unreadable date", fixture: "thread-quote-bad-date.json", enabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			ps := testHandlerPass()
+			ps.QuoteTimestamps = tt.enabled
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/post/3kpost", http.NoBody)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			recorder := httptest.NewRecorder()
+			ps.GetPost(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			_, description, _ := strings.Cut(recorder.Body.String(), `<meta property="og:description" content="`)
+			description, _, _ = strings.Cut(description, `">`)
+			description = html.UnescapeString(description)
+
+			if !strings.Contains(description, "📝 Quoting") {
+				t.Fatalf("no quote in the description %q", description)
+			}
+
+			if tt.want == "" && strings.Contains(description, "🕒") {
+				t.Errorf("got a timestamp in the description %q, want none", description)
+			} else if !strings.Contains(description, tt.want) {
+				t.Errorf("no %q in the description %q", tt.want, description)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostMosaicOGImage(t *testing.T) {
+	const mosaic = "https://mosaic.example.test/profile/did:plc:abc/post/3kpost"
+
+	tests := []struct {
+		name      string
+		fixture   string
+		enabled   bool
+		userAgent string
+		want      string
+	}{
+		{name: "multiple images", fixture: "thread-reply-images.json", enabled: true, want: mosaic},
+		{
+			name:    "multiple images, turned off",
+			fixture: "thread-reply-images.json",
+			want:    "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkfirst@jpeg",
+		},
+		// Telegram only shows one image, so it always gets the mosaic
+		{name: "multiple images, Telegram", fixture: "thread-reply-images.json", userAgent: "TelegramBot (like TwitterBot)", want: mosaic},
+		{
+			name:    "one image",
+			fixture: "thread-single-image.json",
+			enabled: true,
+			want:    "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkonly@jpeg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			ps := testHandlerPass()
+			ps.MosaicOGImage = tt.enabled
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/post/3kpost", http.NoBody)
+			req.Header.Set("User-Agent", tt.userAgent)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			recorder := httptest.NewRecorder()
+			ps.GetPost(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			// The first og:image is the one that's used
+			_, image, _ := strings.Cut(page, `<meta property="og:image" content="`)
+			image, _, _ = strings.Cut(image, `">`)
+
+			if image != tt.want {
+				t.Errorf("og:image = %q, want %q", image, tt.want)
+			}
+
+			if want := `<meta property="twitter:image" content="` + tt.want + `">`; !strings.Contains(page, want) {
+				t.Errorf("no %q on the page:\n%s", want, page)
+			}
+
+			if got := strings.Contains(page, mosaic); got != (tt.want == mosaic) {
+				t.Errorf("got the mosaic on the page %t, want %t", got, tt.want == mosaic)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostExternalDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		siteName bool
+		// Empty if there shouldn't be a label
+		wantDomain   string
+		wantSiteName string
+	}{
+		{name: "domain", fixture: "thread-external.json", wantDomain: "news.example.com", wantSiteName: "example.test"},
+		{name: "in the site name", fixture: "thread-external.json", siteName: true, wantDomain: "news.example.com", wantSiteName: "example.test · news.example.com"},
+		{name: "unparsable URL", fixture: "thread-external-bad-url.json", siteName: true, wantSiteName: "example.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			ps := testHandlerPass()
+			ps.ExternalSiteName = tt.siteName
+
+			for _, query := range []string{"", "lite=1"} {
+				req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc/post/3kpost?"+query, http.NoBody)
+				req.Header.Set("User-Agent", "TelegramBot (like TwitterBot)")
+				req.SetPathValue("profileID", "did:plc:abc")
+				req.SetPathValue("postID", "3kpost")
+
+				recorder := httptest.NewRecorder()
+				ps.GetPost(recorder, req)
+
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("%s: status = %d", query, recorder.Code)
+				}
+
+				page := recorder.Body.String()
+
+				// The card's label, both pages have their own
+				label := "<small>🔗 " + tt.wantDomain + "</small>"
+				if query != "" {
+					label = "</a> <small>" + tt.wantDomain + "</small>"
+				}
+
+				if tt.wantDomain == "" && (strings.Contains(page, "<small>🔗") || strings.Contains(page, "</a> <small>")) {
+					t.Errorf("%s: got a domain label, want none:\n%s", query, page)
+				} else if tt.wantDomain != "" && !strings.Contains(page, label) {
+					t.Errorf("%s: no %q on the page:\n%s", query, label, page)
+				}
+
+				if want := `<meta property="og:site_name" content="` + tt.wantSiteName + `">`; query == "" && !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostParentRepostedBy(t *testing.T) {
+	const repostedBy = "🔁 Parent reposted by Carol (@carol.test)"
+
+	tests := []struct {
+		name    string
+		fixture string
+		want    bool
+	}{
+		{name: "reposted", fixture: "thread-reply-reposted.json", want: true},
+		{name: "pinned", fixture: "thread-reply-pinned.json"},
+		{name: "no reason", fixture: "thread-reply.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			// In the card on Telegram, only in the description everywhere else (there's no card there)
+			for userAgent, want := range map[string]string{
+				"TelegramBot (like TwitterBot)": "<p><small>" + repostedBy + "</small></p>",
+				"Discordbot":                    repostedBy,
+			} {
+				recorder := requestPost(t, "example.test", "", userAgent)
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("%s: status = %d", userAgent, recorder.Code)
+				}
+
+				page := recorder.Body.String()
+
+				if got := strings.Contains(page, want); got != tt.want {
+					t.Errorf("%s: got %q %t, want %t:\n%s", userAgent, want, got, tt.want, page)
+				}
+
+				if !tt.want && strings.Contains(page, "reposted by") {
+					t.Errorf("%s: got a repost note, want none:\n%s", userAgent, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostLitePage(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    []string
+	}{
+		{
+			name:    "image",
+			fixture: "thread-single-image.json",
+			want: []string{
+				"<p><b>Alice</b> <small>@alice.test</small></p>",
+				"<p>Just the one</p>",
+				// The thumbnail, linking to the full size
+				`<a href="https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:abc/bafkonly@jpeg"><img src="https://cdn.bsky.app/img/feed_thumbnail/plain/did:plc:abc/bafkonly@jpeg" alt="A boat" loading="lazy"></a>`,
+				"<p><small>💬 0   🔁 0   🩷 1   📝 0</small></p>",
+				`<p><a href="https://bsky.app/profile/alice.test/post/3kpost">Open on Bluesky</a></p>`,
+			},
+		},
+		{
+			name:    "video",
+			fixture: "thread-video.json",
+			want:    []string{`<p><a href="https://bsky.social/xrpc/com.atproto.sync.getBlob?cid=bafkvideo&did=did%3aplc%3aabc">🎬 Video</a></p>`},
+		},
+		{
+			name:    "reply",
+			fixture: "thread-reply.json",
+			want: []string{
+				`<p><small><a href="https://bsky.app/profile/did:plc:bob/post/3kparent">💬 Replying to Bob (@bob.test):</a></small></p>`,
+				"<p>Two from the pier</p>",
+				"<p><small>🖼️ Images (2)</small></p>",
+			},
+		},
+		{
+			name:    "external",
+			fixture: "thread-external.json",
+			want:    []string{`<p><a href="https://WWW.News.Example.com:8443/story?id=1">🔗 A story</a> <small>news.example.com</small></p>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "lite=1", "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range tt.want {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+
+			// Nothing that loads up front but the (lazy) thumbnails
+			for _, unwant := range []string{"<script", "<video", `rel="stylesheet"`, `property="og:image"`, `property="og:video`, `name="twitter:`} {
+				if strings.Contains(page, unwant) {
+					t.Errorf("got %q on the page, want none:\n%s", unwant, page)
+				}
+			}
+
+			if images, lazy := strings.Count(page, "<img"), strings.Count(page, `loading="lazy"`); images != lazy {
+				t.Errorf("%d images, only %d of them lazy:\n%s", images, lazy, page)
+			}
+
+			// The rich page is still the default
+			recorder = requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+			if page := recorder.Body.String(); strings.Contains(page, "Open on Bluesky") || !strings.Contains(page, `property="og:`) {
+				t.Errorf("got the lite page without lite=1:\n%s", page)
+			}
+		})
+	}
+}
+
+// Quotes with media have it one level down, for parents too
+//
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostParentQuoteMedia(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{name: "images", fixture: "thread-reply-quote-images.json"},
+		{name: "gallery", fixture: "thread-reply-quote-gallery.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPostThread(t, http.StatusOK, tt.fixture)
+
+			recorder := requestPost(t, "example.test", "", "TelegramBot (like TwitterBot)")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range []string{
+				`<img src="https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:bob/bafkdawn@jpeg" alt="Dawn" width="1000" height="800">`,
+				`<img src="https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:bob/bafkdusk@jpeg" alt="Dusk" width="1000" height="800">`,
+				"<p>🖼️ Images (2)</p>",
+			} {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+
+			// Single photos can be picked out of them too
+			recorder = requestPhoto(t, "2", "TelegramBot (like TwitterBot)", "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("photo 2: status = %d", recorder.Code)
+			}
+
+			if got := oembedLinkQuery(t, recorder.Body.String()).Get("mediaMsg"); got != "Photo 2 of 2" {
+				t.Errorf("oEmbed mediaMsg = %q, want %q", got, "Photo 2 of 2")
+			}
+		})
+	}
+}
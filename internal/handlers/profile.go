@@ -7,14 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"main/internal/helpers"
 	"main/internal/types"
+
+	"golang.org/x/text/message"
 )
 
-var profileTemplate = template.Must(template.ParseFiles("./views/profile.html"))
+// Parsed by LoadTemplates
+var profileTemplate *template.Template
 
 func (ps *HandlerPass) GetProfile(w http.ResponseWriter, r *http.Request) {
 	profileID := r.PathValue("profileID")
@@ -33,52 +38,66 @@ func (ps *HandlerPass) GetProfile(w http.ResponseWriter, r *http.Request) {
 
 	req, reqErr := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
 	if reqErr != nil {
-		ErrorPage(w, "getProfile: Failed to create request")
+		ErrorPage(w, pageErrorf(ErrInternal, "getProfile: Failed to create request"))
 		return
 	}
 
-	resp, respErr := helpers.TimeoutClient.Do(req)
+	resp, respErr := helpers.CachedClient.Do(req)
 	if errors.Is(respErr, context.DeadlineExceeded) {
-		ErrorPage(w, "getProfile: Bluesky took too long to respond (timeout exceeded)")
+		ErrorPage(w, pageErrorf(ErrTimeout, "getProfile: Timeout exceeded"))
 		return
 	} else if respErr != nil {
-		ErrorPage(w, "getProfile: Failed to do request")
+		ErrorPage(w, pageErrorf(ErrUpstream, "getProfile: Failed to do request"))
 		return
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		ErrorPage(w, fmt.Sprintf("getProfile: Unexpected status (%s)", resp.Status))
+		ErrorPage(w, upstreamStatusError("getProfile", resp))
 		return
 	}
 
 	var profile types.UserProfile
-	if decodeErr := json.NewDecoder(resp.Body).Decode(&profile); decodeErr != nil {
-		ErrorPage(w, "getProfile: Failed to decode response")
+	decodeErr := json.NewDecoder(resp.Body).Decode(&profile)
+	helpers.DebugDecode(r.Context(), "getProfile", decodeErr)
+
+	if decodeErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getProfile: Failed to decode response"))
 		return
 	}
 
-	if len(plcData.AKA) > 0 {
-		profile.Handle = strings.TrimPrefix(plcData.AKA[0], "at://")
+	profile.Handle = ps.preferredHandle(profile.Handle, plcData)
 
-		if profile.DisplayName == "" {
-			profile.DisplayName = profile.Handle
-		}
+	if profile.DisplayName == "" {
+		profile.DisplayName = profile.Handle
 	}
 
 	if strings.HasPrefix(r.Host, "api.") {
 		w.Header().Set("Content-Type", "application/json")
 
 		if encodeErr := json.NewEncoder(w).Encode(&profile); encodeErr != nil {
-			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			ErrorJSON(w, pageErrorf(ErrInternal, "Failed to encode JSON"))
 			return
 		}
 
 		return
 	}
 
-	isTelegramAgent := strings.Contains(r.Header.Get("User-Agent"), "Telegram")
+	// The title already has the badge, this lists what they label
+	if profile.Associated.Labeler {
+		if labels, ok := getLabelerLabels(r.Context(), editedPID); ok {
+			profile.Description = strings.TrimSpace("🏷️ Labels: " + labels + "\n\n" + profile.Description)
+		}
+	}
+
+	if counts := associatedCounts(ps.localizer(w, r), profile.Associated); counts != "" {
+		profile.Description = strings.TrimSpace(profile.Description + "\n\n" + counts)
+	}
+
+	profile.Avatar = ps.avatarOrFallback(profile.Avatar)
+
+	isTelegramAgent := detectCrawler(r.Header.Get("User-Agent")) == crawlerTelegram
 
 	encodedID := types.RichActivityEncoded{
 		Type:   "prof",
@@ -87,9 +106,80 @@ func (ps *HandlerPass) GetProfile(w http.ResponseWriter, r *http.Request) {
 
 	marshaled, err := json.Marshal(encodedID)
 	if err != nil {
-		ErrorPage(w, "getProfile: failed to marshal for activity")
+		ErrorPage(w, pageErrorf(ErrInternal, "getProfile: Failed to marshal for activity"))
 		return
 	}
 
-	profileTemplate.Execute(w, map[string]any{"profile": profile, "isTelegram": isTelegramAgent, "encodedID": hex.EncodeToString(marshaled), "passData": ps})
+	ps.setPageCacheControl(w, CacheProfile)
+
+	profileTemplate.Execute(w, profileTemplateData{
+		Profile:    profile,
+		EncodedID:  hex.EncodeToString(marshaled),
+		BaseURL:    helpers.BaseURL(r, ps.TrustForwarded),
+		IsTelegram: isTelegramAgent,
+		PassData:   ps,
+	})
+}
+
+// The labels a labeler offers aren't part of the profile, they're in its service record
+func getLabelerLabels(ctx context.Context, did string) (string, bool) {
+	apiURL := "https://public.api.bsky.app/xrpc/app.bsky.labeler.getServices?detailed=true&dids=" + url.QueryEscape(did)
+	if helpers.IsBlueskyDead.Load() {
+		apiURL = "https://api.bsky.app/xrpc/app.bsky.labeler.getServices?detailed=true&dids=" + url.QueryEscape(did)
+	}
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, http.NoBody)
+	if reqErr != nil {
+		return "", false
+	}
+
+	resp, respErr := helpers.TimeoutClient.Do(req)
+	if respErr != nil {
+		return "", false
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+
+	var services types.APILabelerServices
+	if decodeErr := json.NewDecoder(io.LimitReader(resp.Body, helpers.MaxReadLimit)).Decode(&services); decodeErr != nil {
+		return "", false
+	}
+
+	if len(services.Views) == 0 || len(services.Views[0].Policies.LabelValues) == 0 {
+		return "", false
+	}
+
+	labels := services.Views[0].Policies.LabelValues
+	if len(labels) > maxLabelerLabels {
+		return fmt.Sprintf("%s and %d more", strings.Join(labels[:maxLabelerLabels], ", "), len(labels)-maxLabelerLabels), true
+	}
+
+	return strings.Join(labels, ", "), true
+}
+
+// "📡 3 feeds · 📋 2 lists · 📦 1 starter pack", leaving out the ones they have none of
+func associatedCounts(printer *message.Printer, associated types.APIAssociated) string {
+	var counts []string
+
+	for _, count := range []struct {
+		value     int64
+		one, many string
+	}{
+		{associated.Feedgens, msgOneFeed, msgFeeds},
+		{associated.Lists, msgOneList, msgLists},
+		{associated.StarterPacks, msgOnePack, msgPacks},
+	} {
+		switch {
+		case count.value == 1:
+			counts = append(counts, printer.Sprintf(count.one))
+		case count.value > 1:
+			counts = append(counts, printer.Sprintf(count.many, helpers.ToNotation(count.value)))
+		}
+	}
+
+	return strings.Join(counts, " · ")
 }
@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"main/internal/types"
+)
+
+// Bluesky, with getProfile answering the fixture in testdata, getServices the labeler one and the PLC directory the DID document one (an empty one if there isn't)
+func stubProfile(t *testing.T, fixture, labelerFixture, plcFixture string) {
+	t.Helper()
+
+	fixtures := map[string][]byte{"/did:plc:abc": []byte("{}")}
+	for path, name := range map[string]string{
+		"/xrpc/app.bsky.actor.getProfile":    fixture,
+		"/xrpc/app.bsky.labeler.getServices": labelerFixture,
+		"/did:plc:abc":                       plcFixture,
+	} {
+		if name == "" {
+			continue
+		}
+
+		body, readErr := os.ReadFile(filepath.Join("testdata", name))
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+
+		fixtures[path] = body
+	}
+
+	stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, found := fixtures[r.URL.Path]
+
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// ps.GetProfile's answer for did:plc:abc
+func requestProfile(t *testing.T, ps *HandlerPass) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/profile/did:plc:abc", http.NoBody)
+	req.SetPathValue("profileID", "did:plc:abc")
+
+	recorder := httptest.NewRecorder()
+	ps.GetProfile(recorder, req)
+
+	return recorder
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetProfileBanner(t *testing.T) {
+	const (
+		avatar = "https://cdn.bsky.app/img/avatar/plain/did:plc:abc/bafkreiavatar@jpeg"
+		banner = "https://cdn.bsky.app/img/banner/plain/did:plc:abc/bafkreibanner@jpeg"
+	)
+
+	tests := []struct {
+		name      string
+		fixture   string
+		useBanner bool
+		wantImage string
+		wantCard  string
+	}{
+		{name: "banner", fixture: "profile-banner.json", useBanner: true, wantImage: banner, wantCard: "summary_large_image"},
+		{name: "banner turned off", fixture: "profile-banner.json", wantImage: avatar, wantCard: "summary"},
+		{name: "no banner", fixture: "profile-no-banner.json", useBanner: true, wantImage: avatar, wantCard: "summary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubProfile(t, tt.fixture, "", "")
+
+			ps := testHandlerPass()
+			ps.ProfileBanner = tt.useBanner
+
+			recorder := requestProfile(t, ps)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range []string{
+				`<meta property="og:image" content="` + tt.wantImage + `">`,
+				`<meta property="twitter:image" content="` + tt.wantImage + `">`,
+				`<meta property="twitter:card" content="` + tt.wantCard + `">`,
+			} {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+
+			if got := strings.Count(page, `property="og:image"`); got != 1 {
+				t.Errorf("got %d og:image tags, want 1", got)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetProfileLabeler(t *testing.T) {
+	tests := []struct {
+		name           string
+		fixture        string
+		labelerFixture string
+		wantTitle      string
+		// Empty if it shouldn't be there
+		wantLabels string
+	}{
+		{
+			name:           "labeler",
+			fixture:        "profile-labeler.json",
+			labelerFixture: "labeler-services.json",
+			wantTitle:      "Alice's Moderation (@mod.alice.test) 🏷️",
+			wantLabels:     "🏷️ Labels: spam, impersonation, rude",
+		},
+		// Still a labeler, just without the list
+		{name: "no services", fixture: "profile-labeler.json", wantTitle: "Alice's Moderation (@mod.alice.test) 🏷️"},
+		{name: "not a labeler", fixture: "profile-no-banner.json", labelerFixture: "labeler-services.json", wantTitle: "Alice (@alice.test)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubProfile(t, tt.fixture, tt.labelerFixture, "")
+
+			recorder := requestProfile(t, testHandlerPass())
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := html.UnescapeString(recorder.Body.String())
+
+			if want := `<meta property="og:title" content="` + tt.wantTitle + `">`; !strings.Contains(page, want) {
+				t.Errorf("no %q on the page:\n%s", want, page)
+			}
+
+			if tt.wantLabels == "" && strings.Contains(page, "🏷️ Labels:") {
+				t.Errorf("got labels on the page, want none:\n%s", page)
+			} else if !strings.Contains(page, tt.wantLabels) {
+				t.Errorf("no %q on the page:\n%s", tt.wantLabels, page)
+			}
+		})
+	}
+}
+
+func TestPreferredHandle(t *testing.T) {
+	t.Parallel()
+
+	plcData := types.PLCDirectory{AKA: []string{"at://old-alice.test"}}
+
+	tests := []struct {
+		name          string
+		source        string
+		appViewHandle string
+		plcData       types.PLCDirectory
+		want          string
+	}{
+		{name: "AppView", source: HandleSourceAppView, appViewHandle: "alice.test", plcData: plcData, want: "alice.test"},
+		{name: "AppView, invalid handle", source: HandleSourceAppView, appViewHandle: "handle.invalid", plcData: plcData, want: "old-alice.test"},
+		{name: "AppView, no handle", source: HandleSourceAppView, plcData: plcData, want: "old-alice.test"},
+		{name: "AppView, nothing in the PLC", source: HandleSourceAppView, appViewHandle: "handle.invalid", want: "handle.invalid"},
+		{name: "PLC", source: HandleSourcePLC, appViewHandle: "alice.test", plcData: plcData, want: "old-alice.test"},
+		{name: "PLC, nothing in it", source: HandleSourcePLC, appViewHandle: "alice.test", want: "alice.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := testHandlerPass()
+			ps.HandleSource = tt.source
+
+			if got := ps.preferredHandle(tt.appViewHandle, tt.plcData); got != tt.want {
+				t.Errorf("preferredHandle(%q) = %q, want %q", tt.appViewHandle, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidHandle(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{handle: "alice.test", want: true},
+		{handle: "Alice.Bsky.Social", want: true},
+		{handle: "xn--ls8h.test", want: true},
+		{handle: "", want: false},
+		{handle: "handle.invalid", want: false},
+		{handle: "alice", want: false},
+		{handle: "alice..test", want: false},
+		{handle: "-alice.test", want: false},
+		{handle: "alice.123", want: false},
+		{handle: "al_ice.test", want: false},
+		{handle: strings.Repeat("a", 64) + ".test", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isValidHandle(tt.handle); got != tt.want {
+			t.Errorf("isValidHandle(%q) = %t, want %t", tt.handle, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetProfileHandleSource(t *testing.T) {
+	stubProfile(t, "profile-no-banner.json", "", "plc-old-handle.json")
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{source: HandleSourceAppView, want: "alice.test"},
+		{source: HandleSourcePLC, want: "old-alice.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			ps := testHandlerPass()
+			ps.HandleSource = tt.source
+
+			recorder := requestProfile(t, ps)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			for _, want := range []string{
+				`<meta property="og:title" content="Alice (@` + tt.want + `)">`,
+				`<meta property="og:url" content="https://bsky.app/profile/` + tt.want + `">`,
+			} {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %q on the page:\n%s", want, page)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetProfileCanonical(t *testing.T) {
+	stubProfile(t, "profile-no-banner.json", "", "")
+
+	tests := []struct {
+		name          string
+		canonicalSelf bool
+		want          string
+	}{
+		{name: "bsky.app", want: "https://bsky.app/profile/alice.test"},
+		{name: "self", canonicalSelf: true, want: "https://example.test/profile/alice.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := testHandlerPass()
+			ps.CanonicalSelf = tt.canonicalSelf
+
+			recorder := requestProfile(t, ps)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+			if want := `<link rel="canonical" href="` + tt.want + `">`; strings.Count(page, `rel="canonical"`) != 1 || !strings.Contains(page, want) {
+				t.Errorf("want only %q on the page:\n%s", want, page)
+			}
+		})
+	}
+}
+
+func TestAssociatedCounts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		associated types.APIAssociated
+		language   string
+		want       string
+	}{
+		{name: "none", associated: types.APIAssociated{}, want: ""},
+		{name: "one of each", associated: types.APIAssociated{Feedgens: 1, Lists: 1, StarterPacks: 1}, want: "📡 1 feed · 📋 1 list · 📦 1 starter pack"},
+		{name: "many", associated: types.APIAssociated{Feedgens: 3, Lists: 2, StarterPacks: 4}, want: "📡 3 feeds · 📋 2 lists · 📦 4 starter packs"},
+		{name: "some", associated: types.APIAssociated{Lists: 2}, want: "📋 2 lists"},
+		{name: "shortened", associated: types.APIAssociated{Feedgens: 1500}, want: "📡 1.5K feeds"},
+		// Anything that isn't a count is left out
+		{name: "negative", associated: types.APIAssociated{Feedgens: -1, Lists: 2}, want: "📋 2 lists"},
+		{name: "translated", associated: types.APIAssociated{Feedgens: 1, Lists: 2}, language: "de", want: "📡 1 Feed · 📋 2 Listen"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/", http.NoBody)
+			req.Header.Set("Accept-Language", tt.language)
+
+			if got := associatedCounts(testHandlerPass().localizer(httptest.NewRecorder(), req), tt.associated); got != tt.want {
+				t.Errorf("associatedCounts(%+v) = %q, want %q", tt.associated, got, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetProfileAssociatedCounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    string
+	}{
+		{name: "counts", fixture: "profile-associated.json", want: "Hello\n\n📡 1.2K feeds · 📋 2 lists · 📦 1 starter pack"},
+		{name: "none", fixture: "profile-no-banner.json", want: "Hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubProfile(t, tt.fixture, "", "")
+
+			recorder := requestProfile(t, testHandlerPass())
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			_, description, _ := strings.Cut(recorder.Body.String(), `<meta property="og:description" content="`)
+			description, _, _ = strings.Cut(description, `">`)
+
+			if got := html.UnescapeString(description); got != tt.want {
+				t.Errorf("og:description = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvatarOrFallback(t *testing.T) {
+	t.Parallel()
+
+	const (
+		avatar   = "https://cdn.bsky.app/img/avatar/plain/did:plc:abc/bafkreiavatar@jpeg"
+		fallback = "https://example.test/static/avatar.png"
+	)
+
+	tests := []struct {
+		name     string
+		avatar   string
+		fallback string
+		want     string
+	}{
+		{name: "avatar", avatar: avatar, fallback: fallback, want: avatar},
+		{name: "no avatar", fallback: fallback, want: fallback},
+		{name: "avatar, no fallback", avatar: avatar, want: avatar},
+		{name: "neither", want: ""},
+	}
+
+	for _, tt := range tests {
+		ps := testHandlerPass()
+		ps.FallbackAvatar = tt.fallback
+
+		if got := ps.avatarOrFallback(tt.avatar); got != tt.want {
+			t.Errorf("%s: avatarOrFallback(%q) = %q, want %q", tt.name, tt.avatar, got, tt.want)
+		}
+	}
+}
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetProfileFallbackAvatar(t *testing.T) {
+	const (
+		avatar   = "https://cdn.bsky.app/img/avatar/plain/did:plc:abc/bafkreiavatar@jpeg"
+		fallback = "https://example.test/static/avatar.png"
+	)
+
+	tests := []struct {
+		name     string
+		fixture  string
+		fallback string
+		// Empty if there shouldn't be an og:image
+		want string
+	}{
+		{name: "no avatar", fixture: "profile-no-avatar.json", fallback: fallback, want: fallback},
+		{name: "no avatar, no fallback", fixture: "profile-no-avatar.json"},
+		{name: "avatar", fixture: "profile-no-banner.json", fallback: fallback, want: avatar},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubProfile(t, tt.fixture, "", "")
+
+			ps := testHandlerPass()
+			ps.FallbackAvatar = tt.fallback
+
+			recorder := requestProfile(t, ps)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			page := recorder.Body.String()
+
+			if tt.want == "" && strings.Contains(page, "og:image") {
+				t.Errorf("got an og:image, want none:\n%s", page)
+			} else if want := `<meta property="og:image" content="` + tt.want + `">`; tt.want != "" && !strings.Contains(page, want) {
+				t.Errorf("no %q on the page:\n%s", want, page)
+			}
+		})
+	}
+}
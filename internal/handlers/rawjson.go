@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"main/internal/helpers"
+)
+
+// Returns the upstream response exactly as bluesky sent it, no parsing involved
+func rawPassthrough(w http.ResponseWriter, r *http.Request, apiURL, funcName string) {
+	req, reqErr := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
+	if reqErr != nil {
+		ErrorJSON(w, pageErrorf(ErrInternal, "%s: Failed to create request", funcName))
+		return
+	}
+
+	resp, respErr := helpers.CachedClient.Do(req)
+	if errors.Is(respErr, context.DeadlineExceeded) {
+		ErrorJSON(w, pageErrorf(ErrTimeout, "%s: Timeout exceeded", funcName))
+		return
+	} else if respErr != nil {
+		ErrorJSON(w, pageErrorf(ErrUpstream, "%s: Failed to do request", funcName))
+		return
+	}
+
+	defer resp.Body.Close()
+
+	// Read one byte over the limit, so we know if it was cut off. Sending a truncated body would not be faithful
+	body, bodyErr := io.ReadAll(io.LimitReader(resp.Body, helpers.MaxReadLimit+1))
+	if bodyErr != nil {
+		ErrorJSON(w, pageErrorf(ErrUpstream, "%s: Failed to read response", funcName))
+		return
+	}
+
+	if int64(len(body)) > helpers.MaxReadLimit {
+		ErrorJSON(w, pageErrorf(ErrUpstream, "%s: Response too large", funcName))
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if cacheControl := resp.Header.Get("Cache-Control"); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
+
+func (ps *HandlerPass) GetRawPost(w http.ResponseWriter, r *http.Request) {
+	profileID := r.PathValue("profileID")
+	postID := r.PathValue("postID")
+	postID = strings.ReplaceAll(postID, "|", "")
+
+	editedPID := profileID
+	if !strings.HasPrefix(editedPID, "did:plc") {
+		editedPID = helpers.ResolveHandle(r.Context(), editedPID)
+	}
+
+	if !strings.HasPrefix(editedPID, "at://") {
+		editedPID = "at://" + editedPID
+	}
+
+	apiURL := fmt.Sprintf("https://public.api.bsky.app/xrpc/app.bsky.feed.getPostThread?depth=0&uri=%s/app.bsky.feed.post/%s", editedPID, postID)
+	if helpers.IsBlueskyDead.Load() {
+		apiURL = fmt.Sprintf("https://api.bsky.app/xrpc/app.bsky.feed.getPostThread?depth=0&uri=%s/app.bsky.feed.post/%s", editedPID, postID)
+	}
+
+	rawPassthrough(w, r, apiURL, "getRawPost")
+}
+
+func (ps *HandlerPass) GetRawProfile(w http.ResponseWriter, r *http.Request) {
+	profileID := r.PathValue("profileID")
+	profileID = strings.ReplaceAll(profileID, "|", "")
+
+	editedPID := profileID
+	if !strings.HasPrefix(editedPID, "did:plc") {
+		editedPID = helpers.ResolveHandle(r.Context(), editedPID)
+	}
+
+	apiURL := "https://public.api.bsky.app/xrpc/app.bsky.actor.getProfile?actor=" + editedPID
+	if helpers.IsBlueskyDead.Load() {
+		apiURL = "https://api.bsky.app/xrpc/app.bsky.actor.getProfile?actor=" + editedPID
+	}
+
+	rawPassthrough(w, r, apiURL, "getRawProfile")
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestRawPassthrough(t *testing.T) {
+	ps := testHandlerPass()
+
+	tests := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+		// Where the upstream request has to go
+		apiPath string
+		status  int
+		// Odd spacing, key order and escapes, none of it may change
+		body []byte
+	}{
+		{
+			name:    "post",
+			path:    "/raw-json/profile/did:plc:abc/post/3kpost",
+			handler: ps.GetRawPost,
+			apiPath: "/xrpc/app.bsky.feed.getPostThread",
+			status:  http.StatusOK,
+			body:    []byte("{\"thread\":{ \"z\":1,\"a\" : \"\\u00e9\\/\",\n\"post\":{}}}"),
+		},
+		{
+			name:    "profile",
+			path:    "/raw-json/profile/did:plc:abc",
+			handler: ps.GetRawProfile,
+			apiPath: "/xrpc/app.bsky.actor.getProfile",
+			status:  http.StatusOK,
+			body:    []byte(`{"did":"did:plc:abc",   "handle":"alice.test","followersCount":1e3}`),
+		},
+		{
+			name:    "error",
+			path:    "/raw-json/profile/did:plc:abc/post/3kpost",
+			handler: ps.GetRawPost,
+			apiPath: "/xrpc/app.bsky.feed.getPostThread",
+			status:  http.StatusBadRequest,
+			body:    []byte(`{"error":"NotFound","message":"Post not found: at://did:plc:abc/app.bsky.feed.post/3kpost"}`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != test.apiPath {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(test.status)
+				w.Write(test.body)
+			})
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test"+test.path, http.NoBody)
+			req.SetPathValue("profileID", "did:plc:abc")
+			req.SetPathValue("postID", "3kpost")
+
+			recorder := httptest.NewRecorder()
+			test.handler(recorder, req)
+
+			if recorder.Code != test.status {
+				t.Errorf("got status %d, want %d", recorder.Code, test.status)
+			}
+
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+				t.Errorf("got Content-Type %q, want the upstream's", contentType)
+			}
+
+			if !bytes.Equal(recorder.Body.Bytes(), test.body) {
+				t.Errorf("got body %q, want %q", recorder.Body.Bytes(), test.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Runs every server (with the function that starts it) until SIGINT or SIGTERM.
+// Requests in flight then get drainTimeout to finish, anything still going after that is cancelled, ffmpeg included
+func ServeUntilSignal(drainTimeout time.Duration, servers map[*http.Server]func() error) {
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Every request's context comes from this, so the ones that outlive the drain can be cancelled
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	for server, listen := range servers {
+		server.BaseContext = func(net.Listener) context.Context { return requestsCtx }
+
+		go func() {
+			if listenErr := listen(); listenErr != nil && !errors.Is(listenErr, http.ErrServerClosed) {
+				panic(listenErr)
+			}
+		}()
+	}
+
+	<-signalCtx.Done()
+
+	// A second signal kills the process right away
+	stopSignals()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelShutdown()
+
+	// At the same time, so each of them gets the whole drain time
+	var shutdowns sync.WaitGroup
+	for server := range servers {
+		shutdowns.Go(func() {
+			server.Shutdown(shutdownCtx) //nolint:errcheck // Only fails when the drain time is up, which is handled below
+		})
+	}
+
+	shutdowns.Wait()
+
+	cancelRequests()
+	StopMosaics()
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//nolint:paralleltest // Signals go to the whole process
+func TestServeUntilSignalDrains(t *testing.T) {
+	// Shutting down stops the mosaic runs for good, the other tests still need them
+	t.Cleanup(func() {
+		mosaicRunsMu.Lock()
+		mosaicRunsCtx, stopMosaicRuns = context.WithCancel(context.Background())
+		mosaicRunsMu.Unlock()
+	})
+
+	tests := []struct {
+		name     string
+		drain    time.Duration
+		handling time.Duration
+		// The request finishes, instead of being cancelled when the drain time is up
+		wantFinished bool
+	}{
+		{name: "finishes in time", drain: 2 * time.Second, handling: 200 * time.Millisecond, wantFinished: true},
+		{name: "cancelled after the drain", drain: 200 * time.Millisecond, handling: 10 * time.Second, wantFinished: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+			if listenErr != nil {
+				t.Fatal(listenErr)
+			}
+
+			started := make(chan struct{})
+			finished := make(chan bool, 1)
+			server := &http.Server{
+				ReadHeaderTimeout: time.Second,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+
+					select {
+					case <-time.After(test.handling):
+						finished <- true
+						w.Write([]byte("done"))
+					case <-r.Context().Done():
+						finished <- false
+					}
+				}),
+			}
+
+			served := make(chan struct{})
+			go func() {
+				ServeUntilSignal(test.drain, map[*http.Server]func() error{
+					server: func() error { return server.Serve(listener) },
+				})
+				close(served)
+			}()
+
+			responded := make(chan string, 1)
+			go func() {
+				req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://"+listener.Addr().String(), http.NoBody)
+				req.RequestURI = ""
+
+				resp, respErr := http.DefaultClient.Do(req)
+				if respErr != nil {
+					responded <- ""
+					return
+				}
+				defer resp.Body.Close()
+
+				body, _ := io.ReadAll(resp.Body) //nolint:errcheck // An empty body fails the test anyway
+				responded <- string(body)
+			}()
+
+			<-started
+
+			if killErr := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); killErr != nil {
+				t.Fatal(killErr)
+			}
+
+			select {
+			case <-served:
+			case <-time.After(5 * time.Second):
+				t.Fatal("still serving long after the drain time")
+			}
+
+			if got := <-finished; got != test.wantFinished {
+				t.Errorf("the request finished: %t, want %t", got, test.wantFinished)
+			}
+
+			if body := <-responded; test.wantFinished && body != "done" {
+				t.Errorf("got %q, want the whole response", body)
+			}
+
+			// Nothing new is taken after the signal
+			if conn, dialErr := net.DialTimeout("tcp", listener.Addr().String(), time.Second); dialErr == nil {
+				conn.Close()
+				t.Error("still taking connections after shutting down")
+			}
+		})
+	}
+}
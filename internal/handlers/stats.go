@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"fmt"
+
+	"main/internal/helpers"
+)
+
+// Used by both the post page and its oEmbed, so they always look the same
+func (ps *HandlerPass) formatStats(replies, reposts, likes, quotes int64) string {
+	format := "💬 %s   🔁 %s   🩷 %s   📝 %s"
+
+	switch ps.StatsStyle {
+	case StatsStyleCompact:
+		format = "💬%s 🔁%s 🩷%s 📝%s"
+	case StatsStyleText:
+		format = "%s replies · %s reposts · %s likes · %s quotes"
+	}
+
+	return fmt.Sprintf(format, helpers.ToNotation(replies), helpers.ToNotation(reposts), helpers.ToNotation(likes), helpers.ToNotation(quotes))
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"path/filepath"
+
+	"main/internal/helpers"
+)
+
+// Only called before the server starts, dir is the operator's template directory (./views by default)
+func LoadTemplates(dir string) error {
+	postFuncs := template.FuncMap{
+		"escapePath": url.PathEscape,
+		"nl2br":      helpers.NL2BR,
+		"nl2brAttr":  helpers.NL2BRAttr,
+		"thumbnail":  func(imageURL string) string { return cdnVariant(imageURL, "feed_thumbnail") },
+	}
+
+	templates := []struct {
+		target **template.Template
+		name   string
+		funcs  template.FuncMap
+	}{
+		{&postTemplate, "post.html", postFuncs},
+		{&postLiteTemplate, "post-lite.html", postFuncs},
+		{&profileTemplate, "profile.html", nil},
+		{&feedTemplate, "feed.html", nil},
+		{&listTemplate, "list.html", nil},
+		{&packTemplate, "pack.html", nil},
+		{&indexTemplate, "index.html", nil},
+		{&errorTemplate, "error.html", nil},
+	}
+
+	for _, v := range templates {
+		parsed, parseErr := template.New(v.name).Funcs(v.funcs).ParseFiles(filepath.Join(dir, v.name))
+		if parseErr != nil {
+			return fmt.Errorf("failed to parse %s: %w", v.name, parseErr)
+		}
+
+		*v.target = parsed
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"main/internal/helpers"
+	"main/internal/types"
+)
+
+// Plain text version of a post (and its alt text), for accessibility tools and bots.
+// Quote and reply context is only included with ?context=1
+func (ps *HandlerPass) GetPostText(w http.ResponseWriter, r *http.Request) {
+	profileID := r.PathValue("profileID")
+	postID := r.PathValue("postID")
+	postID = strings.ReplaceAll(postID, "|", "")
+
+	apiURL := fmt.Sprintf("https://api.%s/profile/%s/post/%s", ps.DomainName, profileID, postID)
+
+	apiReq, reqErr := http.NewRequestWithContext(r.Context(), http.MethodGet, apiURL, http.NoBody)
+	if reqErr != nil {
+		ErrorPage(w, pageErrorf(ErrInternal, "getPostText: Failed to create request"))
+		return
+	}
+
+	apiResp, respErr := helpers.TimeoutClient.Do(apiReq)
+	if errors.Is(respErr, context.DeadlineExceeded) {
+		ErrorPage(w, pageErrorf(ErrTimeout, "getPostText: Timeout exceeded"))
+		return
+	} else if respErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getPostText: Failed to do request"))
+		return
+	}
+
+	defer apiResp.Body.Close()
+
+	// The API is GetPost, so its errors already went through ErrorPage, only the status is kept
+	if apiResp.StatusCode != http.StatusOK {
+		ErrorPage(w, ownStatusError("getPostText", apiResp))
+		return
+	}
+
+	var sortedAPI types.SortedAPIResponse
+	if decodeErr := json.NewDecoder(apiResp.Body).Decode(&sortedAPI); decodeErr != nil {
+		ErrorPage(w, pageErrorf(ErrUpstream, "getPostText: Failed to decode response"))
+		return
+	}
+
+	var textBuilder strings.Builder
+
+	if r.URL.Query().Get("context") == "1" {
+		thread := sortedAPI.OriginalData.Thread
+		printer := ps.localizer(w, r)
+
+		if thread.Parent != nil {
+			parentAuthor := thread.Parent.Post.Author
+			if parentAuthor.DisplayName == "" {
+				parentAuthor.DisplayName = parentAuthor.Handle
+			}
+
+			fmt.Fprintf(&textBuilder, "%s\n%s\n\n", printer.Sprintf(msgTextReplyingTo, parentAuthor.DisplayName, parentAuthor.Handle), thread.Parent.Post.Record.Text)
+		}
+
+		switch thread.Post.Embed.Type {
+		case bskyEmbedText:
+			if thread.Post.Embed.Record.Type == bskyEmbedTextQuote {
+				quoted := thread.Post.Embed.Record
+				if quoted.Author.DisplayName == "" {
+					quoted.Author.DisplayName = quoted.Author.Handle
+				}
+
+				fmt.Fprintf(&textBuilder, "%s\n%s\n\n", printer.Sprintf(msgTextQuoting, quoted.Author.DisplayName, quoted.Author.Handle), quoted.Value.Text)
+			}
+		case bskyEmbedQuote:
+			quoted := thread.Post.Embed.Record.Record
+			if quoted.Author.DisplayName == "" {
+				quoted.Author.DisplayName = quoted.Author.Handle
+			}
+
+			fmt.Fprintf(&textBuilder, "%s\n%s\n\n", printer.Sprintf(msgTextQuoting, quoted.Author.DisplayName, quoted.Author.Handle), quoted.Value.Text)
+		}
+	}
+
+	fmt.Fprintf(&textBuilder, "%s (@%s):\n%s", sortedAPI.ParsedData.Author.DisplayName, sortedAPI.ParsedData.Author.Handle, sortedAPI.ParsedData.Record.Text)
+
+	for i, v := range sortedAPI.ParsedData.Images {
+		if v.Alt != "" {
+			fmt.Fprintf(&textBuilder, "\n\n[Image %d] %s", i+1, v.Alt)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(textBuilder.String() + "\n"))
+}
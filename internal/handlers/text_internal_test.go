@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"main/internal/types"
+)
+
+//nolint:paralleltest // Stubs the upstream clients
+func TestGetPostText(t *testing.T) {
+	var post types.SortedAPIResponse
+	post.ParsedData.Author = types.APIAuthor{DisplayName: "Alice", Handle: "alice.test"}
+	post.ParsedData.Record.Text = "Hello\nworld"
+	post.ParsedData.Images = types.APIImages{{Alt: "A cat"}, {Alt: ""}, {Alt: "A dog"}}
+
+	stubUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "api.example.test" {
+			t.Errorf("asked %s, not our own API", r.Host)
+		}
+
+		switch r.URL.Path {
+		case "/profile/alice.test/post/ok":
+			json.NewEncoder(w).Encode(post)
+		case "/profile/alice.test/post/deleted":
+			ErrorPage(w, pageErrorf(ErrNotFound, "getPost: This post was not found"))
+		case "/profile/alice.test/post/bsky-notfound":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"NotFound","message":"Post not found"}`))
+		case "/profile/alice.test/post/locked":
+			ErrorPage(w, pageErrorf(ErrUnavailable, "getPost: This post requires logging in to view"))
+		case "/profile/alice.test/post/slow":
+			ErrorPage(w, pageErrorf(ErrTimeout, "getPost: Timeout exceeded"))
+		case "/profile/alice.test/post/broken":
+			w.Write([]byte("not json"))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	ps := &HandlerPass{DomainName: "example.test"}
+
+	tests := []struct {
+		name       string
+		postID     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"post", "ok", http.StatusOK, "Alice (@alice.test):\nHello\nworld\n\n[Image 1] A cat\n\n[Image 3] A dog\n"},
+		{"deleted post", "deleted", http.StatusNotFound, errorCodes[ErrNotFound].message},
+		{"Bluesky's NotFound", "bsky-notfound", http.StatusNotFound, errorCodes[ErrNotFound].message},
+		{"logged in only", "locked", http.StatusForbidden, errorCodes[ErrUnavailable].message},
+		{"timeout", "slow", http.StatusGatewayTimeout, "taking too long"},
+		{"API failing", "failing", http.StatusBadGateway, errorCodes[ErrUpstream].message},
+		{"not JSON", "broken", http.StatusBadGateway, "Failed to decode response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/text/profile/alice.test/post/"+tt.postID, http.NoBody)
+			req.SetPathValue("profileID", "alice.test")
+			req.SetPathValue("postID", tt.postID)
+
+			recorder := httptest.NewRecorder()
+			ps.GetPostText(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				if recorder.Body.String() != tt.wantBody {
+					t.Errorf("body = %q, want %q", recorder.Body.String(), tt.wantBody)
+				}
+
+				if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+					t.Errorf("Content-Type = %q", contentType)
+				}
+			} else if !strings.Contains(recorder.Body.String(), html.EscapeString(tt.wantBody)) {
+				t.Errorf("body doesn't mention %q:\n%s", tt.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
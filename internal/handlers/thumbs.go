@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Lots of people share the same links, so let CDNs cache the thumbnails of external cards.
+// The ETag is made from the thumbnail URL (not the content), so nothing has to be downloaded.
+// Returns true if a 304 was sent, and nothing else should be written.
+func thumbNotModified(w http.ResponseWriter, r *http.Request, thumbURL string) bool {
+	urlHash := sha256.Sum256([]byte(thumbURL))
+	hexHash := hex.EncodeToString(urlHash[:])
+	eTag := `"` + hexHash + `"`
+
+	w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=86400")
+	w.Header().Set("ETag", eTag)
+	// External thumbnails are semi-stable, pretend they changed a little while ago
+	w.Header().Set("Last-Modified", time.Now().Add(-30*time.Minute).UTC().Format(http.TimeFormat))
+	// For Fastly/Varnish purging
+	w.Header().Set("Surrogate-Key", "thumb-"+hexHash)
+
+	if r.Header.Get("If-None-Match") == eTag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
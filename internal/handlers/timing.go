@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Collects Server-Timing metrics, does nothing unless it's enabled
+type serverTiming struct {
+	enabled bool
+	metrics []string
+}
+
+func (ps *HandlerPass) newServerTiming() *serverTiming {
+	return &serverTiming{enabled: ps.EnableServerTiming}
+}
+
+func (st *serverTiming) track(name, desc string, start time.Time) {
+	if st == nil || !st.enabled {
+		return
+	}
+
+	st.metrics = append(st.metrics, fmt.Sprintf("%s;desc=%q;dur=%.1f", name, desc, float64(time.Since(start).Microseconds())/1000))
+}
+
+// Has to be called before anything is written to w
+func (st *serverTiming) write(w http.ResponseWriter) {
+	if st == nil || !st.enabled || len(st.metrics) == 0 {
+		return
+	}
+
+	w.Header().Set("Server-Timing", strings.Join(st.metrics, ", "))
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"main/internal/types"
+)
+
+// Set at build time, see the Dockerfile (-ldflags "-X main/internal/handlers.BuildVersion=...")
+var (
+	BuildVersion = "dev"
+	BuildCommit  = ""
+)
+
+func GetVersion(w http.ResponseWriter, _ *http.Request) {
+	info := types.BuildInfo{
+		Version:   BuildVersion,
+		Commit:    BuildCommit,
+		GoVersion: runtime.Version(),
+	}
+
+	// Builds from a git checkout know their own commit, even without ldflags
+	if info.Commit == "" {
+		if buildInfo, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range buildInfo.Settings {
+				if setting.Key == "vcs.revision" {
+					info.Commit = setting.Value
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if encodeErr := json.NewEncoder(w).Encode(&info); encodeErr != nil {
+		ErrorJSON(w, pageErrorf(ErrInternal, "getVersion: Failed to encode JSON"))
+		return
+	}
+}
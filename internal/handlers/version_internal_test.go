@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"testing"
+
+	"main/internal/types"
+)
+
+//nolint:paralleltest // Sets the build variables
+func TestGetVersion(t *testing.T) {
+	oldVersion, oldCommit := BuildVersion, BuildCommit
+	t.Cleanup(func() {
+		BuildVersion, BuildCommit = oldVersion, oldCommit
+	})
+
+	tests := []struct {
+		name    string
+		version string
+		commit  string
+		want    types.BuildInfo
+	}{
+		{
+			name:    "ldflags",
+			version: "v1.2.3",
+			commit:  "0123456789abcdef",
+			want:    types.BuildInfo{Version: "v1.2.3", Commit: "0123456789abcdef", GoVersion: runtime.Version()},
+		},
+		// Test binaries aren't stamped with a commit, so it stays empty
+		{
+			name:    "dev",
+			version: "dev",
+			want:    types.BuildInfo{Version: "dev", GoVersion: runtime.Version()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			BuildVersion, BuildCommit = tt.version, tt.commit
+
+			recorder := httptest.NewRecorder()
+			GetVersion(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "https://example.test/version", http.NoBody))
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+
+			if got := recorder.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+
+			// Exactly these fields, scripts depend on the names
+			var fields map[string]string
+			if decodeErr := json.Unmarshal(recorder.Body.Bytes(), &fields); decodeErr != nil {
+				t.Fatal(decodeErr)
+			}
+
+			if keys := slices.Sorted(maps.Keys(fields)); !slices.Equal(keys, []string{"commit", "goVersion", "version"}) {
+				t.Errorf("fields = %q, want commit, goVersion and version", keys)
+			}
+
+			var info types.BuildInfo
+			if decodeErr := json.Unmarshal(recorder.Body.Bytes(), &info); decodeErr != nil {
+				t.Fatal(decodeErr)
+			}
+
+			if info != tt.want {
+				t.Errorf("got %+v, want %+v", info, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package helpers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	apiCacheEntry struct {
+		status    int
+		header    http.Header
+		body      []byte
+		expiresAt time.Time
+	}
+
+	// Keeps successful API responses by URL, so a popular post isn't fetched hundreds of times a minute
+	apiCache struct {
+		mu      sync.Mutex
+		entries map[string]apiCacheEntry
+		bytes   int
+
+		hits,
+		misses atomic.Int64
+	}
+
+	cachingTransport struct {
+		next  http.RoundTripper
+		cache *apiCache
+	}
+
+	APICacheStats struct {
+		Hits    int64 `json:"hits"`
+		Misses  int64 `json:"misses"`
+		Entries int   `json:"entries"`
+	}
+)
+
+const (
+	maxAPICacheEntries = 5000
+	maxAPICacheBytes   = 128 * 1024 * 1024
+)
+
+var (
+	// How long responses of each XRPC method (app.bsky.actor.getProfile, ...) are kept, the rest aren't cached.
+	// Only written to before the server starts
+	APICacheTTLs = make(map[string]time.Duration)
+
+	upstreamAPICache = &apiCache{entries: make(map[string]apiCacheEntry)}
+
+	// For the main request of each page (the post, the profile, ...), everything else uses TimeoutClient
+	CachedClient = &http.Client{
+		Timeout:   TimeoutClient.Timeout,
+		Transport: cachingTransport{next: TimeoutClient.Transport, cache: upstreamAPICache},
+	}
+)
+
+func GetAPICacheStats() APICacheStats {
+	upstreamAPICache.mu.Lock()
+	entries := len(upstreamAPICache.entries)
+	upstreamAPICache.mu.Unlock()
+
+	return APICacheStats{Hits: upstreamAPICache.hits.Load(), Misses: upstreamAPICache.misses.Load(), Entries: entries}
+}
+
+// https://public.api.bsky.app/xrpc/app.bsky.actor.getProfile?... -> app.bsky.actor.getProfile
+func apiCacheTTL(req *http.Request) time.Duration {
+	method, found := strings.CutPrefix(req.URL.Path, "/xrpc/")
+	if req.Method != http.MethodGet || !found {
+		return 0
+	}
+
+	return APICacheTTLs[method]
+}
+
+func (ct cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A cancelled request shouldn't get an answer, cached or not
+	if ctxErr := req.Context().Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	ttl := apiCacheTTL(req)
+	if ttl <= 0 {
+		return ct.next.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	if entry, ok := ct.cache.get(key); ok {
+		ct.cache.hits.Add(1)
+		Debugf(req.Context(), "upstream %s %s -> cached %d", req.Method, req.URL.Redacted(), entry.status)
+
+		return &http.Response{
+			Status:        strconv.Itoa(entry.status) + " " + http.StatusText(entry.status),
+			StatusCode:    entry.status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        entry.header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(entry.body)),
+			ContentLength: int64(len(entry.body)),
+			Request:       req,
+		}, nil
+	}
+
+	ct.cache.misses.Add(1)
+
+	resp, err := ct.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	// Read one byte over the limit, anything that big is passed on as it is instead of being kept
+	body, readErr := io.ReadAll(io.LimitReader(resp.Body, MaxReadLimit+1))
+	if readErr != nil {
+		resp.Body.Close()
+		return nil, readErr
+	}
+
+	if int64(len(body)) > MaxReadLimit {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	ct.cache.put(key, apiCacheEntry{status: resp.StatusCode, header: resp.Header.Clone(), body: body, expiresAt: time.Now().Add(ttl)})
+
+	return resp, nil
+}
+
+// Expired entries are never returned, they're dropped on sight
+func (ac *apiCache) get(key string) (apiCacheEntry, bool) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	entry, ok := ac.entries[key]
+	if !ok {
+		return apiCacheEntry{}, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		ac.bytes -= len(entry.body)
+		delete(ac.entries, key)
+
+		return apiCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (ac *apiCache) put(key string, entry apiCacheEntry) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if old, ok := ac.entries[key]; ok {
+		ac.bytes -= len(old.body)
+		delete(ac.entries, key)
+	}
+
+	// Same as the page cache, drop the expired ones first, and everything if that wasn't enough
+	if len(ac.entries) >= maxAPICacheEntries || ac.bytes+len(entry.body) > maxAPICacheBytes {
+		now := time.Now()
+		for k, v := range ac.entries {
+			if now.After(v.expiresAt) {
+				ac.bytes -= len(v.body)
+				delete(ac.entries, k)
+			}
+		}
+
+		if len(ac.entries) >= maxAPICacheEntries || ac.bytes+len(entry.body) > maxAPICacheBytes {
+			clear(ac.entries)
+			ac.bytes = 0
+		}
+	}
+
+	ac.entries[key] = entry
+	ac.bytes += len(entry.body)
+}
@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+type (
+	debugKey struct{}
+
+	// Logs every upstream request of a debugged request, see Debugf
+	debugTransport struct {
+		next http.RoundTripper
+	}
+)
+
+// Logs for every request, not just the ones asking for it. Only written to before the server starts
+var DebugAll bool
+
+// Marks a request as being debugged, everything it sends upstream gets logged
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+func IsDebug(ctx context.Context) bool {
+	return DebugAll || IsDebugRequest(ctx)
+}
+
+// Only the requests that asked for it (?debug=1 with the token), DebugAll doesn't count
+func IsDebugRequest(ctx context.Context) bool {
+	return ctx.Value(debugKey{}) != nil
+}
+
+func Debugf(ctx context.Context, format string, args ...any) {
+	if IsDebug(ctx) {
+		log.Printf("debug: "+format, args...)
+	}
+}
+
+// How decoding the upstream response went, which is usually where a post that won't render breaks
+func DebugDecode(ctx context.Context, funcName string, decodeErr error) {
+	if decodeErr != nil {
+		Debugf(ctx, "%s: decode failed: %v", funcName, decodeErr)
+		return
+	}
+
+	Debugf(ctx, "%s: decoded", funcName)
+}
+
+// Only the method, URL (minus any password in it), status and time taken, never headers or bodies
+func (dt debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := dt.next.RoundTrip(req)
+
+	if err != nil {
+		Debugf(req.Context(), "upstream %s %s failed after %s: %v", req.Method, req.URL.Redacted(), time.Since(start).Round(time.Millisecond), err)
+	} else {
+		Debugf(req.Context(), "upstream %s %s -> %s in %s", req.Method, req.URL.Redacted(), resp.Status, time.Since(start).Round(time.Millisecond))
+	}
+
+	return resp, err
+}
@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type (
+	// The transport only undoes gzip it asked for itself, this covers responses that are gzipped anyway
+	// (a proxy, or a request that set its own Accept-Encoding)
+	gzipTransport struct {
+		next http.RoundTripper
+	}
+
+	gzipBody struct {
+		*gzip.Reader
+
+		body io.ReadCloser
+	}
+)
+
+func (gt gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := gt.next.RoundTrip(req)
+	if err != nil || resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") || req.Method == http.MethodHead {
+		return resp, err
+	}
+
+	reader, gzipErr := gzip.NewReader(resp.Body)
+	if gzipErr != nil {
+		resp.Body.Close()
+		return nil, gzipErr
+	}
+
+	resp.Body = gzipBody{Reader: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return resp, nil
+}
+
+func (gb gzipBody) Close() error {
+	gb.Reader.Close()
+	return gb.body.Close()
+}
@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Answers every request with the same status, encoding and body
+type fixedTransport struct {
+	status   int
+	encoding string
+	body     []byte
+}
+
+func (ft fixedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := make(http.Header)
+	if ft.encoding != "" {
+		header.Set("Content-Encoding", ft.encoding)
+	}
+
+	return &http.Response{
+		StatusCode:    ft.status,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(ft.body)),
+		ContentLength: int64(len(ft.body)),
+		Request:       req,
+	}, nil
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, writeErr := writer.Write([]byte(data)); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+
+	if closeErr := writer.Close(); closeErr != nil {
+		t.Fatal(closeErr)
+	}
+
+	return buf.Bytes()
+}
+
+func TestGzipTransport(t *testing.T) {
+	t.Parallel()
+
+	const payload = `{"did":"did:plc:abc"}`
+
+	tests := []struct {
+		name      string
+		method    string
+		transport fixedTransport
+		want      []byte
+		// Content-Encoding left on the response
+		wantEncoding string
+		wantErr      bool
+	}{
+		{
+			name:      "gzipped",
+			method:    http.MethodGet,
+			transport: fixedTransport{status: http.StatusOK, encoding: "gzip", body: gzipped(t, payload)},
+			want:      []byte(payload),
+		},
+		{
+			name:      "any case",
+			method:    http.MethodGet,
+			transport: fixedTransport{status: http.StatusOK, encoding: "GZip", body: gzipped(t, payload)},
+			want:      []byte(payload),
+		},
+		{
+			name:      "plain",
+			method:    http.MethodGet,
+			transport: fixedTransport{status: http.StatusOK, body: []byte(payload)},
+			want:      []byte(payload),
+		},
+		{
+			name:         "head",
+			method:       http.MethodHead,
+			transport:    fixedTransport{status: http.StatusOK, encoding: "gzip"},
+			want:         []byte{},
+			wantEncoding: "gzip",
+		},
+		{
+			name:      "not actually gzipped",
+			method:    http.MethodGet,
+			transport: fixedTransport{status: http.StatusOK, encoding: "gzip", body: []byte(payload)},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequestWithContext(t.Context(), tt.method, "https://public.api.bsky.app/xrpc/app.bsky.actor.getProfile", http.NoBody)
+
+			resp, respErr := gzipTransport{next: tt.transport}.RoundTrip(req)
+			if tt.wantErr {
+				if respErr == nil {
+					resp.Body.Close()
+					t.Error("got no error, want one")
+				}
+
+				return
+			}
+
+			if respErr != nil {
+				t.Fatal(respErr)
+			}
+			defer resp.Body.Close()
+
+			body, readErr := io.ReadAll(resp.Body)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+
+			if !bytes.Equal(body, tt.want) {
+				t.Errorf("got body %q, want %q", body, tt.want)
+			}
+
+			if encoding := resp.Header.Get("Content-Encoding"); encoding != tt.wantEncoding {
+				t.Errorf("got Content-Encoding %q, want %q", encoding, tt.wantEncoding)
+			}
+		})
+	}
+}
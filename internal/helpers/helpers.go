@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html/template"
 	"net"
 	"net/http"
 	"os"
@@ -14,25 +15,83 @@ import (
 	"time"
 )
 
+// Numbers that round up into the next unit (999,950 would be 1000.0K) are shown in that one
 func ToNotation(number int64) string {
 	switch {
-	case number >= 1e9:
-		return strconv.FormatFloat(float64(number)/1e9, 'f', 1, 64) + "B"
-	case number >= 1e6:
-		return strconv.FormatFloat(float64(number)/1e6, 'f', 1, 64) + "M"
+	case number >= 1e9-1e6/20:
+		return scaledNotation(number, 1e9) + "B"
+	case number >= 1e6-1e3/20:
+		return scaledNotation(number, 1e6) + "M"
 	case number >= 1e3:
-		return strconv.FormatFloat(float64(number)/1e3, 'f', 1, 64) + "K"
+		return scaledNotation(number, 1e3) + "K"
 	default:
 		return strconv.FormatInt(number, 10)
 	}
 }
 
-func NL2BR(in string) string {
-	// This is escaped, but it somehow works.
-	// I don't know, and I don't wanna know.
+// number/divisor to one decimal (rounded), in integers so nothing above 2^53 is off like it would be as a float64
+func scaledNotation(number, divisor int64) string {
+	whole, remainder := number/divisor, number%divisor
+
+	// remainder*10 could overflow for the biggest numbers, so the divisor is scaled down instead
+	tenths := (remainder + divisor/20) / (divisor / 10)
+	if tenths == 10 {
+		whole++
+		tenths = 0
+	}
+
+	return strconv.FormatInt(whole, 10) + "." + strconv.FormatInt(tenths, 10)
+}
+
+// Cuts on runes, not bytes, so a character is never split in half
+func TruncateRunes(in string, maxRunes int) string {
+	runes := []rune(in)
+	if len(runes) <= maxRunes {
+		return in
+	}
+
+	return string(runes[:maxRunes]) + "..."
+}
+
+// For element content, the input is escaped first so only our <br>s are actual HTML
+func NL2BR(in string) template.HTML {
+	//nolint:gosec // Escaped right here
+	return template.HTML(strings.ReplaceAll(template.HTMLEscapeString(in), "\n", "<br>"))
+}
+
+// For attributes, where the template escapes this (<br> and all) like any other string.
+// NL2BR can't be used there, the template strips tags out of HTML in attributes.
+func NL2BRAttr(in string) string {
 	return strings.ReplaceAll(in, "\n", "<br>")
 }
 
+// Builds the base URL (scheme://host) that the client used to reach us, for absolute URLs in the templates.
+// The forwarded headers are only honored if trustForwarded is set, since anyone can send them.
+func BaseURL(r *http.Request, trustForwarded bool) string {
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+
+	host := r.Host
+
+	if trustForwarded {
+		// Only take the first value, in case there's a chain of proxies
+		if fwdProto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); fwdProto != "" {
+			fwdProto = strings.ToLower(strings.TrimSpace(fwdProto))
+			if fwdProto == "http" || fwdProto == "https" {
+				scheme = fwdProto
+			}
+		}
+
+		if fwdHost, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); fwdHost != "" {
+			host = strings.TrimSpace(fwdHost)
+		}
+	}
+
+	return scheme + "://" + host
+}
+
 // Check if bluesky is having issues (https://public.api.bsky.app/xrpc/_health)
 // If this returns a non 200, it is most likely down (probably due to their ai slop usage)
 // In that case, rewrite it to use the "private" api, which is the same, just w/o caching
@@ -65,22 +124,34 @@ func BlueskyHealthCheck() {
 }
 
 // https://www.agwa.name/blog/post/preventing_server_side_request_forgery_in_golang
-func SDial(network, addr string, conn syscall.RawConn) error {
+func SDial(ctx context.Context, network, addr string, conn syscall.RawConn) error {
 	if network != "tcp4" && network != "tcp6" {
 		return errors.New("bad network type")
 	}
 
+	// The operator's proxy, which is allowed to be local (and on any port)
+	if trustedProxyAddrs[addr] {
+		return nil
+	}
+
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		return errors.New("bad address")
 	}
 
-	if port != "80" && port != "443" {
+	return checkDestination(ctx, host, port)
+}
+
+// Where an upstream request may go: the usual ports, on public addresses only.
+// A did:web can name its own port (did:web:example.com%3A3000), fetching its document is the one request allowed on it
+func checkDestination(ctx context.Context, host, port string) error {
+	didWebPort, _ := ctx.Value(didWebPortKey{}).(string)
+	if port != "80" && port != "443" && port != didWebPort {
 		return errors.New("bad port")
 	}
 
 	// https://stackoverflow.com/a/50825191 && https://stackoverflow.com/a/67526079
-	ips, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
 	if err != nil {
 		return errors.New("failed host lookup")
 	}
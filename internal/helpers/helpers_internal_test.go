@@ -0,0 +1,114 @@
+package helpers
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNL2BR(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want template.HTML
+	}{
+		{"plain", "hello", "hello"},
+		{"line breaks", "one\ntwo\n\nthree", "one<br>two<br><br>three"},
+		{"script", "<script>alert(1)</script>\nhi", "&lt;script&gt;alert(1)&lt;/script&gt;<br>hi"},
+		{"br in the text", "a<br>b", "a&lt;br&gt;b"},
+		{"quotes and ampersands", `"a" & 'b'`, "&#34;a&#34; &amp; &#39;b&#39;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := NL2BR(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToNotation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		number int64
+		want   string
+	}{
+		{"zero", 0, "0"},
+		{"under a thousand", 999, "999"},
+		{"a thousand", 1000, "1.0K"},
+		{"rounded down", 1249, "1.2K"},
+		{"rounded up", 1250, "1.3K"},
+		{"just under the next unit", 999_949, "999.9K"},
+		{"rounds into the next unit", 999_950, "1.0M"},
+		{"a million", 1_000_000, "1.0M"},
+		{"rounds into billions", 999_950_000, "1.0B"},
+		{"a billion", 1_000_000_000, "1.0B"},
+		{"2^53", 1 << 53, "9007199.3B"},
+		{"2^53+1", 1<<53 + 1, "9007199.3B"},
+		// As a float64 this one is ...350_000_000, which would round up
+		{"above 2^53, just under rounding up", 9_007_199_349_999_999, "9007199.3B"},
+		{"above 2^53, rounded up", 9_007_199_350_000_000, "9007199.4B"},
+		{"largest int64", math.MaxInt64, "9223372036.9B"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ToNotation(tt.number); got != tt.want {
+				t.Errorf("ToNotation(%d) = %q, want %q", tt.number, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		target  string
+		proto   string
+		host    string
+		trusted bool
+		want    string
+	}{
+		{name: "direct", target: "http://xbsky.test/", want: "http://xbsky.test"},
+		{name: "direct TLS", target: "https://xbsky.test/", want: "https://xbsky.test"},
+		{name: "forwarded, not trusted", target: "http://xbsky.test/", proto: "https", host: "evil.test", want: "http://xbsky.test"},
+		{name: "forwarded", target: "http://10.0.0.2:8080/", proto: "https", host: "xbsky.test", trusted: true, want: "https://xbsky.test"},
+		{name: "only the scheme", target: "http://xbsky.test/", proto: "HTTPS", trusted: true, want: "https://xbsky.test"},
+		{name: "only the host", target: "https://10.0.0.2/", host: "xbsky.test", trusted: true, want: "https://xbsky.test"},
+		{name: "chain of proxies", target: "http://10.0.0.2/", proto: "https, http", host: "xbsky.test, 10.0.0.1", trusted: true, want: "https://xbsky.test"},
+		{name: "not a web scheme", target: "http://xbsky.test/", proto: "javascript", trusted: true, want: "http://xbsky.test"},
+		{name: "nothing forwarded", target: "http://xbsky.test/", trusted: true, want: "http://xbsky.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, http.NoBody)
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			if tt.host != "" {
+				req.Header.Set("X-Forwarded-Host", tt.host)
+			}
+
+			if got := BaseURL(req, tt.trusted); got != tt.want {
+				t.Errorf("BaseURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
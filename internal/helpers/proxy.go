@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Only written to before the server starts, so no locking
+var trustedProxyAddrs = make(map[string]bool)
+
+// Upstream requests go through proxyURL (UPSTREAM_PROXY) if it's set, otherwise through HTTP_PROXY/HTTPS_PROXY (minus NO_PROXY) as usual.
+// Proxies tend to be on the local network, so their addresses get past SDial, and guardedProxy checks where the request is going instead
+func ConfigureUpstreamProxy(proxyURL string) error {
+	// Named, so a bad one can be pointed out
+	proxies := []struct{ name, proxy string }{
+		{"HTTP_PROXY", os.Getenv("HTTP_PROXY")},
+		{"http_proxy", os.Getenv("http_proxy")},
+		{"HTTPS_PROXY", os.Getenv("HTTPS_PROXY")},
+		{"https_proxy", os.Getenv("https_proxy")},
+	}
+
+	if proxyURL != "" {
+		parsedURL, parseErr := url.Parse(proxyURL)
+		if parseErr != nil || parsedURL.Host == "" {
+			return errors.New("UPSTREAM_PROXY environment variable should be a proxy URL (http://host:port)")
+		}
+
+		UpstreamTransport.Proxy = guardedProxy(http.ProxyURL(parsedURL))
+		proxies = []struct{ name, proxy string }{{"UPSTREAM_PROXY", proxyURL}}
+	}
+
+	for _, proxy := range proxies {
+		if proxy.proxy == "" {
+			continue
+		}
+
+		if trustErr := trustProxy(proxy.proxy); trustErr != nil {
+			return fmt.Errorf("%s environment variable: %w", proxy.name, trustErr)
+		}
+	}
+
+	return nil
+}
+
+func trustProxy(proxy string) error {
+	// Same as ProxyFromEnvironment, no scheme means http
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	parsedURL, parseErr := url.Parse(proxy)
+	if parseErr != nil {
+		return fmt.Errorf("invalid proxy URL: %w", parseErr)
+	}
+
+	if parsedURL.Hostname() == "" {
+		return errors.New("invalid proxy URL: no host")
+	}
+
+	port := parsedURL.Port()
+	if port == "" {
+		switch parsedURL.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+
+	ips, lookupErr := net.DefaultResolver.LookupIPAddr(context.Background(), parsedURL.Hostname())
+	if lookupErr != nil {
+		return fmt.Errorf("failed proxy lookup: %w", lookupErr)
+	}
+
+	for _, v := range ips {
+		trustedProxyAddrs[net.JoinHostPort(v.IP.String(), port)] = true
+	}
+
+	return nil
+}
+
+// SDial only sees the proxy when there is one, so once a proxy is trusted every destination is checked here, before it's handed over.
+// That covers requests NO_PROXY sends around the proxy too, SDial would let them through if they went to the proxy's address
+func guardedProxy(next func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if len(trustedProxyAddrs) == 0 {
+			return next(req)
+		}
+
+		port := req.URL.Port()
+		if port == "" {
+			port = "443"
+			if req.URL.Scheme == "http" {
+				port = "80"
+			}
+		}
+
+		if destErr := checkDestination(req.Context(), req.URL.Hostname(), port); destErr != nil {
+			return nil, destErr
+		}
+
+		return next(req)
+	}
+}
@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+//nolint:paralleltest // Sets the proxy environment variables and trusts proxies globally
+func TestConfigureUpstreamProxyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		proxyURL string
+		want     []string
+	}{
+		{"bad UPSTREAM_PROXY", nil, "not a url", []string{"UPSTREAM_PROXY"}},
+		{"bad HTTP_PROXY", map[string]string{"HTTP_PROXY": "http://%zz"}, "", []string{"HTTP_PROXY", "invalid proxy URL"}},
+		{"HTTPS_PROXY that doesn't resolve", map[string]string{"HTTPS_PROXY": "http://proxy.invalid:3128"}, "", []string{"HTTPS_PROXY", "failed proxy lookup"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			t.Cleanup(func() { clear(trustedProxyAddrs) })
+
+			err := ConfigureUpstreamProxy(tt.proxyURL)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // The trusted proxies are global
+func TestGuardedProxy(t *testing.T) {
+	proxyURL := &url.URL{Scheme: "http", Host: "127.0.0.1:3128"}
+	proxy := guardedProxy(http.ProxyURL(proxyURL))
+
+	tests := []struct {
+		name    string
+		target  string
+		trusted bool
+		wantErr bool
+	}{
+		{"no proxy trusted, nothing to check", "http://127.0.0.1:8080/", false, false},
+		{"public host", "https://8.8.8.8/xrpc/_health", true, false},
+		{"public host over http", "http://8.8.8.8/", true, false},
+		{"the proxy itself", "http://127.0.0.1:3128/", true, true},
+		{"loopback", "https://127.0.0.1/", true, true},
+		{"private network", "https://10.0.0.1/", true, true},
+		{"link-local metadata", "http://169.254.169.254/latest/meta-data", true, true},
+		{"public host on another port", "https://8.8.8.8:8443/", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.trusted {
+				trustedProxyAddrs["127.0.0.1:3128"] = true
+				t.Cleanup(func() { clear(trustedProxyAddrs) })
+			}
+
+			req, reqErr := http.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, http.NoBody)
+			if reqErr != nil {
+				t.Fatal(reqErr)
+			}
+
+			got, err := proxy(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+
+			if err == nil && got.String() != proxyURL.String() {
+				t.Errorf("proxy = %s, want %s", got, proxyURL)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // The trusted proxies are global
+func TestSDialTrustsOnlyTheProxy(t *testing.T) {
+	trustedProxyAddrs["127.0.0.1:3128"] = true
+	t.Cleanup(func() { clear(trustedProxyAddrs) })
+
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"127.0.0.1:3128", false},
+		{"127.0.0.1:80", true},
+		{"127.0.0.1:3129", true},
+		{"8.8.8.8:443", false},
+	}
+
+	for _, tt := range tests {
+		if err := SDial(t.Context(), "tcp4", tt.addr, nil); (err != nil) != tt.wantErr {
+			t.Errorf("SDial(%s) = %v, want error: %v", tt.addr, err, tt.wantErr)
+		}
+	}
+}
@@ -3,45 +3,92 @@ package helpers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"main/internal/types"
+
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/text/unicode/norm"
 )
 
+// The port a did:web document is on, when the DID names one, see checkDestination
+type didWebPortKey struct{}
+
 const (
-	MaxReadLimit = 10 * (1024 * 1024)
+	// Handles that failed every strategy are remembered for a little while, so they don't hit the network every time
+	NegativeHandleTTL  = 30 * time.Second
+	MaxNegativeHandles = 10000
 )
 
 var (
 	IsBlueskyDead atomic.Bool
 
+	// Largest response read from upstream, see ConfigureUpstreamLimits
+	MaxReadLimit int64 = 10 * (1024 * 1024)
+
+	negativeHandlesMu sync.Mutex
+	negativeHandles   = make(map[string]time.Time)
+
+	errHandleNotFound = errors.New("handle not found")
+
 	SDialer = &net.Dialer{
-		Timeout:   10 * time.Second,
-		KeepAlive: 30 * time.Second,
-		Control:   SDial,
+		Timeout:        10 * time.Second,
+		KeepAlive:      30 * time.Second,
+		ControlContext: SDial,
+	}
+
+	// Shared by every upstream request, see ConfigureUpstreamProxy
+	// Compression has to stay on (DisableCompression unset), the JSON decoders expect plain bodies
+	UpstreamTransport = &http.Transport{
+		Proxy:                 guardedProxy(http.ProxyFromEnvironment),
+		DialContext:           SDialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       time.Minute,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	// Bluesky's API and the PLC directory, what every page asks for
+	sharedHosts = map[string]bool{
+		"public.api.bsky.app": true,
+		"api.bsky.app":        true,
+		"plc.directory":       true,
 	}
 
 	TimeoutClient = &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			DialContext:           SDialer.DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       time.Minute,
-			TLSHandshakeTimeout:   5 * time.Second,
-			ExpectContinueTimeout: time.Second,
-		},
+		Timeout:   10 * time.Second,
+		Transport: debugTransport{next: sharedTransport{next: gzipTransport{next: UpstreamTransport}, group: &singleflight.Group{}, hosts: sharedHosts}},
 	}
 )
 
+// Only called before the server starts, every upstream client gets the same timeout
+func ConfigureUpstreamLimits(timeout time.Duration, maxReadLimit int64) {
+	TimeoutClient.Timeout = timeout
+	CachedClient.Timeout = timeout
+	MaxReadLimit = maxReadLimit
+}
+
 func ResolveHandleAPI(ctx context.Context, handle string) (string, bool) {
+	did, resolveErr := resolveHandleAPI(ctx, handle)
+	if resolveErr != nil {
+		return handle, false
+	}
+
+	return did, true
+}
+
+// errHandleNotFound means the handle doesn't exist, any other error only that it couldn't be checked this time
+func resolveHandleAPI(ctx context.Context, handle string) (string, error) {
 	apiURL := "https://public.api.bsky.app/xrpc/com.atproto.identity.resolveHandle?handle=" + handle
 	if IsBlueskyDead.Load() {
 		apiURL = "https://api.bsky.app/xrpc/com.atproto.identity.resolveHandle?handle=" + handle
@@ -49,30 +96,35 @@ func ResolveHandleAPI(ctx context.Context, handle string) (string, bool) {
 
 	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, http.NoBody)
 	if reqErr != nil {
-		return handle, false
+		return "", reqErr
 	}
 
 	resp, respErr := TimeoutClient.Do(req)
 	if respErr != nil {
-		return handle, false
+		return "", respErr
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return handle, false
+	switch resp.StatusCode {
+	case http.StatusOK:
+	// "Unable to resolve handle"
+	case http.StatusBadRequest:
+		return "", errHandleNotFound
+	default:
+		return "", fmt.Errorf("unexpected status (%s)", resp.Status)
 	}
 
 	var uDID types.APIDID
 	if decodeErr := json.NewDecoder(resp.Body).Decode(&uDID); decodeErr != nil {
-		return handle, false
+		return "", decodeErr
 	}
 
 	if !strings.HasPrefix(uDID.DID, "did:") {
-		return handle, false
+		return "", errHandleNotFound
 	}
 
-	return uDID.DID, true
+	return uDID.DID, nil
 }
 
 func ResolveHandleDNS(ctx context.Context, handle string) (string, bool) {
@@ -91,43 +143,71 @@ func ResolveHandleDNS(ctx context.Context, handle string) (string, bool) {
 }
 
 func ResolveHandleHTTP(ctx context.Context, handle string) (string, bool) {
+	did, resolveErr := resolveHandleHTTP(ctx, handle)
+	if resolveErr != nil {
+		return handle, false
+	}
+
+	return did, true
+}
+
+// Like resolveHandleAPI, errHandleNotFound only if the host doesn't exist or has no DID for us
+func resolveHandleHTTP(ctx context.Context, handle string) (string, error) {
 	atURL := fmt.Sprintf("https://%s/.well-known/atproto-did", handle)
 
 	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, atURL, http.NoBody)
 	if reqErr != nil {
-		return handle, false
+		return "", reqErr
 	}
 
 	resp, respErr := TimeoutClient.Do(req)
 	if respErr != nil {
-		return handle, false
+		// The handle's host doesn't exist at all
+		var dnsErr *net.DNSError
+		if errors.As(respErr, &dnsErr) && dnsErr.IsNotFound {
+			return "", errHandleNotFound
+		}
+
+		return "", respErr
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return handle, false
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return "", errHandleNotFound
+	default:
+		return "", fmt.Errorf("unexpected status (%s)", resp.Status)
 	}
 
 	// https://github.com/did-method-plc/did-method-plc?tab=readme-ov-file#identifier-syntax
 	body, bodyErr := io.ReadAll(io.LimitReader(resp.Body, 32))
 	if bodyErr != nil {
-		return handle, false
+		return "", bodyErr
 	}
 
 	responseBody := string(body)
 
 	if !strings.HasPrefix(responseBody, "did:") {
-		return handle, false
+		return "", errHandleNotFound
 	}
 
-	return responseBody, true
+	return responseBody, nil
 }
 
 // https://atproto.com/specs/handle#handle-resolution
 func ResolveHandle(ctx context.Context, handle string) string {
+	handle = NormalizeHandle(handle)
+
+	// Failed recently, don't bother
+	if isNegativeHandle(handle) {
+		return handle
+	}
+
 	// Try using the API first
-	if did, ok := ResolveHandleAPI(ctx, handle); ok {
+	did, apiErr := resolveHandleAPI(ctx, handle)
+	if apiErr == nil {
 		return did
 	}
 
@@ -137,14 +217,63 @@ func ResolveHandle(ctx context.Context, handle string) string {
 	}
 
 	// Try using .well-known
-	if did, ok := ResolveHandleHTTP(ctx, handle); ok {
+	did, httpErr := resolveHandleHTTP(ctx, handle)
+	if httpErr == nil {
 		return did
 	}
 
-	// Failed to find DID, use the handle we got
+	// Failed to find DID, use the handle we got.
+	// It's only remembered if both said it doesn't exist, a timeout (or a client that left) says nothing about the handle
+	if ctx.Err() == nil && errors.Is(apiErr, errHandleNotFound) && errors.Is(httpErr, errHandleNotFound) {
+		addNegativeHandle(handle)
+	}
+
 	return handle
 }
 
+// The same handle can come in composed or decomposed (NFC or NFD), they should resolve and cache the same
+func NormalizeHandle(handle string) string {
+	return norm.NFC.String(handle)
+}
+
+func isNegativeHandle(handle string) bool {
+	negativeHandlesMu.Lock()
+	defer negativeHandlesMu.Unlock()
+
+	expiresAt, ok := negativeHandles[handle]
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(expiresAt) {
+		delete(negativeHandles, handle)
+		return false
+	}
+
+	return true
+}
+
+func addNegativeHandle(handle string) {
+	negativeHandlesMu.Lock()
+	defer negativeHandlesMu.Unlock()
+
+	// Don't let this grow forever, drop the expired ones first, and everything if that wasn't enough
+	if len(negativeHandles) >= MaxNegativeHandles {
+		now := time.Now()
+		for k, v := range negativeHandles {
+			if now.After(v) {
+				delete(negativeHandles, k)
+			}
+		}
+
+		if len(negativeHandles) >= MaxNegativeHandles {
+			clear(negativeHandles)
+		}
+	}
+
+	negativeHandles[handle] = time.Now().Add(NegativeHandleTTL)
+}
+
 func ResolvePLC(ctx context.Context, did string) types.PLCDirectory {
 	var didURL string
 
@@ -152,7 +281,16 @@ func ResolvePLC(ctx context.Context, did string) types.PLCDirectory {
 	if strings.HasPrefix(did, "did:plc:") {
 		didURL = "https://plc.directory/" + did
 	} else if didweb, ok := strings.CutPrefix(did, "did:web:"); ok {
-		didURL = fmt.Sprintf("https://%s/.well-known/did.json", didweb)
+		host, ok := didWebHost(didweb)
+		if !ok {
+			return types.PLCDirectory{}
+		}
+
+		didURL = fmt.Sprintf("https://%s/.well-known/did.json", host)
+
+		if _, port, splitErr := net.SplitHostPort(host); splitErr == nil {
+			ctx = context.WithValue(ctx, didWebPortKey{}, port)
+		}
 	} else {
 		return types.PLCDirectory{}
 	}
@@ -181,3 +319,23 @@ func ResolvePLC(ctx context.Context, did string) types.PLCDirectory {
 
 	return plc
 }
+
+// did:web percent-encodes the port (did:web:example.com%3A3000), anything after an unencoded colon is a path, which atproto doesn't allow
+func didWebHost(didweb string) (string, bool) {
+	if didweb == "" || strings.Contains(didweb, ":") {
+		return "", false
+	}
+
+	host, unescErr := url.PathUnescape(didweb)
+	if unescErr != nil {
+		return "", false
+	}
+
+	// Make sure it's only a host (and port), so it can't point somewhere else
+	parsedURL, parseErr := url.Parse("https://" + host)
+	if parseErr != nil || parsedURL.Host != host {
+		return "", false
+	}
+
+	return host, true
+}
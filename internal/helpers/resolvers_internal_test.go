@@ -0,0 +1,248 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Answers requests with its handler instead of the network
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func TestDIDWebHost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		didweb string
+		want   string
+		wantOK bool
+	}{
+		{"plain host", "example.com", "example.com", true},
+		{"encoded port", "example.com%3A3000", "example.com:3000", true},
+		{"encoded port, lowercase escape", "example.com%3a3000", "example.com:3000", true},
+		{"path after a colon", "example.com:user:alice", "", false},
+		{"encoded port and a path", "example.com%3A3000:user", "", false},
+		{"bad escape", "example.com%3", "", false},
+		{"not hex", "example.com%zz3000", "", false},
+		{"encoded slash", "example.com%2Fevil", "", false},
+		{"encoded at sign", "user%40example.com", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := didWebHost(tt.didweb)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("didWebHost(%q) = %q, %v, want %q, %v", tt.didweb, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCheckDestinationDIDWebPort(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		didWebPort string
+		host       string
+		port       string
+		wantErr    bool
+	}{
+		{"usual port", "", "8.8.8.8", "443", false},
+		{"other port", "", "8.8.8.8", "3000", true},
+		{"the did:web's port", "3000", "8.8.8.8", "3000", false},
+		{"not the did:web's port", "3000", "8.8.8.8", "3001", true},
+		{"the did:web's port, but private", "3000", "10.0.0.1", "3000", true},
+		{"the did:web's port, but loopback", "3000", "127.0.0.1", "3000", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := t.Context()
+			if tt.didWebPort != "" {
+				ctx = context.WithValue(ctx, didWebPortKey{}, tt.didWebPort)
+			}
+
+			if err := checkDestination(ctx, tt.host, tt.port); (err != nil) != tt.wantErr {
+				t.Errorf("checkDestination(%s, %s) = %v, want error: %v", tt.host, tt.port, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNegativeHandleExpiry(t *testing.T) {
+	t.Parallel()
+
+	const handle = "expiry.negative.test"
+
+	if isNegativeHandle(handle) {
+		t.Fatalf("%s is negative before it failed", handle)
+	}
+
+	addNegativeHandle(handle)
+	if !isNegativeHandle(handle) {
+		t.Fatalf("%s isn't negative right after it failed", handle)
+	}
+
+	// As if NegativeHandleTTL went by
+	negativeHandlesMu.Lock()
+	negativeHandles[handle] = time.Now().Add(-time.Second)
+	negativeHandlesMu.Unlock()
+
+	if isNegativeHandle(handle) {
+		t.Errorf("%s is still negative after it expired", handle)
+	}
+
+	negativeHandlesMu.Lock()
+	_, kept := negativeHandles[handle]
+	negativeHandlesMu.Unlock()
+
+	if kept {
+		t.Errorf("%s was kept after it expired", handle)
+	}
+}
+
+// Answers TimeoutClient's requests with handler until the test is over, so tests using it can't run in parallel
+func stubTimeoutClient(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	transport := TimeoutClient.Transport
+	t.Cleanup(func() { TimeoutClient.Transport = transport })
+
+	TimeoutClient.Transport = handlerTransport{handler: handler}
+}
+
+func (ht handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ctxErr := req.Context().Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	recorder := httptest.NewRecorder()
+	ht.handler.ServeHTTP(recorder, req)
+
+	resp := recorder.Result()
+	resp.Request = req
+
+	return resp, nil
+}
+
+//nolint:paralleltest // Stubs TimeoutClient
+func TestResolveHandleNegativeCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// The .invalid TLD, so the DNS strategy can't find anything either
+		handle          string
+		apiStatus       int
+		wellKnownStatus int
+		cancelled       bool
+		wantNegative    bool
+	}{
+		{name: "not found anywhere", handle: "gone.invalid", apiStatus: http.StatusBadRequest, wellKnownStatus: http.StatusNotFound, wantNegative: true},
+		{name: "API outage", handle: "api-down.invalid", apiStatus: http.StatusServiceUnavailable, wellKnownStatus: http.StatusNotFound},
+		{name: "well-known outage", handle: "host-down.invalid", apiStatus: http.StatusBadRequest, wellKnownStatus: http.StatusBadGateway},
+		{name: "cancelled", handle: "cancelled.invalid", apiStatus: http.StatusBadRequest, wellKnownStatus: http.StatusNotFound, cancelled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			stubTimeoutClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				if r.URL.Path == "/.well-known/atproto-did" {
+					w.WriteHeader(tt.wellKnownStatus)
+					return
+				}
+
+				w.WriteHeader(tt.apiStatus)
+			})
+
+			ctx := t.Context()
+			if tt.cancelled {
+				cancelledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+
+				ctx = cancelledCtx
+			}
+
+			if got := ResolveHandle(ctx, tt.handle); got != tt.handle {
+				t.Fatalf("got %s, want the handle back", got)
+			}
+
+			if got := isNegativeHandle(tt.handle); got != tt.wantNegative {
+				t.Fatalf("negative: %t, want %t", got, tt.wantNegative)
+			}
+
+			// A remembered failure doesn't go out again
+			if tt.wantNegative {
+				requests = 0
+				ResolveHandle(t.Context(), tt.handle)
+
+				if requests != 0 {
+					t.Errorf("made %d upstream requests for a negative handle, want none", requests)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // Stubs TimeoutClient
+func TestResolveHandleNormalized(t *testing.T) {
+	const (
+		// "café", with a precomposed é (NFC) and with an e and a combining acute accent (NFD)
+		composed   = "caf\u00e9.invalid"
+		decomposed = "cafe\u0301.invalid"
+	)
+
+	if NormalizeHandle(decomposed) != composed || NormalizeHandle(composed) != composed {
+		t.Fatalf("NormalizeHandle(%q) = %q, want %q", decomposed, NormalizeHandle(decomposed), composed)
+	}
+
+	var asked []string
+	stubTimeoutClient(t, func(w http.ResponseWriter, r *http.Request) {
+		asked = append(asked, r.URL.Query().Get("handle"))
+		w.Write([]byte(`{"did":"did:plc:cafe"}`))
+	})
+
+	// Either form goes upstream the same way
+	for _, handle := range []string{composed, decomposed} {
+		if got := ResolveHandle(t.Context(), handle); got != "did:plc:cafe" {
+			t.Errorf("ResolveHandle(%q) = %q, want did:plc:cafe", handle, got)
+		}
+	}
+
+	if len(asked) != 2 || asked[0] != composed || asked[1] != composed {
+		t.Errorf("asked the API for %q, want %q twice", asked, composed)
+	}
+
+	// And a failure remembered for one is remembered for the other
+	stubTimeoutClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/atproto-did" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	const (
+		goneComposed   = "gon\u00e9.invalid"
+		goneDecomposed = "gone\u0301.invalid"
+	)
+
+	ResolveHandle(t.Context(), goneComposed)
+
+	if !isNegativeHandle(NormalizeHandle(goneDecomposed)) {
+		t.Errorf("%q isn't remembered after %q failed", goneDecomposed, goneComposed)
+	}
+}
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type (
+	// Identical GETs that are in flight at the same time share one round trip (a viral post gets asked for a lot at once).
+	// Only for the hosts in hosts, since the shared response is read whole. Everything else (handle hosts, did:web documents, images) streams through to the caller's own limits
+	sharedTransport struct {
+		next  http.RoundTripper
+		group *singleflight.Group
+		hosts map[string]bool
+	}
+
+	sharedResponse struct {
+		status     int
+		statusText string
+		header     http.Header
+		body       []byte
+	}
+)
+
+func (st sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || !st.hosts[req.URL.Host] {
+		return st.next.RoundTrip(req)
+	}
+
+	resultChan := st.group.DoChan(req.URL.String(), func() (any, error) {
+		// The shared request can't be cancelled by whoever started it, since others are waiting on it too, so it gets the client's limit
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), TimeoutClient.Timeout)
+		defer cancel()
+
+		resp, err := st.next.RoundTrip(req.Clone(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		defer resp.Body.Close()
+
+		// Read one byte over the limit, so whoever reads it still sees it was too big
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, MaxReadLimit+1))
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		return sharedResponse{status: resp.StatusCode, statusText: resp.Status, header: resp.Header, body: body}, nil
+	})
+
+	// Each waiter still gives up when its own request is cancelled
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case result := <-resultChan:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+
+		shared, _ := result.Val.(sharedResponse)
+
+		return &http.Response{
+			Status:        shared.statusText,
+			StatusCode:    shared.status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        shared.header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(shared.body)),
+			ContentLength: int64(len(shared.body)),
+			Request:       req,
+		}, nil
+	}
+}
@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+func TestSharedTransportCoalesces(t *testing.T) {
+	t.Parallel()
+
+	const (
+		callers = 50
+		payload = `{"thread":{}}`
+	)
+
+	var hits atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(payload))
+	}))
+	t.Cleanup(server.Close)
+
+	transport := sharedTransport{next: server.Client().Transport, group: &singleflight.Group{}, hosts: map[string]bool{server.Listener.Addr().String(): true}}
+
+	var started, done sync.WaitGroup
+	started.Add(callers)
+	for range callers {
+		done.Go(func() {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+"/xrpc/app.bsky.feed.getPostThread", http.NoBody)
+			req.RequestURI = ""
+			started.Done()
+
+			resp, respErr := transport.RoundTrip(req)
+			if respErr != nil {
+				t.Error(respErr)
+				return
+			}
+			defer resp.Body.Close()
+
+			// Every caller gets its own copy of the headers
+			resp.Header.Set("X-Mine", "yes")
+
+			body, readErr := io.ReadAll(resp.Body)
+			if readErr != nil || string(body) != payload || resp.StatusCode != http.StatusOK {
+				t.Errorf("got status %d and body %q (%v), want %d and %q", resp.StatusCode, body, readErr, http.StatusOK, payload)
+			}
+		})
+	}
+
+	// The upstream holds its answer until everyone had the time to join the request that's already going
+	started.Wait()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("the upstream was hit %d times, want once", got)
+	}
+}
+
+// Hosts that aren't listed (a handle's own host, say) get their own request, streamed as it is
+func TestSharedTransportOtherHosts(t *testing.T) {
+	t.Parallel()
+
+	const callers = 5
+
+	var hits atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+
+		w.Write([]byte("did:plc:abc"))
+	}))
+	t.Cleanup(server.Close)
+
+	transport := sharedTransport{next: server.Client().Transport, group: &singleflight.Group{}, hosts: sharedHosts}
+
+	var done sync.WaitGroup
+	for range callers {
+		done.Go(func() {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+"/.well-known/atproto-did", http.NoBody)
+			req.RequestURI = ""
+
+			resp, respErr := transport.RoundTrip(req)
+			if respErr != nil {
+				t.Error(respErr)
+				return
+			}
+
+			resp.Body.Close()
+		})
+	}
+
+	// Every caller has to reach the upstream on its own, a shared request would never get there
+	deadline := time.Now().Add(5 * time.Second)
+	for hits.Load() < callers && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	done.Wait()
+
+	if got := hits.Load(); got != callers {
+		t.Errorf("the upstream was hit %d times, want %d", got, callers)
+	}
+}
@@ -2,35 +2,79 @@ package types
 
 type (
 	UserProfile struct {
-		Handle         string `json:"handle"`
-		DisplayName    string `json:"displayName"`
-		Avatar         string `json:"avatar"`
-		Description    string `json:"description"`
-		CreatedAt      string `json:"createdAt"`
-		FollowersCount int64  `json:"followersCount"`
-		FollowsCount   int64  `json:"followsCount"`
-		PostsCount     int64  `json:"postsCount"`
-		Associated     struct {
-			Labeler bool `json:"labeler"`
-		} `json:"associated"`
+		Handle         string        `json:"handle"`
+		DisplayName    string        `json:"displayName"`
+		Avatar         string        `json:"avatar"`
+		Banner         string        `json:"banner"`
+		Description    string        `json:"description"`
+		CreatedAt      string        `json:"createdAt"`
+		FollowersCount int64         `json:"followersCount"`
+		FollowsCount   int64         `json:"followsCount"`
+		PostsCount     int64         `json:"postsCount"`
+		Associated     APIAssociated `json:"associated"`
+	}
+
+	// Rich text (tags, links, mentions), byte ranges into the post's text
+	APIFacet struct {
+		Features []struct {
+			Type string `json:"$type"`
+			URI  string `json:"uri"`
+			Tag  string `json:"tag"`
+			DID  string `json:"did"`
+		} `json:"features"`
+
+		Index struct {
+			ByteStart int64 `json:"byteStart"`
+			ByteEnd   int64 `json:"byteEnd"`
+		} `json:"index"`
+	}
+
+	APIAssociated struct {
+		Labeler bool `json:"labeler"`
+
+		// Only in full profiles, not in authors
+		Feedgens     int64 `json:"feedgens"`
+		Lists        int64 `json:"lists"`
+		StarterPacks int64 `json:"starterPacks"`
 	}
 
 	APIDID struct {
 		DID string `json:"did"`
 	}
 
+	// XRPC errors come back as {"error": "Name", "message": "..."}
+	APIError struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+
 	APIThread struct {
 		Thread struct {
+			// threadViewPost, notFoundPost or blockedPost
+			Type string `json:"$type"`
+
 			// This is the main post
 			Post APIPost `json:"post"`
 			// Parent, if this is a reply to an already existing post
 			// Also a pointer, so if there is no reply, this is nil
-			Parent *struct {
-				Post APIPost `json:"post"`
-			} `json:"parent"`
+			Parent *APIThreadParent `json:"parent"`
 		} `json:"thread"`
 	}
 
+	// Parents have their own parents (up to parentHeight), same deal with the pointer
+	APIThreadParent struct {
+		Post   APIPost          `json:"post"`
+		Parent *APIThreadParent `json:"parent"`
+		// Only there sometimes (when the parent came from a repost), nil otherwise
+		Reason *APIReason `json:"reason"`
+	}
+
+	// Why a post showed up, only reposts are used
+	APIReason struct {
+		Type string    `json:"$type"`
+		By   APIAuthor `json:"by"`
+	}
+
 	APIFeed struct {
 		View struct {
 			DisplayName string    `json:"displayName"`
@@ -45,34 +89,66 @@ type (
 		IsValid  bool `json:"isValid"`
 	}
 
+	// Only the first post is used (limit=1)
+	APIFeedPosts struct {
+		Feed []struct {
+			Post APIPost `json:"post"`
+		} `json:"feed"`
+	}
+
+	// Only the label values are used, not their definitions
+	APILabelerServices struct {
+		Views []struct {
+			Policies struct {
+				LabelValues []string `json:"labelValues"`
+			} `json:"policies"`
+		} `json:"views"`
+	}
+
 	APIList struct {
-		List struct {
-			Name        string    `json:"name"`
-			Purpose     string    `json:"purpose"`
-			Avatar      string    `json:"avatar"`
-			Description string    `json:"description"`
-			IndexedAt   string    `json:"indexedAt"`
-			Creator     APIAuthor `json:"creator"`
-			ItemCount   int64     `json:"listItemCount"`
-		} `json:"list"`
+		List APIListView `json:"list"`
+
+		// Only the first few, for the avatar mosaic
+		Items []struct {
+			Subject APIAuthor `json:"subject"`
+		} `json:"items"`
+	}
+
+	APIListView struct {
+		Name        string    `json:"name"`
+		Purpose     string    `json:"purpose"`
+		Avatar      string    `json:"avatar"`
+		Description string    `json:"description"`
+		IndexedAt   string    `json:"indexedAt"`
+		Creator     APIAuthor `json:"creator"`
+		ItemCount   int64     `json:"listItemCount"`
 	}
 
 	APIPack struct {
-		StarterPack struct {
-			Record struct {
-				Name        string `json:"name"`
-				Description string `json:"description"`
-				CreatedAt   string `json:"createdAt"`
-			} `json:"record"`
+		StarterPack APIStarterPackView `json:"starterPack"`
+	}
+
+	APIStarterPackView struct {
+		Record struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			CreatedAt   string `json:"createdAt"`
+		} `json:"record"`
 
-			Creator APIAuthor `json:"creator"`
-		} `json:"starterPack"`
+		Creator APIAuthor `json:"creator"`
 	}
 
 	APIImages []struct {
 		FullSize    string         `json:"fullsize"`
 		Alt         string         `json:"alt"`
 		AspectRatio APIAspectRatio `json:"aspectRatio"`
+		Labels      []APILabel     `json:"labels"`
+	}
+
+	APILabel struct {
+		Src string `json:"src"`
+		URI string `json:"uri"`
+		Val string `json:"val"`
 	}
 
 	APIAuthor struct {
@@ -80,6 +156,8 @@ type (
 		Handle      string `json:"handle"`
 		DisplayName string `json:"displayName"`
 		Avatar      string `json:"avatar"`
+
+		Associated APIAssociated `json:"associated"`
 	}
 
 	APIExternal struct {
@@ -87,6 +165,9 @@ type (
 		Title       string `json:"title"`
 		Description string `json:"description"`
 		Thumb       string `json:"thumb"`
+
+		// Not always there, Tenor GIFs have it in the URL instead (hh & ww)
+		AspectRatio APIAspectRatio `json:"aspectRatio"`
 	}
 
 	APIPost struct {
@@ -99,19 +180,7 @@ type (
 			Text      string `json:"text"`
 			CreatedAt string `json:"createdAt"`
 
-			Facets []struct {
-				Features []struct {
-					Type string `json:"$type"`
-					URI  string `json:"uri"`
-					Tag  string `json:"tag"`
-					DID  string `json:"did"`
-				} `json:"features"`
-
-				Index struct {
-					ByteStart int64 `json:"byteStart"`
-					ByteEnd   int64 `json:"byteEnd"`
-				} `json:"index"`
-			} `json:"facets"`
+			Facets []APIFacet `json:"facets"`
 		} `json:"record"`
 
 		// Embeds of stuff, if any.
@@ -133,21 +202,12 @@ type (
 
 				// This is a quote with media
 				Record struct {
+					Type string `json:"$type"`
+
 					Value struct {
-						Text   string `json:"text"`
-						Facets []struct {
-							Features []struct {
-								Type string `json:"$type"`
-								URI  string `json:"uri"`
-								Tag  string `json:"tag"`
-								DID  string `json:"did"`
-							} `json:"features"`
-
-							Index struct {
-								ByteStart int64 `json:"byteStart"`
-								ByteEnd   int64 `json:"byteEnd"`
-							} `json:"index"`
-						} `json:"facets"`
+						Text      string     `json:"text"`
+						CreatedAt string     `json:"createdAt"`
+						Facets    []APIFacet `json:"facets"`
 					} `json:"value"`
 
 					Author APIAuthor `json:"author"`
@@ -160,21 +220,10 @@ type (
 				} `json:"record"`
 
 				Value struct {
-					Text string `json:"text"`
-
-					Facets []struct {
-						Features []struct {
-							Type string `json:"$type"`
-							URI  string `json:"uri"`
-							Tag  string `json:"tag"`
-							DID  string `json:"did"`
-						} `json:"features"`
-
-						Index struct {
-							ByteStart int64 `json:"byteStart"`
-							ByteEnd   int64 `json:"byteEnd"`
-						} `json:"index"`
-					} `json:"facets"`
+					Text      string `json:"text"`
+					CreatedAt string `json:"createdAt"`
+
+					Facets []APIFacet `json:"facets"`
 				} `json:"value"`
 
 				Author APIAuthor `json:"author"`
@@ -195,11 +244,14 @@ type (
 							Name        string `json:"name"`
 						} `json:"record"`
 
-						// This is for feeds
+						// This is for feeds, the online/valid ones are only there sometimes (nil if not)
 						DisplayName string `json:"displayName"`
+						IsOnline    *bool  `json:"isOnline"`
+						IsValid     *bool  `json:"isValid"`
 
 						// This is for lists
-						Purpose string `json:"purpose"`
+						Purpose   string `json:"purpose"`
+						ItemCount int64  `json:"listItemCount"`
 
 						// Found in lists, starter packs, feeds
 						Name        string    `json:"name"`
@@ -209,11 +261,14 @@ type (
 					} `json:"record"`
 				} `json:"embeds"`
 
-				// This is for feeds
+				// This is for feeds, the online/valid ones are only there sometimes (nil if not)
 				DisplayName string `json:"displayName"`
+				IsOnline    *bool  `json:"isOnline"`
+				IsValid     *bool  `json:"isValid"`
 
 				// This is for lists
-				Purpose string `json:"purpose"`
+				Purpose   string `json:"purpose"`
+				ItemCount int64  `json:"listItemCount"`
 
 				// Found in lists, starter packs, feeds
 				Name        string    `json:"name"`
@@ -230,6 +285,7 @@ type (
 
 			CID         string         `json:"cid"`
 			Thumbnail   string         `json:"thumbnail"`
+			Alt         string         `json:"alt"`
 			AspectRatio APIAspectRatio `json:"aspectRatio"`
 		} `json:"embed"`
 
@@ -237,6 +293,21 @@ type (
 		RepostCount int64 `json:"repostCount"`
 		LikeCount   int64 `json:"likeCount"`
 		QuoteCount  int64 `json:"quoteCount"`
+
+		// Even logged out, this says if replies are turned off
+		Viewer struct {
+			ReplyDisabled bool `json:"replyDisabled"`
+		} `json:"viewer"`
+
+		// Nil if anyone can reply
+		Threadgate *struct {
+			Record struct {
+				// Missing means anyone can reply, empty means no one can
+				Allow []struct {
+					Type string `json:"$type"`
+				} `json:"allow"`
+			} `json:"record"`
+		} `json:"threadgate"`
 	}
 
 	MediaData struct {
@@ -250,6 +321,7 @@ type (
 
 		CID         string         `json:"cid"`
 		Thumbnail   string         `json:"thumbnail"`
+		Alt         string         `json:"alt"`
 		AspectRatio APIAspectRatio `json:"aspectRatio"`
 	}
 
@@ -264,6 +336,17 @@ type (
 		ProviderName string `json:"provider_name"`
 		ProviderURL  string `json:"provider_url"`
 		AuthorName   string `json:"author_name"`
+
+		// Only for videos, a player that starts where the link said to
+		HTML   string `json:"html,omitempty"`
+		Width  int64  `json:"width,omitempty"`
+		Height int64  `json:"height,omitempty"`
+	}
+
+	BuildInfo struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		GoVersion string `json:"goVersion"`
 	}
 
 	RichActivityEncoded struct {
@@ -331,34 +414,31 @@ type (
 			Text      string `json:"text"`
 			CreatedAt string `json:"createdAt"`
 
-			Facets []struct {
-				Features []struct {
-					Type string `json:"$type"`
-					URI  string `json:"uri"`
-					Tag  string `json:"tag"`
-					DID  string `json:"did"`
-				} `json:"features"`
-
-				Index struct {
-					ByteStart int64 `json:"byteStart"`
-					ByteEnd   int64 `json:"byteEnd"`
-				} `json:"index"`
-			} `json:"facets"`
+			Facets []APIFacet `json:"facets"`
 		} `json:"record"`
 
 		Images APIImages `json:"images"`
 
 		External APIExternal `json:"external"`
+		// The link's host without www. ("nytimes.com"), empty if it couldn't be parsed
+		ExternalDomain string `json:"externalDomain"`
 
 		PDS         string `json:"pds"`
 		VideoCID    string `json:"videoCID"`
 		VideoDID    string `json:"videoDID"`
 		VideoHelper string `json:"videoURI"`
 
+		// Tenor GIFs as an mp4, if it could be worked out
+		GifVideoURL string `json:"gifVideoURL"`
+
+		// Seconds to start the video at (0 = beginning)
+		VideoTimestamp int `json:"videoTimestamp"`
+
 		Description string `json:"description"`
 		StatsForTG  string `json:"statsForTG"`
 
 		Thumbnail   string         `json:"thumbnail"`
+		VideoAlt    string         `json:"videoAlt"`
 		AspectRatio APIAspectRatio `json:"aspectRatio"`
 
 		ReplyCount  int64 `json:"replyCount"`
@@ -366,17 +446,31 @@ type (
 		LikeCount   int64 `json:"likeCount"`
 		QuoteCount  int64 `json:"quoteCount"`
 
-		IsVideo bool `json:"isVideo"`
-		IsGif   bool `json:"isGif"`
+		IsVideo         bool `json:"isVideo"`
+		IsGif           bool `json:"isGif"`
+		RepliesDisabled bool `json:"repliesDisabled"`
+
+		// First GIF found in an image embed, if any
+		GifURL string `json:"gifURL"`
 
 		OriginalPostID string `json:"originalPostID"`
 
 		CommonEmbeds struct {
+			URI         string    `json:"uri"`
 			Purpose     string    `json:"purpose"`
 			Name        string    `json:"name"`
 			Avatar      string    `json:"avatar"`
 			Description string    `json:"description"`
 			Creator     APIAuthor `json:"creator"`
+			ItemCount   int64     `json:"itemCount"`
+
+			// For lists
+			PurposeIcon string `json:"purposeIcon"`
+
+			// For feeds
+			IsOnline     *bool  `json:"isOnline"`
+			IsValid      *bool  `json:"isValid"`
+			StatusBadges string `json:"statusBadges"`
 		} `json:"commonEmbeds"`
 	}
 
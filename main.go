@@ -1,9 +1,12 @@
 package main
 
 import (
+	"cmp"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"strconv"
 	"time"
 
 	"main/internal/handlers"
@@ -17,73 +20,392 @@ func main() {
 		panic(loadErr)
 	}
 
-	domainName := os.Getenv("DOMAIN_NAME")
-	if domainName == "" {
-		panic("DOMAIN_NAME environment variable should not be empty")
+	// Optional, overrides HTTP_PROXY/HTTPS_PROXY for every upstream request
+	if proxyErr := helpers.ConfigureUpstreamProxy(os.Getenv("UPSTREAM_PROXY")); proxyErr != nil {
+		panic(proxyErr)
 	}
 
+	config, configErr := loadConfig()
+	if configErr != nil {
+		panic(configErr)
+	}
+
+	helpers.ConfigureUpstreamLimits(time.Duration(config.UpstreamTimeout)*time.Second, config.MaxReadLimit)
+
+	if templateErr := handlers.LoadTemplates(config.TemplateDir); templateErr != nil {
+		panic(templateErr)
+	}
+
+	// Looked up once, mosaics are put together without it (jpeg only) if it isn't there
+	_, lookErr := exec.LookPath(config.FFmpegPath)
+	ffmpegAvailable := lookErr == nil
+
 	themeColor := os.Getenv("THEME_COLOR")
 	if themeColor == "" {
 		panic("THEME_COLOR environment variable should not be empty")
 	}
 
+	indexMode := os.Getenv("INDEX_MODE")
+	switch indexMode {
+	case "":
+		indexMode = handlers.IndexModeRedirect
+	case handlers.IndexModeRedirect, handlers.IndexModeLanding, handlers.IndexModeNotFound:
+	default:
+		panic("INDEX_MODE environment variable should be one of redirect, landing, notfound")
+	}
+
 	indexURL := os.Getenv("INDEX_URL")
-	if indexURL == "" {
+	if indexURL == "" && indexMode == handlers.IndexModeRedirect {
 		panic("INDEX_URL environment variable should not be empty")
 	}
 
+	statsStyle := os.Getenv("STATS_STYLE")
+	switch statsStyle {
+	case "":
+		statsStyle = handlers.StatsStyleEmoji
+	case handlers.StatsStyleEmoji, handlers.StatsStyleCompact, handlers.StatsStyleText:
+	default:
+		panic("STATS_STYLE environment variable should be one of emoji, compact, text")
+	}
+
+	defaultLanguage := os.Getenv("DEFAULT_LANGUAGE")
+	switch defaultLanguage {
+	case "":
+		defaultLanguage = handlers.LanguageEnglish
+	case handlers.LanguageEnglish, handlers.LanguageGerman, handlers.LanguageSpanish:
+	default:
+		panic("DEFAULT_LANGUAGE environment variable should be one of en, de, es")
+	}
+
+	handleSource := os.Getenv("HANDLE_SOURCE")
+	switch handleSource {
+	case "":
+		handleSource = handlers.HandleSourceAppView
+	case handlers.HandleSourceAppView, handlers.HandleSourcePLC:
+	default:
+		panic("HANDLE_SOURCE environment variable should be one of appview, plc")
+	}
+
+	// Where search engines are told the original is, Bluesky itself or us
+	canonicalTarget := os.Getenv("CANONICAL_TARGET")
+	switch canonicalTarget {
+	case "":
+		canonicalTarget = handlers.CanonicalTargetBluesky
+	case handlers.CanonicalTargetBluesky, handlers.CanonicalTargetSelf:
+	default:
+		panic("CANONICAL_TARGET environment variable should be one of bsky, self")
+	}
+
+	// Optional, disabled by default since it costs an extra request per feed embed
+	embedFeedSample := os.Getenv("EMBED_FEED_SAMPLE") == "true"
+
+	// Only enable this when running behind a proxy that sets these headers, clients can send them too
+	trustForwarded := os.Getenv("TRUST_FORWARDED_HEADERS") == "true"
+
+	// Optional, defaults to only the direct parent
+	replyChainDepth := 1
+	if depthStr := os.Getenv("REPLY_CHAIN_DEPTH"); depthStr != "" {
+		var atoiErr error
+
+		replyChainDepth, atoiErr = strconv.Atoi(depthStr)
+		if atoiErr != nil || replyChainDepth < 1 {
+			panic("REPLY_CHAIN_DEPTH environment variable should be a number above 0")
+		}
+	}
+
+	// Optional, asks search engines not to index pages (social crawlers still read the og tags)
+	noIndex := os.Getenv("NOINDEX") == "true"
+
+	// Optional, a different robots.txt than the one next to the binary
+	robotsFile := cmp.Or(os.Getenv("ROBOTS_FILE"), "./robots.txt")
+
+	// Optional, exposes how long each step of a request took to browser DevTools
+	enableServerTiming := os.Getenv("ENABLE_SERVER_TIMING") == "true"
+
+	// Optional, used as the image when a profile or creator has no avatar
+	fallbackAvatar := os.Getenv("FALLBACK_AVATAR")
+	if fallbackAvatar != "" {
+		if parsedURL, parseErr := url.Parse(fallbackAvatar); parseErr != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+			panic("FALLBACK_AVATAR environment variable should be an http(s) URL")
+		}
+	}
+
+	// Optional, logs every upstream request (URL, status, decoding) for every request, very noisy
+	helpers.DebugAll = os.Getenv("DEBUG_UPSTREAM") == "true"
+
+	// Optional, lets single requests be debugged with ?debug=1 and this in the X-Debug-Token header
+	debugToken := os.Getenv("DEBUG_TOKEN")
+
+	// Optional, profiles show the avatar by default, the banner is bigger but not everyone has one
+	profileBanner := os.Getenv("PROFILE_BANNER") == "true"
+
+	mosaicFallback := os.Getenv("MOSAIC_FALLBACK")
+	switch mosaicFallback {
+	case "":
+		mosaicFallback = handlers.MosaicFallbackRedirect
+	case handlers.MosaicFallbackRedirect, handlers.MosaicFallbackError:
+	default:
+		panic("MOSAIC_FALLBACK environment variable should be one of redirect, error")
+	}
+
+	// Optional, animated mosaics are disabled by default since they take a lot more CPU
+	mosaicAnimated := os.Getenv("MOSAIC_ANIMATED") == "true"
+
+	// Optional, 1-100, higher is better looking but bigger. Can be changed per link with ?quality=
+	var mosaicQuality int
+	if qualityStr := os.Getenv("MOSAIC_QUALITY"); qualityStr != "" {
+		var atoiErr error
+
+		mosaicQuality, atoiErr = strconv.Atoi(qualityStr)
+		if atoiErr != nil || mosaicQuality < 1 || mosaicQuality > 100 {
+			panic("MOSAIC_QUALITY environment variable should be a number from 1 to 100")
+		}
+	}
+
+	// Optional, checks every image is reachable before making a mosaic, broken ones are left out
+	mosaicValidateImages := os.Getenv("MOSAIC_VALIDATE_IMAGES") == "true"
+
+	// Optional, Telegram always gets the mosaic for multi-image posts, this gives it to everyone (some prefer the separate images)
+	mosaicOGImage := os.Getenv("MOSAIC_OG_IMAGE") == "true"
+
+	// Optional, adds the domain of a link card to the site name ("xbsky.app · nytimes.com")
+	externalSiteName := os.Getenv("EXTERNAL_SITE_NAME") == "true"
+
+	// Optional, adds when the quoted post was made under the quote
+	quoteTimestamps := os.Getenv("QUOTE_TIMESTAMPS") == "true"
+
+	// Optional, the feed page always shows likes and status, this adds them to the description too
+	feedStatsInDescription := os.Getenv("FEED_STATS_IN_DESCRIPTION") == "true"
+
+	// Optional, defaults to an hour
+	oembedMaxAge := 3600
+	if maxAgeStr := os.Getenv("OEMBED_MAX_AGE"); maxAgeStr != "" {
+		var atoiErr error
+
+		oembedMaxAge, atoiErr = strconv.Atoi(maxAgeStr)
+		if atoiErr != nil || oembedMaxAge < 0 {
+			panic("OEMBED_MAX_AGE environment variable should be a number of seconds (0 or more)")
+		}
+	}
+
+	// Optional, has to stay under the server's WriteTimeout (30 seconds) to be of any use
+	requestTimeout := 20 * time.Second
+	if timeoutStr := os.Getenv("REQUEST_TIMEOUT"); timeoutStr != "" {
+		timeout, atoiErr := strconv.Atoi(timeoutStr)
+		if atoiErr != nil || timeout < 0 || timeout >= 30 {
+			panic("REQUEST_TIMEOUT environment variable should be a number of seconds (0 to 29)")
+		}
+
+		requestTimeout = time.Duration(timeout) * time.Second
+	}
+
+	// Optional, ffmpeg downloads the images for mosaics itself, this is how long it waits on an image host that doesn't answer
+	mosaicInputTimeout := 10 * time.Second
+	if timeoutStr := os.Getenv("MOSAIC_INPUT_TIMEOUT"); timeoutStr != "" {
+		timeout, atoiErr := strconv.Atoi(timeoutStr)
+		if atoiErr != nil || timeout < 1 {
+			panic("MOSAIC_INPUT_TIMEOUT environment variable should be a number of seconds above 0")
+		}
+
+		mosaicInputTimeout = time.Duration(timeout) * time.Second
+	}
+
+	// Optional, handles can be up to 253 characters, record keys are much shorter
+	maxPathValueLen := 256
+	if maxLenStr := os.Getenv("MAX_PATH_VALUE_LEN"); maxLenStr != "" {
+		var atoiErr error
+
+		maxPathValueLen, atoiErr = strconv.Atoi(maxLenStr)
+		if atoiErr != nil || maxPathValueLen < 1 {
+			panic("MAX_PATH_VALUE_LEN environment variable should be a number above 0")
+		}
+	}
+
+	// Optional, posts can have any number of facets, only this many are turned into links (0 for none)
+	maxFacets := 100
+	if maxFacetsStr := os.Getenv("MAX_FACETS"); maxFacetsStr != "" {
+		var atoiErr error
+
+		maxFacets, atoiErr = strconv.Atoi(maxFacetsStr)
+		if atoiErr != nil || maxFacets < 0 {
+			panic("MAX_FACETS environment variable should be a number, 0 or above")
+		}
+	}
+
+	// Optional, how many finished mosaics are kept in memory (0 for none), and how many megabytes they can take up together
+	mosaicCacheEntries := 200
+	if entriesStr := os.Getenv("MOSAIC_CACHE_ENTRIES"); entriesStr != "" {
+		var atoiErr error
+
+		mosaicCacheEntries, atoiErr = strconv.Atoi(entriesStr)
+		if atoiErr != nil || mosaicCacheEntries < 0 {
+			panic("MOSAIC_CACHE_ENTRIES environment variable should be a number, 0 or above")
+		}
+	}
+
+	mosaicCacheMB := 64
+	if megabytesStr := os.Getenv("MOSAIC_CACHE_MB"); megabytesStr != "" {
+		var atoiErr error
+
+		mosaicCacheMB, atoiErr = strconv.Atoi(megabytesStr)
+		if atoiErr != nil || mosaicCacheMB < 1 {
+			panic("MOSAIC_CACHE_MB environment variable should be a number, 1 or above")
+		}
+	}
+
+	// Optional, in seconds, 0 turns caching off for that kind of content
+	cacheTTL := func(envName string, fallback int) time.Duration {
+		ttlStr := os.Getenv(envName)
+		if ttlStr == "" {
+			return time.Duration(fallback) * time.Second
+		}
+
+		ttl, atoiErr := strconv.Atoi(ttlStr)
+		if atoiErr != nil || ttl < 0 {
+			panic(envName + " environment variable should be a number of seconds (0 or more)")
+		}
+
+		return time.Duration(ttl) * time.Second
+	}
+
+	// Profiles (and their stats) change the most, posts barely change at all
+	cacheTTLs := map[string]time.Duration{
+		handlers.CacheProfile: cacheTTL("CACHE_TTL_PROFILE", 60),
+		handlers.CachePost:    cacheTTL("CACHE_TTL_POST", 300),
+		handlers.CacheFeed:    cacheTTL("CACHE_TTL_FEED", 300),
+		handlers.CacheList:    cacheTTL("CACHE_TTL_LIST", 300),
+		handlers.CachePack:    cacheTTL("CACHE_TTL_PACK", 300),
+	}
+
+	// Optional, how long Bluesky's answers are kept (by URL) for the pages above, in seconds, 0 turns it off
+	helpers.APICacheTTLs = map[string]time.Duration{
+		"app.bsky.actor.getProfile":      cacheTTL("API_CACHE_TTL_PROFILE", 300),
+		"app.bsky.feed.getPostThread":    cacheTTL("API_CACHE_TTL_POST", 30),
+		"app.bsky.feed.getFeedGenerator": cacheTTL("API_CACHE_TTL_FEED", 300),
+		"app.bsky.graph.getList":         cacheTTL("API_CACHE_TTL_LIST", 300),
+		"app.bsky.graph.getStarterPack":  cacheTTL("API_CACHE_TTL_PACK", 300),
+	}
+
+	// Optional, the Cache-Control header of each kind of page (for example "public, max-age=60" to let crawlers keep embeds for a minute)
+	pageCacheControl := func(envName string) string {
+		return cmp.Or(os.Getenv(envName), "no-cache")
+	}
+
+	pageCacheControls := map[string]string{
+		handlers.CacheProfile: pageCacheControl("CACHE_CONTROL_PROFILE"),
+		handlers.CachePost:    pageCacheControl("CACHE_CONTROL_POST"),
+		handlers.CacheFeed:    pageCacheControl("CACHE_CONTROL_FEED"),
+		handlers.CacheList:    pageCacheControl("CACHE_CONTROL_LIST"),
+		handlers.CachePack:    pageCacheControl("CACHE_CONTROL_PACK"),
+	}
+
+	// Optional, how long past their TTL cached pages can be served when Bluesky is having problems
+	cacheStaleTTL := cacheTTL("CACHE_STALE_TTL", 3600)
+
+	// Optional, the API doesn't allow cross-origin requests unless this is set (to * or a comma-separated list of origins)
+	apiCORSOrigin := os.Getenv("API_CORS_ORIGIN")
+
+	// Optional, watermarks on mosaics are disabled by default
+	enableWatermark := os.Getenv("ENABLE_WATERMARK") == "true"
+	watermarkDefault := os.Getenv("WATERMARK_DEFAULT")
+
 	hPass := handlers.HandlerPass{
-		DomainName: domainName,
-		ThemeColor: themeColor,
-		IndexURL:   indexURL,
+		DomainName:             config.DomainName,
+		ThemeColor:             themeColor,
+		IndexURL:               indexURL,
+		IndexMode:              indexMode,
+		StatsStyle:             statsStyle,
+		ReplyChainDepth:        replyChainDepth,
+		OembedMaxAge:           oembedMaxAge,
+		MaxPathValueLen:        maxPathValueLen,
+		MosaicQuality:          mosaicQuality,
+		MaxFacets:              maxFacets,
+		MosaicCacheEntries:     mosaicCacheEntries,
+		MosaicCacheBytes:       mosaicCacheMB * 1024 * 1024,
+		CacheTTLs:              cacheTTLs,
+		PageCacheControl:       pageCacheControls,
+		CacheStaleTTL:          cacheStaleTTL,
+		RequestTimeout:         requestTimeout,
+		MosaicInputTimeout:     mosaicInputTimeout,
+		EmbedFeedSample:        embedFeedSample,
+		TrustForwarded:         trustForwarded,
+		EnableWatermark:        enableWatermark,
+		ProfileBanner:          profileBanner,
+		NoIndex:                noIndex,
+		RobotsFile:             robotsFile,
+		EnableServerTiming:     enableServerTiming,
+		MosaicAnimated:         mosaicAnimated,
+		MosaicValidateImages:   mosaicValidateImages,
+		MosaicOGImage:          mosaicOGImage,
+		CanonicalSelf:          canonicalTarget == handlers.CanonicalTargetSelf,
+		QuoteTimestamps:        quoteTimestamps,
+		ExternalSiteName:       externalSiteName,
+		FeedStatsInDescription: feedStatsInDescription,
+		FFmpegAvailable:        ffmpegAvailable,
+		MosaicFallback:         mosaicFallback,
+		APICORSOrigin:          apiCORSOrigin,
+		DefaultLanguage:        defaultLanguage,
+		HandleSource:           handleSource,
+		FallbackAvatar:         fallbackAvatar,
+		DebugToken:             debugToken,
+		WatermarkDefault:       watermarkDefault,
+		FFmpegPath:             config.FFmpegPath,
 	}
 
 	sMux := http.NewServeMux()
-	sMux.HandleFunc("GET /profile/{profileID}", hPass.GetProfile)
-	sMux.HandleFunc("GET /profile/{profileID}/post/{postID}", hPass.GetPost)
-	sMux.HandleFunc("GET /profile/{profileID}/post/{postID}/photo/{photoNum}", hPass.GetPost)
-	sMux.HandleFunc("GET /profile/{profileID}/feed/{feedID}", hPass.GetFeed)
-	sMux.HandleFunc("GET /profile/{profileID}/lists/{listID}", hPass.GetList)
-	sMux.HandleFunc("GET /starter-pack/{profileID}/{packID}", hPass.GetPack)
+	sMux.HandleFunc("GET /profile/{profileID}", hPass.Cached(handlers.CacheProfile, hPass.GetProfile))
+	sMux.HandleFunc("GET /profile/{profileID}/post/{postID}", hPass.Cached(handlers.CachePost, hPass.GetPost))
+	sMux.HandleFunc("GET /profile/{profileID}/post/{postID}/photo/{photoNum}", hPass.Cached(handlers.CachePost, hPass.GetPost))
+	sMux.HandleFunc("GET /profile/{profileID}/feed/{feedID}", hPass.Cached(handlers.CacheFeed, hPass.GetFeed))
+	sMux.HandleFunc("GET /profile/{profileID}/lists/{listID}", hPass.Cached(handlers.CacheList, hPass.GetList))
+	sMux.HandleFunc("GET /starter-pack/{profileID}/{packID}", hPass.Cached(handlers.CachePack, hPass.GetPack))
+
+	sMux.HandleFunc("GET /at/{atURI...}", hPass.GetATURI)
+
+	sMux.HandleFunc("GET /raw-json/profile/{profileID}", hPass.Cached(handlers.CacheProfile, hPass.GetRawProfile))
+	sMux.HandleFunc("GET /raw-json/profile/{profileID}/post/{postID}", hPass.Cached(handlers.CachePost, hPass.GetRawPost))
+	sMux.HandleFunc("GET /text/profile/{profileID}/post/{postID}", hPass.GetPostText)
 
 	sMux.HandleFunc("GET /static/favicon.png", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./favicon.png")
 	})
 
+	sMux.HandleFunc("GET "+handlers.DefaultFeedAvatarPath, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./default-feed.svg")
+	})
+
+	sMux.HandleFunc("GET /robots.txt", hPass.GetRobots)
+
 	sMux.HandleFunc("GET /users/{ignoredField}/statuses/{id}", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "https://"+domainName+"/api/v1/statuses/"+url.PathEscape(r.PathValue("id")), http.StatusFound)
+		http.Redirect(w, r, "https://"+config.DomainName+"/api/v1/statuses/"+url.PathEscape(r.PathValue("id")), http.StatusFound)
 	})
 
 	sMux.HandleFunc("GET /api/v1/statuses/{id}", hPass.GenActivity)
 	sMux.HandleFunc("GET /oembed", hPass.GenOembed)
+	sMux.HandleFunc("GET /version", handlers.GetVersion)
+	sMux.HandleFunc("GET /cache/stats", handlers.GetCacheStats)
 	sMux.HandleFunc("GET /", hPass.IndexPage)
 
 	manager := autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(domainName, "raw."+domainName, "mosaic."+domainName, "api."+domainName),
-		Cache:      autocert.DirCache("certs"),
+		HostPolicy: autocert.HostWhitelist(config.DomainName, "raw."+config.DomainName, "mosaic."+config.DomainName, "api."+config.DomainName),
+		Cache:      autocert.DirCache(config.CertCacheDir),
 	}
 
 	go helpers.BlueskyHealthCheck()
 
-	go func() {
-		httpServer := &http.Server{
-			Addr:              ":80",
-			Handler:           manager.HTTPHandler(nil),
-			ReadTimeout:       30 * time.Second,
-			ReadHeaderTimeout: 10 * time.Second,
-			WriteTimeout:      30 * time.Second,
-			IdleTimeout:       time.Minute,
-		}
-
-		if httpListenErr := httpServer.ListenAndServe(); httpListenErr != nil {
-			panic(httpListenErr)
-		}
-	}()
+	httpServer := &http.Server{
+		Addr:              config.ListenHTTP,
+		Handler:           manager.HTTPHandler(nil),
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
 
 	httpsServer := &http.Server{
-		Addr:              ":443",
-		Handler:           sMux,
+		Addr:              config.ListenHTTPS,
+		Handler:           hPass.CORS(hPass.LimitPathValues(hPass.Debug(hPass.Deadline(sMux)))),
 		TLSConfig:         manager.TLSConfig(),
 		ReadTimeout:       30 * time.Second,
 		ReadHeaderTimeout: 10 * time.Second,
@@ -91,7 +413,8 @@ func main() {
 		IdleTimeout:       time.Minute,
 	}
 
-	if httpsListenErr := httpsServer.ListenAndServeTLS("", ""); httpsListenErr != nil {
-		panic(httpsListenErr)
-	}
+	handlers.ServeUntilSignal(time.Duration(config.ShutdownTimeout)*time.Second, map[*http.Server]func() error{
+		httpServer:  httpServer.ListenAndServe,
+		httpsServer: func() error { return httpsServer.ListenAndServeTLS("", "") },
+	})
 }